@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE groups ADD COLUMN parent_group_id INTEGER REFERENCES groups(group_id);
+CREATE INDEX idx_groups_parent ON groups(parent_group_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_groups_parent;
+ALTER TABLE groups DROP COLUMN parent_group_id;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE weapons ADD COLUMN image_key TEXT;
+ALTER TABLE vehicles ADD COLUMN image_key TEXT;
+
+-- Images uploaded before keys were stored are all in GCS, where the key is
+-- the part of the URL after the bucket name
+UPDATE weapons
+SET image_key = substr(substr(image_url, 32), instr(substr(image_url, 32), '/') + 1)
+WHERE image_url LIKE 'https://storage.googleapis.com/%';
+
+UPDATE vehicles
+SET image_key = substr(substr(image_url, 32), instr(substr(image_url, 32), '/') + 1)
+WHERE image_url LIKE 'https://storage.googleapis.com/%';
+
+-- +goose Down
+ALTER TABLE vehicles DROP COLUMN image_key;
+ALTER TABLE weapons DROP COLUMN image_key;
@@ -0,0 +1,122 @@
+-- +goose Up
+-- Full-text indexes over the searchable columns. Each index reads its text
+-- from the indexed table and is kept in sync by the triggers below.
+CREATE VIRTUAL TABLE groups_fts USING fts5(
+    group_name,
+    content='groups', content_rowid='group_id'
+);
+
+CREATE VIRTUAL TABLE members_fts USING fts5(
+    member_role, member_rank,
+    content='members', content_rowid='member_id'
+);
+
+CREATE VIRTUAL TABLE weapons_fts USING fts5(
+    weapon_name, weapon_type, weapon_caliber,
+    content='weapons', content_rowid='weapon_id'
+);
+
+CREATE VIRTUAL TABLE vehicles_fts USING fts5(
+    vehicle_name, vehicle_type, vehicle_armament,
+    content='vehicles', content_rowid='vehicle_id'
+);
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_update AFTER UPDATE OF group_name ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER members_fts_insert AFTER INSERT ON members BEGIN
+    INSERT INTO members_fts(rowid, member_role, member_rank) VALUES (new.member_id, new.member_role, new.member_rank);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER members_fts_delete AFTER DELETE ON members BEGIN
+    INSERT INTO members_fts(members_fts, rowid, member_role, member_rank) VALUES ('delete', old.member_id, old.member_role, old.member_rank);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER members_fts_update AFTER UPDATE OF member_role, member_rank ON members BEGIN
+    INSERT INTO members_fts(members_fts, rowid, member_role, member_rank) VALUES ('delete', old.member_id, old.member_role, old.member_rank);
+    INSERT INTO members_fts(rowid, member_role, member_rank) VALUES (new.member_id, new.member_role, new.member_rank);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER weapons_fts_insert AFTER INSERT ON weapons BEGIN
+    INSERT INTO weapons_fts(rowid, weapon_name, weapon_type, weapon_caliber) VALUES (new.weapon_id, new.weapon_name, new.weapon_type, new.weapon_caliber);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER weapons_fts_delete AFTER DELETE ON weapons BEGIN
+    INSERT INTO weapons_fts(weapons_fts, rowid, weapon_name, weapon_type, weapon_caliber) VALUES ('delete', old.weapon_id, old.weapon_name, old.weapon_type, old.weapon_caliber);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER weapons_fts_update AFTER UPDATE OF weapon_name, weapon_type, weapon_caliber ON weapons BEGIN
+    INSERT INTO weapons_fts(weapons_fts, rowid, weapon_name, weapon_type, weapon_caliber) VALUES ('delete', old.weapon_id, old.weapon_name, old.weapon_type, old.weapon_caliber);
+    INSERT INTO weapons_fts(rowid, weapon_name, weapon_type, weapon_caliber) VALUES (new.weapon_id, new.weapon_name, new.weapon_type, new.weapon_caliber);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER vehicles_fts_insert AFTER INSERT ON vehicles BEGIN
+    INSERT INTO vehicles_fts(rowid, vehicle_name, vehicle_type, vehicle_armament) VALUES (new.vehicle_id, new.vehicle_name, new.vehicle_type, new.vehicle_armament);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER vehicles_fts_delete AFTER DELETE ON vehicles BEGIN
+    INSERT INTO vehicles_fts(vehicles_fts, rowid, vehicle_name, vehicle_type, vehicle_armament) VALUES ('delete', old.vehicle_id, old.vehicle_name, old.vehicle_type, old.vehicle_armament);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER vehicles_fts_update AFTER UPDATE OF vehicle_name, vehicle_type, vehicle_armament ON vehicles BEGIN
+    INSERT INTO vehicles_fts(vehicles_fts, rowid, vehicle_name, vehicle_type, vehicle_armament) VALUES ('delete', old.vehicle_id, old.vehicle_name, old.vehicle_type, old.vehicle_armament);
+    INSERT INTO vehicles_fts(rowid, vehicle_name, vehicle_type, vehicle_armament) VALUES (new.vehicle_id, new.vehicle_name, new.vehicle_type, new.vehicle_armament);
+END;
+-- +goose StatementEnd
+
+-- Index the existing rows
+INSERT INTO groups_fts(groups_fts) VALUES ('rebuild');
+INSERT INTO members_fts(members_fts) VALUES ('rebuild');
+INSERT INTO weapons_fts(weapons_fts) VALUES ('rebuild');
+INSERT INTO vehicles_fts(vehicles_fts) VALUES ('rebuild');
+
+-- +goose Down
+DROP TRIGGER IF EXISTS vehicles_fts_update;
+DROP TRIGGER IF EXISTS vehicles_fts_delete;
+DROP TRIGGER IF EXISTS vehicles_fts_insert;
+DROP TRIGGER IF EXISTS weapons_fts_update;
+DROP TRIGGER IF EXISTS weapons_fts_delete;
+DROP TRIGGER IF EXISTS weapons_fts_insert;
+DROP TRIGGER IF EXISTS members_fts_update;
+DROP TRIGGER IF EXISTS members_fts_delete;
+DROP TRIGGER IF EXISTS members_fts_insert;
+DROP TRIGGER IF EXISTS groups_fts_update;
+DROP TRIGGER IF EXISTS groups_fts_delete;
+DROP TRIGGER IF EXISTS groups_fts_insert;
+DROP TABLE IF EXISTS vehicles_fts;
+DROP TABLE IF EXISTS weapons_fts;
+DROP TABLE IF EXISTS members_fts;
+DROP TABLE IF EXISTS groups_fts;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('viewer', 'editor', 'admin'));
+
+-- Every account could change everything before roles existed
+UPDATE users SET role = 'admin';
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN role;
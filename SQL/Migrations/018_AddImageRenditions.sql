@@ -0,0 +1,13 @@
+-- +goose Up
+-- Smaller renditions of uploaded images. They are null for images uploaded
+-- before renditions were made, which are shown at full size.
+ALTER TABLE weapons ADD COLUMN medium_url TEXT;
+ALTER TABLE weapons ADD COLUMN thumbnail_url TEXT;
+ALTER TABLE vehicles ADD COLUMN medium_url TEXT;
+ALTER TABLE vehicles ADD COLUMN thumbnail_url TEXT;
+
+-- +goose Down
+ALTER TABLE vehicles DROP COLUMN thumbnail_url;
+ALTER TABLE vehicles DROP COLUMN medium_url;
+ALTER TABLE weapons DROP COLUMN thumbnail_url;
+ALTER TABLE weapons DROP COLUMN medium_url;
@@ -0,0 +1,65 @@
+-- +goose Up
+-- Calibers are the kinds of ammunition weapons fire. weapon_caliber stays as
+-- written, and caliber_id links it to the catalog through the aliases, which
+-- are stored in lower case and include each caliber's own name.
+CREATE TABLE calibers (
+    caliber_id INTEGER PRIMARY KEY,
+    caliber_name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE caliber_aliases (
+    alias TEXT PRIMARY KEY,
+    caliber_id INTEGER NOT NULL REFERENCES calibers(caliber_id) ON DELETE CASCADE
+);
+CREATE INDEX idx_caliber_aliases_caliber ON caliber_aliases(caliber_id);
+
+-- Weapons chambered for caliber_id can also fire substitute_id
+CREATE TABLE caliber_substitutes (
+    caliber_id INTEGER NOT NULL REFERENCES calibers(caliber_id) ON DELETE CASCADE,
+    substitute_id INTEGER NOT NULL REFERENCES calibers(caliber_id) ON DELETE CASCADE,
+    PRIMARY KEY (caliber_id, substitute_id)
+);
+
+ALTER TABLE weapons ADD COLUMN caliber_id INTEGER REFERENCES calibers(caliber_id);
+CREATE INDEX idx_weapons_caliber ON weapons(caliber_id);
+
+INSERT INTO calibers (caliber_id, caliber_name) VALUES
+(1, '5.56x45mm NATO'),
+(2, '.223 Remington'),
+(3, '7.62x51mm NATO'),
+(4, '.308 Winchester'),
+(5, '12.7x99mm NATO'),
+(6, '9x19mm Parabellum'),
+(7, '40x46mm'),
+(8, '7.62x39mm'),
+(9, '5.45x39mm'),
+(10, '7.62x54mmR');
+
+-- A bare "7.62mm" is taken to be the NATO round, as in the seeded catalog
+INSERT INTO caliber_aliases (alias, caliber_id) VALUES
+('5.56x45mm nato', 1), ('5.56x45mm', 1), ('5.56mm', 1), ('5.56', 1), ('5.56 nato', 1), ('5.56mm nato', 1),
+('.223 remington', 2), ('.223', 2), ('.223 rem', 2),
+('7.62x51mm nato', 3), ('7.62x51mm', 3), ('7.62mm', 3), ('7.62 nato', 3), ('7.62mm nato', 3),
+('.308 winchester', 4), ('.308', 4), ('.308 win', 4),
+('12.7x99mm nato', 5), ('12.7x99mm', 5), ('12.7mm', 5), ('.50 bmg', 5), ('.50 cal', 5), ('.50', 5),
+('9x19mm parabellum', 6), ('9x19mm', 6), ('9mm', 6), ('9mm nato', 6),
+('40x46mm', 7), ('40mm', 7), ('40mm grenade', 7),
+('7.62x39mm', 8),
+('5.45x39mm', 9), ('5.45mm', 9),
+('7.62x54mmr', 10), ('7.62x54r', 10);
+
+INSERT INTO caliber_substitutes (caliber_id, substitute_id) VALUES
+(1, 2),
+(3, 4);
+
+UPDATE weapons SET caliber_id = (
+    SELECT caliber_id FROM caliber_aliases WHERE alias = lower(trim(weapons.weapon_caliber))
+);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_weapons_caliber;
+ALTER TABLE weapons DROP COLUMN caliber_id;
+DROP TABLE IF EXISTS caliber_substitutes;
+DROP INDEX IF EXISTS idx_caliber_aliases_caliber;
+DROP TABLE IF EXISTS caliber_aliases;
+DROP TABLE IF EXISTS calibers;
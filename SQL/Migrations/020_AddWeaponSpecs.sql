@@ -0,0 +1,18 @@
+-- +goose Up
+-- Optional performance and weight attributes of weapons; null when unknown.
+-- Ranges and lengths are in metres and millimetres, weights in kilograms,
+-- and the rate of fire in rounds per minute.
+ALTER TABLE weapons ADD COLUMN effective_range INTEGER;
+ALTER TABLE weapons ADD COLUMN rate_of_fire INTEGER;
+ALTER TABLE weapons ADD COLUMN weight_empty REAL;
+ALTER TABLE weapons ADD COLUMN weight_loaded REAL;
+ALTER TABLE weapons ADD COLUMN length INTEGER;
+ALTER TABLE weapons ADD COLUMN magazine_capacity INTEGER;
+
+-- +goose Down
+ALTER TABLE weapons DROP COLUMN magazine_capacity;
+ALTER TABLE weapons DROP COLUMN length;
+ALTER TABLE weapons DROP COLUMN weight_loaded;
+ALTER TABLE weapons DROP COLUMN weight_empty;
+ALTER TABLE weapons DROP COLUMN rate_of_fire;
+ALTER TABLE weapons DROP COLUMN effective_range;
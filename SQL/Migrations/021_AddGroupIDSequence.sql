@@ -0,0 +1,79 @@
+-- +goose Up
+-- Group IDs are never reused, so the history of a deleted group stays its own
+-- and the group can be restored under its old ID. AUTOINCREMENT keeps the
+-- highest ID ever used in sqlite_sequence, which needs the table rebuilt.
+CREATE TABLE groups_new (
+    group_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_name TEXT,
+    group_size INTEGER,
+    group_nationality TEXT,
+    country_code TEXT,
+    parent_group_id INTEGER REFERENCES groups(group_id)
+);
+INSERT INTO groups_new (group_id, group_name, group_size, group_nationality, country_code, parent_group_id)
+SELECT group_id, group_name, group_size, group_nationality, country_code, parent_group_id FROM groups;
+DROP TABLE groups;
+ALTER TABLE groups_new RENAME TO groups;
+CREATE INDEX idx_groups_parent ON groups(parent_group_id);
+
+-- Deleted groups are only left in the audit log
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'groups', MAX(id) FROM (
+    SELECT COALESCE(MAX(group_id), 0) AS id FROM groups
+    UNION ALL
+    SELECT COALESCE(MAX(CAST(entity_id AS INTEGER)), 0) FROM audit_log WHERE entity_type = 'group'
+);
+
+-- The search index triggers were dropped with the old table
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_update AFTER UPDATE OF group_name ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+CREATE TABLE groups_old (
+    group_id INTEGER PRIMARY KEY,
+    group_name TEXT,
+    group_size INTEGER,
+    group_nationality TEXT,
+    country_code TEXT,
+    parent_group_id INTEGER REFERENCES groups(group_id)
+);
+INSERT INTO groups_old (group_id, group_name, group_size, group_nationality, country_code, parent_group_id)
+SELECT group_id, group_name, group_size, group_nationality, country_code, parent_group_id FROM groups;
+DROP TABLE groups;
+ALTER TABLE groups_old RENAME TO groups;
+CREATE INDEX idx_groups_parent ON groups(parent_group_id);
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER groups_fts_update AFTER UPDATE OF group_name ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, group_name) VALUES ('delete', old.group_id, old.group_name);
+    INSERT INTO groups_fts(rowid, group_name) VALUES (new.group_id, new.group_name);
+END;
+-- +goose StatementEnd
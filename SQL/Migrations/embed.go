@@ -0,0 +1,10 @@
+// Package migrations embeds the schema migrations so the binary can apply
+// them itself. The files use goose annotations and can still be run with goose.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Link the weapons added by the earlier seeds to the caliber catalog
+UPDATE weapons SET caliber_id = (
+    SELECT caliber_id FROM caliber_aliases WHERE alias = lower(trim(weapons.weapon_caliber))
+);
+
+-- +goose Down
+UPDATE weapons SET caliber_id = NULL;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Approximate published figures for the seeded weapons. Belt-fed weapons
+-- have no magazine capacity.
+UPDATE weapons SET effective_range = 500, rate_of_fire = 800, weight_empty = 2.88, weight_loaded = 3.52, length = 838, magazine_capacity = 30 WHERE weapon_id = 1;
+UPDATE weapons SET effective_range = 800, rate_of_fire = 850, weight_empty = 7.5, weight_loaded = 10.0, length = 1041, magazine_capacity = 200 WHERE weapon_id = 2;
+UPDATE weapons SET effective_range = 150, weight_empty = 1.5, weight_loaded = 1.73, length = 350, magazine_capacity = 1 WHERE weapon_id = 3;
+UPDATE weapons SET effective_range = 800, weight_empty = 6.9, weight_loaded = 7.7, length = 1029, magazine_capacity = 20 WHERE weapon_id = 4;
+UPDATE weapons SET effective_range = 550, rate_of_fire = 800, weight_empty = 3.6, weight_loaded = 4.4, length = 940, magazine_capacity = 30 WHERE weapon_id = 5;
+UPDATE weapons SET effective_range = 800, rate_of_fire = 650, weight_empty = 12.5, weight_loaded = 14.0, length = 1245 WHERE weapon_id = 6;
+UPDATE weapons SET effective_range = 400, rate_of_fire = 700, weight_empty = 4.1, weight_loaded = 4.9, length = 785, magazine_capacity = 30 WHERE weapon_id = 7;
+UPDATE weapons SET effective_range = 800, rate_of_fire = 750, weight_empty = 10.9, weight_loaded = 13.8, length = 1232 WHERE weapon_id = 8;
+UPDATE weapons SET effective_range = 400, rate_of_fire = 800, weight_empty = 3.9, weight_loaded = 4.4, length = 930, magazine_capacity = 30 WHERE weapon_id = 10;
+UPDATE weapons SET effective_range = 800, rate_of_fire = 800, weight_empty = 6.9, weight_loaded = 10.0, length = 1040, magazine_capacity = 200 WHERE weapon_id = 11;
+
+-- +goose Down
+UPDATE weapons SET effective_range = NULL, rate_of_fire = NULL, weight_empty = NULL, weight_loaded = NULL, length = NULL, magazine_capacity = NULL
+WHERE weapon_id IN (1, 2, 3, 4, 5, 6, 7, 8, 10, 11);
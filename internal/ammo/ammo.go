@@ -0,0 +1,157 @@
+// Package ammo works out the ammunition a group or country needs from the
+// weapons its members carry and the armament of its vehicles, counting the
+// weapons that fire each caliber in the caliber catalog.
+package ammo
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// unknownCaliber names the caliber of weapons whose caliber is not given
+const unknownCaliber = "Unknown"
+
+// mountCount matches a leading count of identical mounted weapons, as in
+// "2x M240" or "2 x M240"
+var mountCount = regexp.MustCompile(`^(\d+)\s*[x×]\s+`)
+
+// Demand counts the weapons firing each caliber. weapons are the weapons
+// carried by members, with how many members carry each, and vehicles the
+// vehicles with how many of each there are. Vehicle armament is a list of
+// weapon names or calibers separated by commas, semicolons or slashes, each
+// optionally preceded by a count such as "2x". It is looked up in catalog,
+// the weapon catalog, and then among the caliber aliases.
+func Demand(weapons []models.WeaponUsage, vehicles []models.VehicleUsage, catalog []models.Weapon, calibers []models.Caliber) models.AmmunitionDemand {
+	d := newDemand(calibers)
+	for _, w := range weapons {
+		d.add(w.Weapon, w.UserCount, 0)
+	}
+
+	byName := make(map[string]models.Weapon)
+	for _, w := range catalog {
+		byName[strings.ToLower(strings.TrimSpace(w.Name))] = w
+	}
+	unknown := make(map[string]bool)
+	for _, v := range vehicles {
+		for _, mount := range splitArmament(v.Armament) {
+			count, name := parseMount(mount)
+			if w, ok := byName[strings.ToLower(name)]; ok {
+				d.add(w, 0, count*v.InstanceCount)
+			} else if c, ok := d.aliases[strings.ToLower(name)]; ok {
+				d.add(models.Weapon{Caliber: c.Name, CaliberID: c.ID}, 0, count*v.InstanceCount)
+			} else {
+				unknown[name] = true
+			}
+		}
+	}
+
+	var result models.AmmunitionDemand
+	for _, c := range d.order {
+		row := d.rows[c]
+		sort.Strings(row.Weapons)
+		result.Calibers = append(result.Calibers, *row)
+	}
+	sort.SliceStable(result.Calibers, func(i, j int) bool {
+		a, b := result.Calibers[i], result.Calibers[j]
+		if a.Total() != b.Total() {
+			return a.Total() > b.Total()
+		}
+		return a.Caliber < b.Caliber
+	})
+	for name := range unknown {
+		result.UnknownArmament = append(result.UnknownArmament, name)
+	}
+	sort.Strings(result.UnknownArmament)
+	return result
+}
+
+// demand collects the rows of a demand summary, keyed by catalog caliber ID
+// or, for calibers missing from the catalog, by the caliber as written
+type demand struct {
+	calibers map[int]models.Caliber
+	aliases  map[string]models.Caliber
+	rows     map[string]*models.CaliberDemand
+	order    []string
+	weapons  map[string]map[string]bool
+}
+
+func newDemand(calibers []models.Caliber) *demand {
+	d := &demand{
+		calibers: make(map[int]models.Caliber),
+		aliases:  make(map[string]models.Caliber),
+		rows:     make(map[string]*models.CaliberDemand),
+		weapons:  make(map[string]map[string]bool),
+	}
+	for _, c := range calibers {
+		d.calibers[c.ID] = c
+		d.aliases[strings.ToLower(c.Name)] = c
+		for _, alias := range c.Aliases {
+			d.aliases[alias] = c
+		}
+	}
+	return d
+}
+
+// add counts carried and mounted weapons of the type w
+func (d *demand) add(w models.Weapon, carried, mounted int) {
+	if carried == 0 && mounted == 0 {
+		return
+	}
+
+	key := "text:" + strings.ToLower(strings.TrimSpace(w.Caliber))
+	if c, ok := d.calibers[w.CaliberID]; ok {
+		key = "id:" + strconv.Itoa(c.ID)
+	}
+	row, ok := d.rows[key]
+	if !ok {
+		row = &models.CaliberDemand{Caliber: strings.TrimSpace(w.Caliber)}
+		if c, ok := d.calibers[w.CaliberID]; ok {
+			row.CaliberID = c.ID
+			row.Caliber = c.Name
+			for _, sub := range c.Substitutes {
+				row.Substitutes = append(row.Substitutes, sub.Name)
+			}
+		}
+		if row.Caliber == "" {
+			row.Caliber = unknownCaliber
+		}
+		d.rows[key] = row
+		d.order = append(d.order, key)
+		d.weapons[key] = make(map[string]bool)
+	}
+
+	row.Carried += carried
+	row.Mounted += mounted
+	if w.Name != "" && !d.weapons[key][w.Name] {
+		d.weapons[key][w.Name] = true
+		row.Weapons = append(row.Weapons, w.Name)
+	}
+}
+
+// splitArmament splits vehicle armament into its mounts, leaving out "None"
+func splitArmament(armament string) []string {
+	var mounts []string
+	for _, mount := range strings.FieldsFunc(armament, func(r rune) bool {
+		return r == ',' || r == ';' || r == '/'
+	}) {
+		mount = strings.TrimSpace(mount)
+		if mount != "" && !strings.EqualFold(mount, "none") {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
+
+// parseMount splits a mount into its count, 1 if not given, and the weapon
+func parseMount(mount string) (int, string) {
+	if m := mountCount.FindStringSubmatch(mount); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			return n, strings.TrimSpace(mount[len(m[0]):])
+		}
+	}
+	return 1, mount
+}
@@ -0,0 +1,48 @@
+package ammo
+
+import (
+	"reflect"
+	"testing"
+
+	"orbat/internal/models"
+)
+
+func TestDemand(t *testing.T) {
+	nato556 := models.Caliber{ID: 1, Name: "5.56x45mm NATO", Aliases: []string{"5.56mm"},
+		Substitutes: []models.Caliber{{ID: 2, Name: ".223 Remington"}}}
+	nato762 := models.Caliber{ID: 3, Name: "7.62x51mm NATO", Aliases: []string{"7.62mm"}}
+	bmg := models.Caliber{ID: 5, Name: "12.7x99mm NATO", Aliases: []string{".50 cal"}}
+	calibers := []models.Caliber{nato556, nato762, bmg}
+
+	m4 := models.Weapon{Name: "M4A1", Caliber: "5.56mm", CaliberID: 1}
+	l85 := models.Weapon{Name: "L85A3", Caliber: "5.56x45mm", CaliberID: 1}
+	m240 := models.Weapon{Name: "M240B", Caliber: "7.62mm", CaliberID: 3}
+	flare := models.Weapon{Name: "Flare Pistol", Caliber: "26.5mm"}
+	catalog := []models.Weapon{m4, l85, m240, flare}
+
+	weapons := []models.WeaponUsage{
+		{Weapon: m4, UserCount: 6},
+		{Weapon: l85, UserCount: 2},
+		{Weapon: m240, UserCount: 1},
+		{Weapon: flare, UserCount: 1},
+	}
+	vehicles := []models.VehicleUsage{
+		{Vehicle: models.Vehicle{Name: "HMMWV", Armament: "M240b / .50 Cal"}, InstanceCount: 2},
+		{Vehicle: models.Vehicle{Name: "LAV-25", Armament: "25mm M242; 2x M240B"}, InstanceCount: 1},
+		{Vehicle: models.Vehicle{Name: "MRZR", Armament: "None"}, InstanceCount: 3},
+	}
+
+	got := Demand(weapons, vehicles, catalog, calibers)
+	want := models.AmmunitionDemand{
+		Calibers: []models.CaliberDemand{
+			{CaliberID: 1, Caliber: "5.56x45mm NATO", Carried: 8, Weapons: []string{"L85A3", "M4A1"}, Substitutes: []string{".223 Remington"}},
+			{CaliberID: 3, Caliber: "7.62x51mm NATO", Carried: 1, Mounted: 4, Weapons: []string{"M240B"}},
+			{CaliberID: 5, Caliber: "12.7x99mm NATO", Mounted: 2},
+			{Caliber: "26.5mm", Carried: 1, Weapons: []string{"Flare Pistol"}},
+		},
+		UnknownArmament: []string{"25mm M242"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Demand() =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import "fmt"
+
+// Roles a user can have, each allowed everything the previous one is
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// Permission is an action that needs a minimum role
+type Permission string
+
+// The permissions checked by the app. Templates refer to them by name.
+const (
+	// View allows browsing groups, equipment and countries
+	View Permission = "view"
+	// EditGroups allows creating, editing and deleting groups and
+	// assigning weapons to their members
+	EditGroups Permission = "edit_groups"
+	// EditCatalog allows adding and changing weapons and vehicles
+	EditCatalog Permission = "edit_catalog"
+	// DeleteCatalog allows deleting weapons and vehicles
+	DeleteCatalog Permission = "delete_catalog"
+	// ManageCountries allows moving groups to another country
+	ManageCountries Permission = "manage_countries"
+	// ViewAudit allows reading the audit log of changes and who made them
+	ViewAudit Permission = "view_audit"
+	// Administer covers any other change
+	Administer Permission = "administer"
+)
+
+var minimumRoles = map[Permission]string{
+	View:            RoleViewer,
+	EditGroups:      RoleEditor,
+	EditCatalog:     RoleEditor,
+	DeleteCatalog:   RoleAdmin,
+	ManageCountries: RoleAdmin,
+	ViewAudit:       RoleEditor,
+	Administer:      RoleAdmin,
+}
+
+// Can reports whether a user with role has permission. Unknown roles and
+// permissions are never allowed.
+func Can(role string, permission Permission) bool {
+	minimum, ok := minimumRoles[permission]
+	if !ok {
+		return false
+	}
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[minimum]
+}
+
+// ValidateRole returns an error unless role is viewer, editor or admin
+func ValidateRole(role string) error {
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("unknown role %q, use viewer, editor or admin", role)
+	}
+	return nil
+}
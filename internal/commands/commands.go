@@ -0,0 +1,334 @@
+// Package commands implements the command-line subcommands of the server
+// binary, which run against the configured database instead of serving HTTP.
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	migrations "orbat/SQL/Migrations"
+	"orbat/internal/auth"
+	"orbat/internal/database"
+	"orbat/internal/document"
+	"orbat/internal/imagegc"
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// Run executes the subcommand named by args[0]
+func Run(store *database.Store, args []string) error {
+	switch args[0] {
+	case "import":
+		return importCommand(store, args[1:])
+	case "export":
+		return exportCommand(store, args[1:])
+	case "migrate":
+		return migrateCommand(store, args[1:])
+	case "user":
+		return userCommand(store, os.Stdin, args[1:])
+	case "images":
+		return imagesCommand(store, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// importCommand creates groups from ORBAT documents. Files ending in .txt
+// are read as outlines and all others as JSON.
+func importCommand(store *database.Store, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	createMissing := flags.Bool("create-missing", false, "add unknown weapons and vehicles to the catalog")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: orbat import [-create-missing] FILE...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no files to import")
+	}
+
+	var groups []models.GroupDetails
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		parse := document.ParseJSON
+		if filepath.Ext(path) == ".txt" {
+			parse = document.ParseText
+		}
+		docs, err := parse(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		for _, doc := range docs {
+			groups = append(groups, doc.GroupDetails())
+		}
+	}
+
+	groupIDs, err := store.ImportGroups(groups, *createMissing, "command line")
+	if err != nil {
+		return err
+	}
+	for i, groupID := range groupIDs {
+		fmt.Printf("Imported group %d: %s\n", groupID, groups[i].Name)
+	}
+	return nil
+}
+
+// exportCommand writes groups as a JSON or outline ORBAT document
+func exportCommand(store *database.Store, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	groupID := flags.String("group", "", "ID of the group to export")
+	country := flags.String("country", "", "export all groups of this country")
+	output := flags.String("o", "", "write the document to this file instead of standard output")
+	format := flags.String("format", "json", "document format, json or text")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: orbat export (-group ID | -country NAME) [-format json|text] [-o FILE]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var docs []document.Group
+	switch {
+	case *groupID != "":
+		details, err := store.GetGroupDetails(*groupID)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, document.FromGroupDetails(details))
+	case *country != "":
+		groups, err := store.GetCountryGroupDetails(*country)
+		if err != nil {
+			return err
+		}
+		for _, details := range groups {
+			docs = append(docs, document.FromGroupDetails(details))
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("either -group or -country is required")
+	}
+
+	var data []byte
+	switch *format {
+	case "json":
+		// A single group is written as an object, a country as an array
+		var doc interface{} = docs
+		if *groupID != "" {
+			doc = docs[0]
+		}
+		encoded, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(encoded, '\n')
+	case "text":
+		var buf bytes.Buffer
+		if err := document.WriteText(&buf, docs); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+
+	if *output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0644)
+}
+
+// migrateCommand applies, rolls back or lists the embedded schema migrations
+func migrateCommand(store *database.Store, args []string) error {
+	usage := fmt.Errorf("usage: orbat migrate up|down|status")
+	if len(args) != 1 {
+		return usage
+	}
+
+	migrator, err := store.Migrator(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("Applied %s\n", m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		m, ok, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("No migrations to roll back")
+			return nil
+		}
+		fmt.Printf("Rolled back %s\n", m.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Applied At\tMigration")
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\n", appliedAt, status.Name)
+		}
+		return w.Flush()
+	default:
+		return usage
+	}
+	return nil
+}
+
+// userCommand creates an account, changes its password or changes its role.
+// Passwords are read from the first line of stdin so they stay out of the
+// shell history.
+func userCommand(store *database.Store, stdin io.Reader, args []string) error {
+	usage := fmt.Errorf("usage: orbat user add [-role viewer|editor|admin] USERNAME | passwd USERNAME | role USERNAME ROLE")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "add":
+		flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+		role := flags.String("role", auth.RoleViewer, "role of the new user: viewer, editor or admin")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return usage
+		}
+		username := strings.TrimSpace(flags.Arg(0))
+		if err := auth.ValidateRole(*role); err != nil {
+			return err
+		}
+		hash, err := readPassword(stdin)
+		if err != nil {
+			return err
+		}
+		if _, err := store.CreateUser(username, hash, *role); err != nil {
+			return err
+		}
+		fmt.Printf("Created %s %s\n", *role, username)
+
+	case "passwd":
+		if len(args) != 2 {
+			return usage
+		}
+		user, err := lookupUser(store, args[1])
+		if err != nil {
+			return err
+		}
+		hash, err := readPassword(stdin)
+		if err != nil {
+			return err
+		}
+		if err := store.SetPassword(user.ID, hash); err != nil {
+			return err
+		}
+		fmt.Printf("Changed the password of %s and ended their sessions\n", user.Username)
+
+	case "role":
+		if len(args) != 3 {
+			return usage
+		}
+		if err := auth.ValidateRole(args[2]); err != nil {
+			return err
+		}
+		user, err := lookupUser(store, args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.SetRole(user.ID, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("%s is now %s\n", user.Username, args[2])
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// imagesCommand reconciles the image store with the database, deleting
+// orphaned objects and clearing broken references unless -dry-run is given
+func imagesCommand(store *database.Store, args []string) error {
+	flags := flag.NewFlagSet("images", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report orphans and broken references without fixing them")
+	minAge := flags.Duration("min-age", imagegc.DefaultMinAge, "leave unreferenced objects younger than this alone")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: orbat images [-dry-run] [-min-age DURATION]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if err := storage.Initialize(); err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	opts := imagegc.Options{DryRun: *dryRun, MinAge: *minAge}
+	report, err := imagegc.Run(context.Background(), store, storage.Current(), opts)
+	if err != nil {
+		return err
+	}
+	report.Write(os.Stdout, !*dryRun)
+	return nil
+}
+
+// readPassword prompts for a password, reads it from the first line of stdin
+// and returns its hash
+func readPassword(stdin io.Reader) (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return auth.HashPassword(strings.TrimRight(line, "\r\n"))
+}
+
+func lookupUser(store *database.Store, username string) (models.User, error) {
+	user, err := store.GetUserByName(strings.TrimSpace(username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, fmt.Errorf("user %s not found", username)
+	}
+	return user, err
+}
@@ -0,0 +1,136 @@
+// Package compare sets groups side by side, aligning their members by role
+// and their weapons and vehicles by caliber, type and name, so that groups of
+// different nationalities can be compared row by row.
+package compare
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// noValue labels weapons without a caliber or type
+const noValue = "(none)"
+
+// Groups compares groups, giving each row one count per group in the order
+// they are passed
+func Groups(groups []models.GroupDetails) models.GroupComparison {
+	var comparison models.GroupComparison
+	summary := newTable(len(groups))
+	roles := newTable(len(groups))
+	calibers := newTable(len(groups))
+	weaponTypes := newTable(len(groups))
+	vehicles := newTable(len(groups))
+
+	for i, g := range groups {
+		id, _ := strconv.Atoi(g.ID)
+		comparison.Groups = append(comparison.Groups, models.Group{
+			ID:          id,
+			Name:        g.Name,
+			Size:        g.Size,
+			Nationality: g.Nationality,
+			ParentID:    g.ParentID,
+		})
+
+		members := allMembers(g)
+		weapons := 0
+		for _, m := range members {
+			roles.add(m.Role, i)
+			for _, w := range m.Weapons {
+				calibers.add(valueOrNone(w.Caliber), i)
+				weaponTypes.add(valueOrNone(w.Type), i)
+				weapons++
+			}
+		}
+		for _, v := range g.Vehicles {
+			vehicles.add(v.Name, i)
+		}
+
+		summary.set("Headcount", i, len(members))
+		summary.set("Teams", i, len(g.Teams))
+		summary.set("Vehicles", i, len(g.Vehicles))
+		summary.set("Weapons", i, weapons)
+	}
+
+	// Roles keep the order they appear in, which puts leaders first; the
+	// other sections are sorted by name
+	comparison.Sections = []models.ComparisonSection{
+		{Title: "Summary", Rows: summary.rows(false)},
+		{Title: "Roles", Rows: roles.rows(false)},
+		{Title: "Calibers", Rows: calibers.rows(true)},
+		{Title: "Weapon types", Rows: weaponTypes.rows(true)},
+		{Title: "Vehicles", Rows: vehicles.rows(true)},
+	}
+	return comparison
+}
+
+// allMembers returns the direct members, team members and crews of a group
+func allMembers(g models.GroupDetails) []models.Member {
+	members := append([]models.Member(nil), g.DirectMembers...)
+	for _, t := range g.Teams {
+		members = append(members, t.Members...)
+	}
+	for _, v := range g.Vehicles {
+		members = append(members, v.Crew...)
+	}
+	return members
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return noValue
+	}
+	return s
+}
+
+// table counts labelled things per group. Labels are matched ignoring case
+// and surrounding space, and keep the spelling they were first seen with.
+type table struct {
+	groups int
+	order  []string
+	labels map[string]string
+	counts map[string][]int
+}
+
+func newTable(groups int) *table {
+	return &table{groups: groups, labels: make(map[string]string), counts: make(map[string][]int)}
+}
+
+func (t *table) row(label string) []int {
+	key := strings.ToLower(strings.TrimSpace(label))
+	if _, ok := t.counts[key]; !ok {
+		t.order = append(t.order, key)
+		t.labels[key] = strings.TrimSpace(label)
+		t.counts[key] = make([]int, t.groups)
+	}
+	return t.counts[key]
+}
+
+func (t *table) add(label string, group int) {
+	t.row(label)[group]++
+}
+
+func (t *table) set(label string, group, n int) {
+	t.row(label)[group] = n
+}
+
+func (t *table) rows(sorted bool) []models.ComparisonRow {
+	keys := append([]string(nil), t.order...)
+	if sorted {
+		sort.Strings(keys)
+	}
+	rows := make([]models.ComparisonRow, 0, len(keys))
+	for _, key := range keys {
+		counts := t.counts[key]
+		row := models.ComparisonRow{Label: t.labels[key], Counts: counts}
+		for _, n := range counts {
+			if n != counts[0] {
+				row.Differs = true
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
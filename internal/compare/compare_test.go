@@ -0,0 +1,81 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"orbat/internal/models"
+)
+
+func section(title string, rows ...models.ComparisonRow) models.ComparisonSection {
+	return models.ComparisonSection{Title: title, Rows: rows}
+}
+
+func row(label string, differs bool, counts ...int) models.ComparisonRow {
+	return models.ComparisonRow{Label: label, Counts: counts, Differs: differs}
+}
+
+func TestGroups(t *testing.T) {
+	m4 := models.Weapon{ID: 1, Name: "M4", Type: "Rifle", Caliber: "5.56mm"}
+	m27 := models.Weapon{ID: 2, Name: "M27 IAR", Type: "Automatic Rifle", Caliber: "5.56mm"}
+	l85 := models.Weapon{ID: 3, Name: "L85A3", Type: "rifle", Caliber: "5.56mm"}
+	gpmg := models.Weapon{ID: 4, Name: "L7A2", Type: "Machine Gun", Caliber: "7.62mm"}
+
+	usmc := models.GroupDetails{
+		ID:            "1",
+		Name:          "Rifle Squad",
+		Nationality:   "United States",
+		DirectMembers: []models.Member{{Role: "Squad Leader", Weapons: []models.Weapon{m4}}},
+		Teams: []models.Team{{Name: "1st Fire Team", Members: []models.Member{
+			{Role: "Automatic Rifleman", Weapons: []models.Weapon{m27}},
+			{Role: "Rifleman", Weapons: []models.Weapon{m4}},
+		}}},
+	}
+	rm := models.GroupDetails{
+		ID:            "2",
+		Name:          "Section",
+		Nationality:   "United Kingdom",
+		DirectMembers: []models.Member{{Role: "Section Commander", Weapons: []models.Weapon{l85}}},
+		Teams: []models.Team{{Name: "Charlie", Members: []models.Member{
+			{Role: "rifleman ", Weapons: []models.Weapon{l85}},
+			{Role: "Gunner", Weapons: []models.Weapon{gpmg}},
+		}}},
+		Vehicles: []models.Vehicle{{Name: "Jackal"}},
+	}
+
+	comparison := Groups([]models.GroupDetails{usmc, rm})
+	if len(comparison.Groups) != 2 || comparison.Groups[1].ID != 2 || comparison.Groups[1].Nationality != "United Kingdom" {
+		t.Errorf("Expected both groups in order, got %+v", comparison.Groups)
+	}
+
+	expected := []models.ComparisonSection{
+		section("Summary",
+			row("Headcount", false, 3, 3),
+			row("Teams", false, 1, 1),
+			row("Vehicles", true, 0, 1),
+			row("Weapons", false, 3, 3),
+		),
+		section("Roles",
+			row("Squad Leader", true, 1, 0),
+			row("Automatic Rifleman", true, 1, 0),
+			row("Rifleman", false, 1, 1),
+			row("Section Commander", true, 0, 1),
+			row("Gunner", true, 0, 1),
+		),
+		section("Calibers",
+			row("5.56mm", true, 3, 2),
+			row("7.62mm", true, 0, 1),
+		),
+		section("Weapon types",
+			row("Automatic Rifle", true, 1, 0),
+			row("Machine Gun", true, 0, 1),
+			row("Rifle", false, 2, 2),
+		),
+		section("Vehicles",
+			row("Jackal", true, 0, 1),
+		),
+	}
+	if !reflect.DeepEqual(comparison.Sections, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, comparison.Sections)
+	}
+}
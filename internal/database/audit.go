@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"orbat/internal/models"
+)
+
+// RecordChange appends an entry to the audit log, timestamped now
+func (s *Store) RecordChange(entry models.AuditEntry) error {
+	return insertAuditEntry(s.db, entry)
+}
+
+func insertAuditEntry(db DbOrTx, entry models.AuditEntry) error {
+	_, err := db.Exec(`
+		INSERT INTO audit_log (changed_at, username, entity_type, entity_id, action, before_json, after_json)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))`,
+		time.Now().Unix(), entry.Username, entry.EntityType, entry.EntityID, entry.Action, entry.Before, entry.After)
+	if err != nil {
+		return fmt.Errorf("failed to record change: %v", err)
+	}
+	return nil
+}
+
+// recordChange adds a change made by username to the audit log, using the
+// transaction that made it so that the change is not saved without its
+// entry. before is the entity before the change, as returned by snapshot,
+// and the entity after it is read from db. Updates and restores that changed
+// nothing are not recorded.
+func recordChange(db DbOrTx, username, entityType, entityID, action string, before interface{}) error {
+	after, err := snapshot(db, entityType, entityID)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Username:   username,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	}
+	if (action == "update" || action == "restore") && entry.Before == entry.After {
+		return nil
+	}
+	return insertAuditEntry(db, entry)
+}
+
+// snapshot returns the state of an entity to record in the audit log, or nil
+// when it does not exist
+func snapshot(db DbOrTx, entityType, id string) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch entityType {
+	case "group":
+		v, err = getGroupDetails(db, id)
+	case "weapon":
+		v, err = getWeapon(db, id)
+	case "vehicle":
+		v, err = getVehicle(db, id)
+	case "caliber":
+		// The weapon count changes with the weapons, not the caliber
+		var calibers []models.Caliber
+		calibers, err = queryCalibers(db, "WHERE c.caliber_id = ?", id)
+		if err == nil && len(calibers) == 0 {
+			err = sql.ErrNoRows
+		}
+		if err == nil {
+			calibers[0].WeaponCount = 0
+			v = calibers[0]
+		}
+	default:
+		return nil, fmt.Errorf("unknown entity type %q", entityType)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s for the audit log: %v", entityType, id, err)
+	}
+	return v, nil
+}
+
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%q", err.Error())
+	}
+	return string(data)
+}
+
+// ListAuditEntries retrieves a page of the audit entries matching filter,
+// newest first, together with the number of matching entries on all pages
+func (s *Store) ListAuditEntries(filter models.AuditFilter, opts models.ListOptions) ([]models.AuditEntry, int, error) {
+	var q listQuery
+	switch {
+	case filter.EntityID != "":
+		q.where("entity_type = ? AND entity_id = ?", filter.EntityType, filter.EntityID)
+	case filter.EntityType != "":
+		q.where("entity_type = ?", filter.EntityType)
+	}
+	if filter.Username != "" {
+		q.where("username = ? COLLATE NOCASE", filter.Username)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT audit_id, changed_at, username, entity_type, entity_id, action,
+			   COALESCE(before_json, ''), COALESCE(after_json, '')
+		FROM audit_log `+q.clause()+` ORDER BY audit_id DESC `+limitClause(opts), q.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var e models.AuditEntry
+		var changedAt int64
+		if err := rows.Scan(&e.ID, &changedAt, &e.Username, &e.EntityType, &e.EntityID, &e.Action, &e.Before, &e.After); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		e.Time = time.Unix(changedAt, 0)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.countRows(opts, len(entries), "audit_log", &q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// caliberIDQuery looks up the catalog caliber a caliber as written is an
+// alias of, taking the written caliber as its parameter
+const caliberIDQuery = `(SELECT caliber_id FROM caliber_aliases WHERE alias = lower(trim(?)))`
+
+// weaponCaliberID returns the catalog caliber to link w to: its CaliberID,
+// which must exist, or when that is 0 the caliber its caliber as written is
+// an alias of, if any
+func weaponCaliberID(db DbOrTx, w models.Weapon) (sql.NullInt64, error) {
+	var id sql.NullInt64
+	if w.CaliberID == 0 {
+		err := db.QueryRow("SELECT "+caliberIDQuery, w.Caliber).Scan(&id)
+		return id, err
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM calibers WHERE caliber_id = ?)", w.CaliberID).Scan(&exists); err != nil {
+		return id, err
+	}
+	if !exists {
+		return id, &ReferenceError{Kind: "caliber", ID: fmt.Sprint(w.CaliberID)}
+	}
+	return sql.NullInt64{Int64: int64(w.CaliberID), Valid: true}, nil
+}
+
+// AliasTakenError is returned when a caliber would be given an alias that
+// already belongs to another caliber
+type AliasTakenError struct {
+	Alias   string
+	Caliber string
+}
+
+func (e *AliasTakenError) Error() string {
+	return fmt.Sprintf("%q is already an alias of %s", e.Alias, e.Caliber)
+}
+
+// GetCalibers retrieves the caliber catalog, ordered by name
+func (s *Store) GetCalibers() ([]models.Caliber, error) {
+	return queryCalibers(s.db, "")
+}
+
+// GetCaliber retrieves a single caliber by ID
+func (s *Store) GetCaliber(caliberID string) (models.Caliber, error) {
+	calibers, err := queryCalibers(s.db, "WHERE c.caliber_id = ?", caliberID)
+	if err != nil {
+		return models.Caliber{}, err
+	}
+	if len(calibers) == 0 {
+		return models.Caliber{}, sql.ErrNoRows
+	}
+	return calibers[0], nil
+}
+
+// queryCalibers retrieves the calibers matching where together with their
+// aliases, substitutes and weapon counts
+func queryCalibers(db DbOrTx, where string, args ...interface{}) ([]models.Caliber, error) {
+	rows, err := db.Query(`
+		SELECT c.caliber_id, c.caliber_name, COUNT(w.weapon_id)
+		FROM calibers c
+		LEFT JOIN weapons w ON w.caliber_id = c.caliber_id
+		`+where+`
+		GROUP BY c.caliber_id
+		ORDER BY c.caliber_name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calibers: %v", err)
+	}
+	defer rows.Close()
+
+	var calibers []models.Caliber
+	index := make(map[int]int)
+	for rows.Next() {
+		var c models.Caliber
+		if err := rows.Scan(&c.ID, &c.Name, &c.WeaponCount); err != nil {
+			return nil, err
+		}
+		index[c.ID] = len(calibers)
+		calibers = append(calibers, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Each caliber's name is also one of its aliases, which is left out
+	aliases, err := db.Query("SELECT caliber_id, alias FROM caliber_aliases ORDER BY alias")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query caliber aliases: %v", err)
+	}
+	defer aliases.Close()
+	for aliases.Next() {
+		var id int
+		var alias string
+		if err := aliases.Scan(&id, &alias); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok && alias != strings.ToLower(calibers[i].Name) {
+			calibers[i].Aliases = append(calibers[i].Aliases, alias)
+		}
+	}
+	if err := aliases.Err(); err != nil {
+		return nil, err
+	}
+
+	substitutes, err := db.Query(`
+		SELECT cs.caliber_id, c.caliber_id, c.caliber_name
+		FROM caliber_substitutes cs
+		JOIN calibers c ON cs.substitute_id = c.caliber_id
+		ORDER BY c.caliber_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query caliber substitutes: %v", err)
+	}
+	defer substitutes.Close()
+	for substitutes.Next() {
+		var id int
+		var sub models.Caliber
+		if err := substitutes.Scan(&id, &sub.ID, &sub.Name); err != nil {
+			return nil, err
+		}
+		if i, ok := index[id]; ok {
+			calibers[i].Substitutes = append(calibers[i].Substitutes, sub)
+		}
+	}
+	return calibers, substitutes.Err()
+}
+
+// CreateCaliber adds a caliber with its aliases and substitutes, links the
+// weapons written with any of its aliases to it and returns its ID. Only the
+// IDs of the substitutes are used.
+func (s *Store) CreateCaliber(c models.Caliber, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := checkAliases(tx, 0, c); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("INSERT INTO calibers (caliber_name) VALUES (?)", c.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create caliber: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := saveCaliberLinks(tx, id, c); err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "caliber", fmt.Sprint(id), "create", nil); err != nil {
+		return 0, err
+	}
+	if err := relinkWeapons(tx, id, caliberAliases(c), nil, username); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateCaliber renames a caliber and replaces its aliases and substitutes,
+// then relinks the weapons to the catalog
+func (s *Store) UpdateCaliber(c models.Caliber, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "caliber", fmt.Sprint(c.ID))
+	if err != nil {
+		return err
+	}
+
+	if err := checkAliases(tx, c.ID, c); err != nil {
+		return err
+	}
+	result, err := tx.Exec("UPDATE calibers SET caliber_name = ? WHERE caliber_id = ?", c.Name, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update caliber: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	oldAliases, err := queryStrings(tx, "SELECT alias FROM caliber_aliases WHERE caliber_id = ?", c.ID)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM caliber_aliases WHERE caliber_id = ?",
+		"DELETE FROM caliber_substitutes WHERE caliber_id = ?",
+	} {
+		if _, err := tx.Exec(query, c.ID); err != nil {
+			return err
+		}
+	}
+	if err := saveCaliberLinks(tx, int64(c.ID), c); err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "caliber", fmt.Sprint(c.ID), "update", before); err != nil {
+		return err
+	}
+	if err := relinkWeapons(tx, int64(c.ID), caliberAliases(c), oldAliases, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCaliber removes a caliber from the catalog. Its weapons keep their
+// caliber as written but are no longer linked to the catalog.
+func (s *Store) DeleteCaliber(caliberID, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "caliber", caliberID)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return sql.ErrNoRows
+	}
+
+	weaponIDs, err := queryStrings(tx, "SELECT weapon_id FROM weapons WHERE caliber_id = ? ORDER BY weapon_id", caliberID)
+	if err != nil {
+		return err
+	}
+	for _, weaponID := range weaponIDs {
+		if err := setWeaponCaliber(tx, weaponID, sql.NullInt64{}, username); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		"DELETE FROM caliber_substitutes WHERE caliber_id = ?",
+		"DELETE FROM caliber_substitutes WHERE substitute_id = ?",
+		"DELETE FROM caliber_aliases WHERE caliber_id = ?",
+		"DELETE FROM calibers WHERE caliber_id = ?",
+	} {
+		if _, err := tx.Exec(query, caliberID); err != nil {
+			return fmt.Errorf("failed to delete caliber: %v", err)
+		}
+	}
+	if err := recordChange(tx, username, "caliber", caliberID, "delete", before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// caliberAliases returns the aliases of a caliber in lower case without
+// duplicates, starting with its name
+func caliberAliases(c models.Caliber) []string {
+	seen := make(map[string]bool)
+	var aliases []string
+	for _, alias := range append([]string{c.Name}, c.Aliases...) {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias != "" && !seen[alias] {
+			seen[alias] = true
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// checkAliases makes sure no other caliber than caliberID already has one of
+// the aliases of c
+func checkAliases(tx *sql.Tx, caliberID int, c models.Caliber) error {
+	for _, alias := range caliberAliases(c) {
+		var owner string
+		err := tx.QueryRow(`
+			SELECT c.caliber_name
+			FROM caliber_aliases a
+			JOIN calibers c ON a.caliber_id = c.caliber_id
+			WHERE a.alias = ? AND a.caliber_id != ?`, alias, caliberID).Scan(&owner)
+		if err == nil {
+			return &AliasTakenError{Alias: alias, Caliber: owner}
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCaliberLinks records the aliases and substitutes of the caliber with
+// the given ID
+func saveCaliberLinks(tx *sql.Tx, id int64, c models.Caliber) error {
+	for _, alias := range caliberAliases(c) {
+		if _, err := tx.Exec("INSERT INTO caliber_aliases (alias, caliber_id) VALUES (?, ?)", alias, id); err != nil {
+			return fmt.Errorf("failed to save alias %q: %v", alias, err)
+		}
+	}
+
+	for _, sub := range c.Substitutes {
+		if int64(sub.ID) == id {
+			continue
+		}
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM calibers WHERE caliber_id = ?)", sub.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return &ReferenceError{Kind: "caliber", ID: fmt.Sprint(sub.ID)}
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO caliber_substitutes (caliber_id, substitute_id) VALUES (?, ?)", id, sub.ID); err != nil {
+			return fmt.Errorf("failed to save substitute: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// relinkWeapons links the weapons whose caliber as written is one of
+// aliases to the caliber with the given ID, and unlinks the weapons that were
+// linked to it through one of oldAliases, which it no longer has, recording
+// each change for username. Other weapons linked to it were linked directly
+// and are left alone.
+func relinkWeapons(tx *sql.Tx, id int64, aliases, oldAliases []string, username string) error {
+	current := make(map[string]bool)
+	var args []interface{}
+	for _, alias := range aliases {
+		current[alias] = true
+		args = append(args, alias)
+	}
+	for _, alias := range oldAliases {
+		args = append(args, alias)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT weapon_id, lower(trim(weapon_caliber)), caliber_id
+		FROM weapons
+		WHERE lower(trim(weapon_caliber)) IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+		ORDER BY weapon_id`,
+		args...)
+	if err != nil {
+		return fmt.Errorf("failed to find the weapons of caliber %d: %v", id, err)
+	}
+	type link struct {
+		weaponID  string
+		caliberID sql.NullInt64
+	}
+	var changed []link
+	for rows.Next() {
+		var weaponID, alias string
+		var caliberID sql.NullInt64
+		if err := rows.Scan(&weaponID, &alias, &caliberID); err != nil {
+			rows.Close()
+			return err
+		}
+		linked := caliberID.Valid && caliberID.Int64 == id
+		switch {
+		case current[alias] && !linked:
+			changed = append(changed, link{weaponID, sql.NullInt64{Int64: id, Valid: true}})
+		case !current[alias] && linked:
+			// Aliases are unique, so no other caliber has the old alias
+			changed = append(changed, link{weaponID: weaponID})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range changed {
+		if err := setWeaponCaliber(tx, l.weaponID, l.caliberID, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setWeaponCaliber links a weapon to a catalog caliber, or unlinks it when
+// caliberID is null, and records the change for username
+func setWeaponCaliber(tx *sql.Tx, weaponID string, caliberID sql.NullInt64, username string) error {
+	before, err := snapshot(tx, "weapon", weaponID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE weapons SET caliber_id = ? WHERE weapon_id = ?", caliberID, weaponID); err != nil {
+		return fmt.Errorf("failed to link weapon %s to its caliber: %v", weaponID, err)
+	}
+	return recordChange(tx, username, "weapon", weaponID, "update", before)
+}
+
+// queryStrings returns the first column of the rows of a query
+func queryStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
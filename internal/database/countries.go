@@ -8,8 +8,8 @@ import (
 )
 
 // GetCountries retrieves all countries from the database
-func GetCountries() ([]string, error) {
-	rows, err := DB.Query(`
+func (s *Store) GetCountries() ([]string, error) {
+	rows, err := s.db.Query(`
 		SELECT DISTINCT group_nationality 
 		FROM groups 
 		ORDER BY group_nationality`)
@@ -24,19 +24,13 @@ func GetCountries() ([]string, error) {
 		if err := rows.Scan(&countryCode); err != nil {
 			return nil, err
 		}
-		// Convert country code to standardized name
-		country := countries.ByName(countryCode)
-		if country != countries.Unknown {
-			countryList = append(countryList, country.Info().Name)
-		} else {
-			countryList = append(countryList, countryCode) // Fallback to code
-		}
+		countryList = append(countryList, countryName(countryCode))
 	}
 	return countryList, nil
 }
 
 // GetCountryDetails retrieves detailed information about a country
-func GetCountryDetails(countryName string) (models.CountryDetails, error) {
+func (s *Store) GetCountryDetails(countryName string) (models.CountryDetails, error) {
 	// URL decode the country name to handle spaces
 	decodedName, err := url.QueryUnescape(countryName)
 	if err != nil {
@@ -50,11 +44,11 @@ func GetCountryDetails(countryName string) (models.CountryDetails, error) {
 	}
 
 	var details models.CountryDetails
-	details.Name = country.Info().Name
+	details.Name = country.String()
 	countryCode := country.Info().Alpha2
 
 	// Update queries to use country code
-	groups, err := DB.Query(`
+	groups, err := s.db.Query(`
 		SELECT group_id, group_name, group_nationality, group_size 
 		FROM groups 
 		WHERE group_nationality = ?
@@ -70,23 +64,25 @@ func GetCountryDetails(countryName string) (models.CountryDetails, error) {
 		if err := groups.Scan(&g.ID, &g.Name, &gCountryCode, &g.Size); err != nil {
 			return details, err
 		}
-		// Convert country code to name for display
-		gCountry := countries.ByName(gCountryCode)
-		if gCountry != countries.Unknown {
-			g.Nationality = gCountry.Info().Name
-		} else {
-			g.Nationality = gCountryCode
-		}
+		// The groups are all of this country
+		g.Nationality = details.Name
 		details.Groups = append(details.Groups, g)
 	}
 
+	// Get the top-level formations with their subordinate groups
+	details.Formations, err = s.getCountryFormations(countryCode)
+	if err != nil {
+		return details, err
+	}
+
 	// Get weapons used by this country's groups
-	weapons, err := DB.Query(`
+	weapons, err := s.db.Query(`
 		SELECT 
 			w.weapon_id,
 			w.weapon_name,
 			w.weapon_type,
 			w.weapon_caliber,
+			COALESCE(w.caliber_id, 0),
 			w.image_url,
 			COUNT(DISTINCT m.member_id) as user_count
 		FROM weapons w
@@ -124,14 +120,14 @@ func GetCountryDetails(countryName string) (models.CountryDetails, error) {
 
 	for weapons.Next() {
 		var w models.WeaponUsage
-		if err := weapons.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber, &w.ImageURL, &w.UserCount); err != nil {
+		if err := weapons.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber, &w.CaliberID, &w.ImageURL, &w.UserCount); err != nil {
 			return details, err
 		}
 		details.Weapons = append(details.Weapons, w)
 	}
 
 	// Get vehicles used by this country's groups
-	vehicles, err := DB.Query(`
+	vehicles, err := s.db.Query(`
 		SELECT 
 			v.vehicle_id,
 			v.vehicle_name,
@@ -161,10 +157,87 @@ func GetCountryDetails(countryName string) (models.CountryDetails, error) {
 	return details, nil
 }
 
+// GetCountryGroupDetails retrieves the full details of every group of a
+// country, ordered by name, with a fixed number of queries
+func (s *Store) GetCountryGroupDetails(countryName string) ([]models.GroupDetails, error) {
+	country := countries.ByName(countryName)
+	if country == countries.Unknown {
+		return nil, fmt.Errorf("invalid country name: %s", countryName)
+	}
+
+	groups, err := queryGroupDetails(s.db, "group_nationality = ?", country.Info().Alpha2)
+	if groups == nil && err == nil {
+		groups = []models.GroupDetails{}
+	}
+	return groups, err
+}
+
+// RenameCountry moves all groups of a country to another country code,
+// recording the country and each group moved
+func (s *Store) RenameCountry(countryCode, newCode, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if newCode == countryCode {
+		return tx.Commit()
+	}
+
+	// Each group moved is recorded as well, so its own history shows the move
+	rows, err := tx.Query("SELECT group_id FROM groups WHERE group_nationality = ? ORDER BY group_id", countryCode)
+	if err != nil {
+		return fmt.Errorf("failed to find the groups of %s: %v", countryCode, err)
+	}
+	var groupIDs []string
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			rows.Close()
+			return err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	befores := make([]interface{}, len(groupIDs))
+	for i, groupID := range groupIDs {
+		if befores[i], err = snapshot(tx, "group", groupID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE groups SET group_nationality = ? WHERE group_nationality = ?",
+		newCode, countryCode)
+	if err != nil {
+		return fmt.Errorf("failed to rename country: %v", err)
+	}
+	for i, groupID := range groupIDs {
+		if err := recordChange(tx, username, "group", groupID, "update", befores[i]); err != nil {
+			return err
+		}
+	}
+	err = insertAuditEntry(tx, models.AuditEntry{
+		Username:   username,
+		EntityType: "country",
+		EntityID:   countryCode,
+		Action:     "update",
+		Before:     auditJSON(map[string]string{"Code": countryCode}),
+		After:      auditJSON(map[string]string{"Code": newCode}),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // StandardizeCountryCodes updates all existing country names to their standardized Alpha2 codes
-func StandardizeCountryCodes() error {
+func (s *Store) StandardizeCountryCodes() error {
 	// First, get all unique nationalities
-	rows, err := DB.Query(`
+	rows, err := s.db.Query(`
 		SELECT DISTINCT group_nationality 
 		FROM groups`)
 	if err != nil {
@@ -183,7 +256,7 @@ func StandardizeCountryCodes() error {
 		country := countries.ByName(nationality)
 		if country != countries.Unknown && country.Info().Alpha2 != nationality {
 			// Update all groups with this nationality to use the standard code
-			_, err = DB.Exec(`
+			_, err = s.db.Exec(`
 				UPDATE groups 
 				SET group_nationality = ? 
 				WHERE group_nationality = ?`,
@@ -196,4 +269,24 @@ func StandardizeCountryCodes() error {
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// CountryCode converts a country name or code to its standardized Alpha2 code
+func CountryCode(name string) (string, error) {
+	country := countries.ByName(name)
+	if country == countries.Unknown {
+		return "", fmt.Errorf("invalid country name: %s", name)
+	}
+	return country.Info().Alpha2, nil
+}
+
+// countryName returns the name of the country with a stored country code,
+// or the code itself when it is not a known country
+func countryName(code string) string {
+	// String avoids building the full country info, which is costly for a
+	// single lookup
+	if country := countries.ByName(code); country != countries.Unknown {
+		return country.String()
+	}
+	return code
+}
@@ -3,28 +3,36 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"os"
 	"time"
 
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 )
 
-// DB is the global database connection
-var DB *sql.DB
+// Store is the libsql implementation of the repositories
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore creates a store using an open database connection
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
 
-// Initialize sets up the database connection
-func Initialize() error {
+// Open connects to the libsql database at url, retrying while it is unavailable
+func Open(url string) (*Store, error) {
+	var db *sql.DB
 	var err error
 	maxRetries := 5
 	
 	for i := 0; i < maxRetries; i++ {
-		DB, err = sql.Open("libsql", os.Getenv("DATABASE_URL"))
+		db, err = sql.Open("libsql", url)
 		if err == nil {
 			// Test the connection
-			if err = DB.Ping(); err == nil {
+			if err = db.Ping(); err == nil {
 				fmt.Printf("Successfully connected to database\n")
-				return nil
+				return NewStore(db), nil
 			}
+			db.Close()
 		}
 		fmt.Printf("Attempt %d: Failed to connect to database: %v\n", i+1, err)
 		if i < maxRetries-1 {
@@ -32,12 +40,15 @@ func Initialize() error {
 		}
 	}
 	
-	return fmt.Errorf("could not establish database connection after %d attempts: %v", maxRetries, err)
+	return nil, fmt.Errorf("could not establish database connection after %d attempts: %v", maxRetries, err)
+}
+
+// Ping checks that the database is reachable
+func (s *Store) Ping() error {
+	return s.db.Ping()
 }
 
 // Close closes the database connection
-func Close() {
-	if DB != nil {
-		DB.Close()
-	}
-} 
\ No newline at end of file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -8,6 +8,8 @@ import (
     "orbat/internal/models"
 )
 
+var store *Store
+
 func TestMain(m *testing.M) {
     // Load test environment variables
     if err := godotenv.Load("../../.env.test"); err != nil {
@@ -15,7 +17,9 @@ func TestMain(m *testing.M) {
     }
 
     // Initialize database connection
-    if err := Initialize(); err != nil {
+    var err error
+    store, err = Open(os.Getenv("DATABASE_URL"))
+    if err != nil {
         panic("Could not initialize test database: " + err.Error())
     }
 
@@ -23,12 +27,12 @@ func TestMain(m *testing.M) {
     code := m.Run()
 
     // Cleanup
-    Close()
+    store.Close()
     os.Exit(code)
 }
 
 func TestWeaponOperations(t *testing.T) {
-    weapons, err := GetWeapons()
+    weapons, err := store.GetWeapons()
     if err != nil {
         t.Fatalf("Failed to get weapons: %v", err)
     }
@@ -56,7 +60,7 @@ func TestWeaponOperations(t *testing.T) {
 }
 
 func TestGroupOperations(t *testing.T) {
-    groups, err := GetGroups()
+    groups, err := store.GetGroups()
     if err != nil {
         t.Fatalf("Failed to get groups: %v", err)
     }
@@ -78,7 +82,7 @@ func TestGroupOperations(t *testing.T) {
 }
 
 func TestCountryOperations(t *testing.T) {
-    countries, err := GetCountries()
+    countries, err := store.GetCountries()
     if err != nil {
         t.Fatalf("Failed to get countries: %v", err)
     }
@@ -99,7 +103,7 @@ func TestCountryOperations(t *testing.T) {
     }
 
     // Test country details
-    details, err := GetCountryDetails("Test Nation") // Changed: Match the actual value
+    details, err := store.GetCountryDetails("Test Nation") // Changed: Match the actual value
     if err != nil {
         t.Fatalf("Failed to get country details: %v", err)
     }
@@ -110,7 +114,7 @@ func TestCountryOperations(t *testing.T) {
 }
 
 func TestVehicleUsage(t *testing.T) {
-    details, err := GetCountryDetails("Test Nation") // Changed: Match the actual value
+    details, err := store.GetCountryDetails("Test Nation") // Changed: Match the actual value
     if err != nil {
         t.Fatalf("Failed to get country details: %v", err)
     }
@@ -144,7 +148,7 @@ func TestVehicleUsage(t *testing.T) {
 }
 
 func TestWeaponUsage(t *testing.T) {
-    details, err := GetCountryDetails("Test Nation") // Changed: Match the actual value
+    details, err := store.GetCountryDetails("Test Nation") // Changed: Match the actual value
     if err != nil {
         t.Fatalf("Failed to get country details: %v", err)
     }
@@ -187,7 +191,7 @@ func TestCreateAndDeleteWeapon(t *testing.T) {
     }
 
     // Insert the weapon directly using SQL
-    _, err := DB.Exec(`
+    _, err := store.db.Exec(`
         INSERT INTO weapons (weapon_id, weapon_name, weapon_type, weapon_caliber)
         VALUES (?, ?, ?, ?)`,
         newWeapon.ID, newWeapon.Name, newWeapon.Type, newWeapon.Caliber)
@@ -196,7 +200,7 @@ func TestCreateAndDeleteWeapon(t *testing.T) {
     }
 
     // Verify the weapon was created
-    weapons, err := GetWeapons()
+    weapons, err := store.GetWeapons()
     if err != nil {
         t.Fatalf("Failed to get weapons: %v", err)
     }
@@ -216,13 +220,13 @@ func TestCreateAndDeleteWeapon(t *testing.T) {
     }
 
     // Cleanup
-    err = DeleteWeapon(fmt.Sprintf("%d", newWeapon.ID))
+    err = store.DeleteWeapon(fmt.Sprintf("%d", newWeapon.ID), "tester")
     if err != nil {
         t.Fatalf("Failed to cleanup test weapon: %v", err)
     }
 
     // Verify deletion
-    weapons, err = GetWeapons()
+    weapons, err = store.GetWeapons()
     if err != nil {
         t.Fatalf("Failed to get weapons after deletion: %v", err)
     }
@@ -241,7 +245,7 @@ func TestCreateAndDeleteGroup(t *testing.T) {
     nationality := "Test Nation"
     
     // Insert the group directly using SQL
-    result, err := DB.Exec(`
+    result, err := store.db.Exec(`
         INSERT INTO groups (group_name, group_nationality, group_size)
         VALUES (?, ?, 0)`,
         groupName, nationality)
@@ -255,7 +259,7 @@ func TestCreateAndDeleteGroup(t *testing.T) {
     }
 
     // Verify the group was created
-    groups, err := GetGroups()
+    groups, err := store.GetGroups()
     if err != nil {
         t.Fatalf("Failed to get groups: %v", err)
     }
@@ -275,13 +279,13 @@ func TestCreateAndDeleteGroup(t *testing.T) {
     }
 
     // Cleanup
-    err = DeleteGroup(DB, fmt.Sprintf("%d", groupID))
+    err = store.DeleteGroup(fmt.Sprintf("%d", groupID), "tester")
     if err != nil {
         t.Fatalf("Failed to cleanup test group: %v", err)
     }
 
     // Verify deletion
-    groups, err = GetGroups()
+    groups, err = store.GetGroups()
     if err != nil {
         t.Fatalf("Failed to get groups after deletion: %v", err)
     }
@@ -304,7 +308,7 @@ func TestUpdateWeapon(t *testing.T) {
     }
 
     // Insert the weapon directly using SQL
-    _, err := DB.Exec(`
+    _, err := store.db.Exec(`
         INSERT INTO weapons (weapon_id, weapon_name, weapon_type, weapon_caliber)
         VALUES (?, ?, ?, ?)`,
         initialWeapon.ID, initialWeapon.Name, initialWeapon.Type, initialWeapon.Caliber)
@@ -315,7 +319,7 @@ func TestUpdateWeapon(t *testing.T) {
     // Update the weapon directly using SQL
     updatedName := "Updated Weapon"
     updatedType := "Updated Type"
-    _, err = DB.Exec(`
+    _, err = store.db.Exec(`
         UPDATE weapons 
         SET weapon_name = ?, weapon_type = ?
         WHERE weapon_id = ?`,
@@ -325,7 +329,7 @@ func TestUpdateWeapon(t *testing.T) {
     }
 
     // Verify the update
-    weapons, err := GetWeapons()
+    weapons, err := store.GetWeapons()
     if err != nil {
         t.Fatalf("Failed to get weapons: %v", err)
     }
@@ -348,13 +352,13 @@ func TestUpdateWeapon(t *testing.T) {
     }
 
     // Cleanup
-    err = DeleteWeapon(fmt.Sprintf("%d", initialWeapon.ID))
+    err = store.DeleteWeapon(fmt.Sprintf("%d", initialWeapon.ID), "tester")
     if err != nil {
         t.Fatalf("Failed to cleanup test weapon: %v", err)
     }
 
     // Verify deletion
-    weapons, err = GetWeapons()
+    weapons, err = store.GetWeapons()
     if err != nil {
         t.Fatalf("Failed to get weapons after deletion: %v", err)
     }
@@ -373,7 +377,7 @@ func TestCreateGroupWithTeam(t *testing.T) {
     teamName := "Test Team"
     nationality := "Test Nation"
     
-    tx, err := DB.Begin()
+    tx, err := store.db.Begin()
     if err != nil {
         t.Fatalf("Failed to begin transaction: %v", err)
     }
@@ -421,7 +425,7 @@ func TestCreateGroupWithTeam(t *testing.T) {
     }
 
     // Verify the group and team were created correctly
-    details, err := GetGroupDetails(fmt.Sprintf("%d", groupID))
+    details, err := store.GetGroupDetails(fmt.Sprintf("%d", groupID))
     if err != nil {
         t.Fatalf("Failed to get group details: %v", err)
     }
@@ -437,13 +441,13 @@ func TestCreateGroupWithTeam(t *testing.T) {
     }
 
     // Cleanup
-    err = DeleteGroup(DB, fmt.Sprintf("%d", groupID))
+    err = store.DeleteGroup(fmt.Sprintf("%d", groupID), "tester")
     if err != nil {
         t.Fatalf("Failed to cleanup test group: %v", err)
     }
 
     // Verify deletion
-    details, err = GetGroupDetails(fmt.Sprintf("%d", groupID))
+    details, err = store.GetGroupDetails(fmt.Sprintf("%d", groupID))
     if err == nil {
         t.Error("Expected error when getting deleted group details, got nil")
     }
@@ -455,7 +459,7 @@ func TestCreateGroupWithVehicle(t *testing.T) {
     nationality := "Test Nation"
     vehicleName := "Test Vehicle"
     
-    tx, err := DB.Begin()
+    tx, err := store.db.Begin()
     if err != nil {
         t.Fatalf("Failed to begin transaction: %v", err)
     }
@@ -530,7 +534,7 @@ func TestCreateGroupWithVehicle(t *testing.T) {
     }
 
     // Verify the group and vehicle were created correctly
-    details, err := GetGroupDetails(fmt.Sprintf("%d", groupID))
+    details, err := store.GetGroupDetails(fmt.Sprintf("%d", groupID))
     if err != nil {
         t.Fatalf("Failed to get group details: %v", err)
     }
@@ -552,13 +556,13 @@ func TestCreateGroupWithVehicle(t *testing.T) {
     }
 
     // Cleanup
-    err = DeleteGroup(DB, fmt.Sprintf("%d", groupID))
+    err = store.DeleteGroup(fmt.Sprintf("%d", groupID), "tester")
     if err != nil {
         t.Fatalf("Failed to cleanup test group: %v", err)
     }
 
     // Verify deletion
-    details, err = GetGroupDetails(fmt.Sprintf("%d", groupID))
+    details, err = store.GetGroupDetails(fmt.Sprintf("%d", groupID))
     if err == nil {
         t.Error("Expected error when getting deleted group details, got nil")
     }
@@ -5,21 +5,52 @@ import (
 	"fmt"
 
 	"orbat/internal/models"
-	"github.com/biter777/countries"
 )
 
 // GetGroups retrieves all groups from the database
-func GetGroups() ([]models.Group, error) {
-	rows, err := DB.Query(`
+func (s *Store) GetGroups() ([]models.Group, error) {
+	groups, _, err := s.ListGroups(models.GroupFilter{}, models.ListOptions{})
+	return groups, err
+}
+
+// groupSortColumns maps the fields groups can be sorted by to their columns
+var groupSortColumns = map[string]string{
+	"name":        "g.group_name",
+	"size":        "g.group_size",
+	"nationality": "g.group_nationality",
+}
+
+// ListGroups retrieves a page of the groups matching filter, together with
+// the number of matching groups on all pages
+func (s *Store) ListGroups(filter models.GroupFilter, opts models.ListOptions) ([]models.Group, int, error) {
+	var q listQuery
+	if filter.Nationality != "" {
+		q.where("g.group_nationality = ?", filter.Nationality)
+	}
+	if filter.MinSize > 0 {
+		q.where("g.group_size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		q.where("g.group_size <= ?", filter.MaxSize)
+	}
+	order, err := orderBy(opts, groupSortColumns, "name", "g.group_id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
 		SELECT 
 			g.group_id,
 			g.group_name,
 			g.group_nationality,
-			g.group_size
+			g.group_size,
+			g.parent_group_id
 		FROM groups g
-		ORDER BY g.group_name`)
+		`+q.clause()+`
+		`+order+`
+		`+limitClause(opts), q.args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -27,216 +58,260 @@ func GetGroups() ([]models.Group, error) {
 	for rows.Next() {
 		var g models.Group
 		var countryCode string
-		if err := rows.Scan(&g.ID, &g.Name, &countryCode, &g.Size); err != nil {
-			return nil, err
-		}
-		// Convert country code to name
-		country := countries.ByName(countryCode)
-		if country != countries.Unknown {
-			g.Nationality = country.Info().Name
-		} else {
-			g.Nationality = countryCode // Fallback to code if conversion fails
+		var parentID sql.NullInt64
+		if err := rows.Scan(&g.ID, &g.Name, &countryCode, &g.Size, &parentID); err != nil {
+			return nil, 0, err
 		}
+		g.ParentID = int(parentID.Int64)
+		g.Nationality = countryName(countryCode)
 		groups = append(groups, g)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return groups, nil
+	total, err := s.countRows(opts, len(groups), "groups g", &q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
 }
 
-// GetGroupDetails retrieves detailed information about a group
-func GetGroupDetails(groupID string) (models.GroupDetails, error) {
-	var group models.GroupDetails
-	var countryCode string
-	
-	// Get basic group info
-	err := DB.QueryRow(`
-		SELECT g.group_id, g.group_name, g.group_size, g.group_nationality 
-		FROM groups g 
-		WHERE g.group_id = ?`, groupID).Scan(&group.ID, &group.Name, &group.Size, &countryCode)
+// GetGroup retrieves a group without its members, teams and vehicles
+func (s *Store) GetGroup(groupID string) (models.Group, error) {
+	rows, err := s.db.Query(`
+		SELECT group_id, group_name, group_nationality, group_size, parent_group_id
+		FROM groups WHERE group_id = ?`, groupID)
 	if err != nil {
-		return group, fmt.Errorf("failed to get group details: %v", err)
+		return models.Group{}, fmt.Errorf("failed to get group: %v", err)
 	}
+	defer rows.Close()
 
-	// Convert country code to name
-	country := countries.ByName(countryCode)
-	if country != countries.Unknown {
-		group.Nationality = country.Info().Name
-	} else {
-		group.Nationality = countryCode // Fallback to code if conversion fails
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return models.Group{}, err
+		}
+		return models.Group{}, sql.ErrNoRows
 	}
+	return scanTreeGroup(rows)
+}
 
-	// Get direct members (excluding team members and vehicle crew)
-	memberRows, err := DB.Query(`
-		SELECT DISTINCT m.member_id, m.member_role, m.member_rank
-		FROM members m
-		JOIN group_members gm ON m.member_id = gm.member_id
-		WHERE gm.group_id = ? AND gm.team_id IS NULL`, groupID)
+// GetGroupDetails retrieves detailed information about a group
+func (s *Store) GetGroupDetails(groupID string) (models.GroupDetails, error) {
+	return getGroupDetails(s.db, groupID)
+}
+
+// getGroupDetails loads a group using either the database or a transaction
+func getGroupDetails(db DbOrTx, groupID string) (models.GroupDetails, error) {
+	groups, err := queryGroupDetails(db, "group_id = ?", groupID)
 	if err != nil {
-		return group, fmt.Errorf("failed to get direct members: %v", err)
+		return models.GroupDetails{}, err
+	}
+	if len(groups) == 0 {
+		return models.GroupDetails{}, fmt.Errorf("failed to get group details: %w", sql.ErrNoRows)
 	}
-	defer memberRows.Close()
+	return groups[0], nil
+}
 
-	for memberRows.Next() {
-		var m models.Member
-		err := memberRows.Scan(&m.ID, &m.Role, &m.Rank)
-		if err != nil {
-			return group, fmt.Errorf("failed to scan member: %v", err)
-		}
+// queryGroupDetails loads the groups matching where, a condition on the
+// groups table taking args, ordered by name. The members, teams, vehicles,
+// crews and weapons of all of them are each read with a single query and
+// assembled in memory, so the number of queries grows with neither the number
+// nor the size of the groups.
+func queryGroupDetails(db DbOrTx, where string, args ...interface{}) ([]models.GroupDetails, error) {
+	selected := "SELECT group_id FROM groups WHERE " + where
 
-		// Get member's weapons
-		weaponRows, err := DB.Query(`
-			SELECT w.weapon_id, w.weapon_name, w.weapon_type, w.weapon_caliber
-			FROM weapons w
-			JOIN members_weapons mw ON w.weapon_id = mw.weapon_id
-			WHERE mw.member_id = ?`, m.ID)
-		if err != nil {
-			return group, fmt.Errorf("failed to get member weapons: %v", err)
+	rows, err := db.Query(`
+		SELECT group_id, group_name, group_size, group_nationality, parent_group_id
+		FROM groups
+		WHERE `+where+`
+		ORDER BY group_name, group_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group details: %v", err)
+	}
+	var groups []models.GroupDetails
+	index := make(map[int]int)
+	for rows.Next() {
+		var group models.GroupDetails
+		var id int
+		var countryCode string
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &group.Name, &group.Size, &countryCode, &parentID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan group: %v", err)
 		}
-		defer weaponRows.Close()
+		group.ID = fmt.Sprint(id)
+		group.ParentID = int(parentID.Int64)
+		group.Nationality = countryName(countryCode)
+		index[id] = len(groups)
+		groups = append(groups, group)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
 
-		for weaponRows.Next() {
-			var w models.Weapon
-			err := weaponRows.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber)
-			if err != nil {
-				return group, fmt.Errorf("failed to scan weapon: %v", err)
-			}
-			m.Weapons = append(m.Weapons, w)
-		}
+	// Get the weapons of everyone in the groups, including team members and crews
+	weapons, err := getGroupWeapons(db, selected, args)
+	if err != nil {
+		return nil, err
+	}
 
-		group.DirectMembers = append(group.DirectMembers, m)
+	// Get direct members (excluding team members and vehicle crew)
+	directMembers, err := queryGroupMembers(db, weapons, `
+		SELECT DISTINCT gm.group_id, m.member_id, m.member_role, m.member_rank
+		FROM members m
+		JOIN group_members gm ON m.member_id = gm.member_id
+		WHERE gm.group_id IN (`+selected+`) AND gm.team_id IS NULL
+		ORDER BY m.member_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get direct members: %v", err)
+	}
+	for id, i := range index {
+		groups[i].DirectMembers = directMembers[id]
 	}
 
 	// Get teams and their members
-	teamRows, err := DB.Query(`
-		SELECT DISTINCT t.team_id, t.team_name, t.team_size
+	teamMembers, err := queryGroupMembers(db, weapons, `
+		SELECT DISTINCT tm.team_id, m.member_id, m.member_role, m.member_rank
+		FROM members m
+		JOIN team_members tm ON m.member_id = tm.member_id
+		WHERE tm.team_id IN (SELECT team_id FROM group_members WHERE group_id IN (`+selected+`))
+		ORDER BY tm.team_id, m.member_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team members: %v", err)
+	}
+
+	teamRows, err := db.Query(`
+		SELECT DISTINCT gm.group_id, t.team_id, t.team_name, t.team_size
 		FROM teams t
 		JOIN group_members gm ON t.team_id = gm.team_id
-		WHERE gm.group_id = ?`, groupID)
+		WHERE gm.group_id IN (`+selected+`)
+		ORDER BY t.team_id`, args...)
 	if err != nil {
-		return group, fmt.Errorf("failed to get teams: %v", err)
+		return nil, fmt.Errorf("failed to get teams: %v", err)
 	}
 	defer teamRows.Close()
 
 	for teamRows.Next() {
+		var groupID int
 		var team models.Team
-		err := teamRows.Scan(&team.ID, &team.Name, &team.Size)
-		if err != nil {
-			return group, fmt.Errorf("failed to scan team: %v", err)
-		}
-
-		// Get team members
-		teamMemberRows, err := DB.Query(`
-			SELECT m.member_id, m.member_role, m.member_rank
-			FROM members m
-			JOIN team_members tm ON m.member_id = tm.member_id
-			WHERE tm.team_id = ?`, team.ID)
+		err := teamRows.Scan(&groupID, &team.ID, &team.Name, &team.Size)
 		if err != nil {
-			return group, fmt.Errorf("failed to get team members: %v", err)
-		}
-		defer teamMemberRows.Close()
-
-		for teamMemberRows.Next() {
-			var m models.Member
-			err := teamMemberRows.Scan(&m.ID, &m.Role, &m.Rank)
-			if err != nil {
-				return group, fmt.Errorf("failed to scan team member: %v", err)
-			}
-
-			// Get member's weapons
-			weaponRows, err := DB.Query(`
-				SELECT w.weapon_id, w.weapon_name, w.weapon_type, w.weapon_caliber
-				FROM weapons w
-				JOIN members_weapons mw ON w.weapon_id = mw.weapon_id
-				WHERE mw.member_id = ?`, m.ID)
-			if err != nil {
-				return group, fmt.Errorf("failed to get team member weapons: %v", err)
-			}
-			defer weaponRows.Close()
-
-			for weaponRows.Next() {
-				var w models.Weapon
-				err := weaponRows.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber)
-				if err != nil {
-					return group, fmt.Errorf("failed to scan weapon: %v", err)
-				}
-				m.Weapons = append(m.Weapons, w)
-			}
-
-			team.Members = append(team.Members, m)
+			return nil, fmt.Errorf("failed to scan team: %v", err)
 		}
-
-		group.Teams = append(group.Teams, team)
+		team.Members = teamMembers[team.ID]
+		i := index[groupID]
+		groups[i].Teams = append(groups[i].Teams, team)
+	}
+	if err := teamRows.Err(); err != nil {
+		return nil, err
 	}
 
 	// Get vehicles and their crew
-	vehicleRows, err := DB.Query(`
-		SELECT DISTINCT v.vehicle_id, v.vehicle_name, v.vehicle_type, v.vehicle_armament, v.image_url,
+	crews, err := queryGroupMembers(db, weapons, `
+		SELECT DISTINCT vm.instance_id, m.member_id, m.member_role, m.member_rank
+		FROM members m
+		JOIN vehicle_members vm ON m.member_id = vm.member_id
+		WHERE vm.instance_id IN (SELECT instance_id FROM group_vehicles WHERE group_id IN (`+selected+`))
+		ORDER BY vm.instance_id, m.member_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vehicle crew: %v", err)
+	}
+
+	vehicleRows, err := db.Query(`
+		SELECT DISTINCT gv.group_id, v.vehicle_id, v.vehicle_name, v.vehicle_type, v.vehicle_armament, v.image_url,
 			   gv.instance_id
 		FROM vehicles v
 		JOIN group_vehicles gv ON v.vehicle_id = gv.vehicle_id
-		WHERE gv.group_id = ?`, groupID)
+		WHERE gv.group_id IN (`+selected+`)
+		ORDER BY gv.instance_id`, args...)
 	if err != nil {
-		return group, fmt.Errorf("failed to get vehicles: %v", err)
+		return nil, fmt.Errorf("failed to get vehicles: %v", err)
 	}
 	defer vehicleRows.Close()
 
 	for vehicleRows.Next() {
+		var groupID int
 		var vehicle models.Vehicle
-		var instanceID string
-		err := vehicleRows.Scan(&vehicle.ID, &vehicle.Name, &vehicle.Type, &vehicle.Armament, &vehicle.ImageURL, &instanceID)
-		if err != nil {
-			return group, fmt.Errorf("failed to scan vehicle: %v", err)
-		}
-
-		// Get vehicle crew members for this specific vehicle instance
-		crewRows, err := DB.Query(`
-			SELECT DISTINCT m.member_id, m.member_role, m.member_rank
-			FROM members m
-			JOIN vehicle_members vm ON m.member_id = vm.member_id
-			WHERE vm.instance_id = ?`, instanceID)
+		err := vehicleRows.Scan(&groupID, &vehicle.ID, &vehicle.Name, &vehicle.Type, &vehicle.Armament, &vehicle.ImageURL, &vehicle.InstanceID)
 		if err != nil {
-			return group, fmt.Errorf("failed to get vehicle crew: %v", err)
+			return nil, fmt.Errorf("failed to scan vehicle: %v", err)
 		}
-		defer crewRows.Close()
-
-		for crewRows.Next() {
-			var m models.Member
-			err := crewRows.Scan(&m.ID, &m.Role, &m.Rank)
-			if err != nil {
-				return group, fmt.Errorf("failed to scan crew member: %v", err)
-			}
+		vehicle.Crew = crews[vehicle.InstanceID]
+		i := index[groupID]
+		groups[i].Vehicles = append(groups[i].Vehicles, vehicle)
+	}
 
-			// Get crew member's weapons
-			weaponRows, err := DB.Query(`
-				SELECT w.weapon_id, w.weapon_name, w.weapon_type, w.weapon_caliber
-				FROM weapons w
-				JOIN members_weapons mw ON w.weapon_id = mw.weapon_id
-				WHERE mw.member_id = ?`, m.ID)
-			if err != nil {
-				return group, fmt.Errorf("failed to get crew weapons: %v", err)
-			}
-			defer weaponRows.Close()
+	return groups, vehicleRows.Err()
+}
 
-			for weaponRows.Next() {
-				var w models.Weapon
-				err := weaponRows.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber)
-				if err != nil {
-					return group, fmt.Errorf("failed to scan weapon: %v", err)
-				}
-				m.Weapons = append(m.Weapons, w)
-			}
+// getGroupWeapons returns the weapons of every member of the groups selected
+// by a query taking args, by member ID, with their specs and image URLs
+func getGroupWeapons(db DbOrTx, selected string, args []interface{}) (map[int][]models.Weapon, error) {
+	var queryArgs []interface{}
+	for i := 0; i < 3; i++ {
+		queryArgs = append(queryArgs, args...)
+	}
+	rows, err := db.Query(`
+		SELECT mw.member_id, w.*
+		FROM members_weapons mw
+		JOIN (SELECT `+weaponColumns+` FROM weapons) w ON w.weapon_id = mw.weapon_id
+		WHERE mw.member_id IN (
+			SELECT member_id FROM group_members
+			WHERE group_id IN (`+selected+`) AND member_id IS NOT NULL
+			UNION
+			SELECT tm.member_id FROM team_members tm
+			JOIN group_members gm ON tm.team_id = gm.team_id
+			WHERE gm.group_id IN (`+selected+`)
+			UNION
+			SELECT vm.member_id FROM vehicle_members vm
+			JOIN group_vehicles gv ON vm.instance_id = gv.instance_id
+			WHERE gv.group_id IN (`+selected+`)
+		)
+		ORDER BY mw.member_id, w.weapon_id`, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member weapons: %v", err)
+	}
+	defer rows.Close()
 
-			vehicle.Crew = append(vehicle.Crew, m)
+	weapons := make(map[int][]models.Weapon)
+	for rows.Next() {
+		var memberID int
+		var w models.Weapon
+		if err := rows.Scan(append([]interface{}{&memberID}, weaponFields(&w)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan weapon: %v", err)
 		}
+		weapons[memberID] = append(weapons[memberID], w)
+	}
+	return weapons, rows.Err()
+}
 
-		group.Vehicles = append(group.Vehicles, vehicle)
+// queryGroupMembers runs a query selecting an owner ID (a team or vehicle
+// instance, or 0) followed by member columns, and groups the members by owner
+// with their weapons filled in
+func queryGroupMembers(db DbOrTx, weapons map[int][]models.Weapon, query string, args ...interface{}) (map[int][]models.Member, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return group, nil
+	members := make(map[int][]models.Member)
+	for rows.Next() {
+		var owner int
+		var m models.Member
+		if err := rows.Scan(&owner, &m.ID, &m.Role, &m.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %v", err)
+		}
+		m.Weapons = weapons[m.ID]
+		members[owner] = append(members[owner], m)
+	}
+	return members, rows.Err()
 }
 
 // DbOrTx is an interface that can be satisfied by either *sql.DB or *sql.Tx
@@ -247,7 +322,52 @@ type DbOrTx interface {
 }
 
 // DeleteGroup deletes a group and all its associated data
-func DeleteGroup(db DbOrTx, groupID string) error {
+func (s *Store) DeleteGroup(groupID, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "group", groupID)
+	if err != nil {
+		return err
+	}
+	if err := deleteGroup(tx, groupID); err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "group", groupID, "delete", before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteGroup(db DbOrTx, groupID string) error {
+	if err := deleteGroupContents(db, groupID); err != nil {
+		return err
+	}
+
+	// Move subordinate groups up to the deleted group's parent
+	_, err := db.Exec(`
+		UPDATE groups
+		SET parent_group_id = (SELECT parent_group_id FROM groups WHERE group_id = ?)
+		WHERE parent_group_id = ?`, groupID, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to move subordinate groups: %v", err)
+	}
+
+	// Finally delete the group
+	_, err = db.Exec("DELETE FROM groups WHERE group_id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %v", err)
+	}
+
+	return nil
+}
+
+// deleteGroupContents deletes the members, teams and vehicle instances of a
+// group while leaving the group row itself in place
+func deleteGroupContents(db DbOrTx, groupID string) error {
 	// 1. Get all member IDs (direct, team, and vehicle members)
 	memberIDs := make(map[string]bool)
 
@@ -345,13 +465,25 @@ func DeleteGroup(db DbOrTx, groupID string) error {
 		return fmt.Errorf("failed to delete team members: %v", err)
 	}
 
-	// 6. Delete group member associations
+	// 6. Delete teams (before group_members, which is how they are found)
+	_, err = db.Exec(`
+		DELETE FROM teams 
+		WHERE team_id IN (
+			SELECT DISTINCT team_id 
+			FROM group_members 
+			WHERE group_id = ? AND team_id IS NOT NULL
+		)`, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete teams: %v", err)
+	}
+
+	// 7. Delete group member associations
 	_, err = db.Exec("DELETE FROM group_members WHERE group_id = ?", groupID)
 	if err != nil {
 		return fmt.Errorf("failed to delete group members: %v", err)
 	}
 
-	// 7. Delete members
+	// 8. Delete members
 	for memberID := range memberIDs {
 		_, err = db.Exec("DELETE FROM members WHERE member_id = ?", memberID)
 		if err != nil {
@@ -359,23 +491,581 @@ func DeleteGroup(db DbOrTx, groupID string) error {
 		}
 	}
 
-	// 8. Delete teams
+	return nil
+}
+
+// ReferenceError reports a weapon, vehicle or parent group referenced by a
+// group that does not exist
+type ReferenceError struct {
+	Kind string
+	ID   string
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("%s %s does not exist", e.Kind, e.ID)
+}
+
+// GroupExists checks if a group with the given ID exists
+func (s *Store) GroupExists(groupID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE group_id = ?)", groupID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// CreateGroup inserts a group together with its direct members, teams and
+// vehicle crews and returns the new group ID. The group nationality must
+// already be a country code.
+func (s *Store) CreateGroup(group models.GroupDetails, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	groupID, err := createGroup(tx, group)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "group", fmt.Sprint(groupID), "create", nil); err != nil {
+		return 0, err
+	}
+	return groupID, tx.Commit()
+}
+
+func createGroup(db DbOrTx, group models.GroupDetails) (int64, error) {
+	if err := validateGroupReferences(db, group); err != nil {
+		return 0, err
+	}
+
+	// group_id is AUTOINCREMENT, so the ID of a deleted group is not reused
+	// and its history stays its own
+	result, err := db.Exec(`
+		INSERT INTO groups (group_name, group_nationality, group_size)
+		VALUES (?, ?, 0)`, group.Name, group.Nationality)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert group: %v", err)
+	}
+
+	groupID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if group.ParentID != 0 {
+		if err := setGroupParent(db, groupID, group.ParentID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := insertGroupContents(db, groupID, group); err != nil {
+		return 0, err
+	}
+
+	return groupID, nil
+}
+
+// DuplicateGroup copies a group with its members, teams, vehicle instances,
+// crews and weapon assignments into a new group under the same parent, and
+// returns the new group ID. The copy keeps the nationality of the original
+// when nationality is empty; otherwise it may be a country name or code.
+func (s *Store) DuplicateGroup(groupID, name, nationality, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	group, err := getGroupDetails(tx, groupID)
+	if err != nil {
+		return 0, err
+	}
+	if nationality == "" {
+		nationality = group.Nationality
+	}
+	code, err := CountryCode(nationality)
+	if err != nil {
+		return 0, &ReferenceError{Kind: "country", ID: nationality}
+	}
+	group.Name = name
+	group.Nationality = code
+
+	// The members, teams and vehicle instances are inserted as new rows, so
+	// the copy shares nothing with the original
+	newID, err := createGroup(tx, group)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "group", fmt.Sprint(newID), "create", nil); err != nil {
+		return 0, err
+	}
+	return newID, tx.Commit()
+}
+
+// memberLocation identifies where a member sits within a group: directly
+// under the group, in a team, or in the crew of a vehicle instance
+type memberLocation struct {
+	teamID     int64
+	instanceID int64
+}
+
+// UpdateGroup applies an edited group structure to an existing group. Members,
+// teams and vehicle instances are matched to the stored ones by ID: matches are
+// updated in place, entries without a known ID are inserted, and stored entries
+// missing from group are deleted. The group size is recomputed.
+func (s *Store) UpdateGroup(groupID string, group models.GroupDetails, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "group", groupID)
+	if err != nil {
+		return err
+	}
+	if err := updateGroup(tx, groupID, group); err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "group", groupID, "update", before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateGroup(db DbOrTx, groupID string, group models.GroupDetails) error {
+	if err := validateGroupReferences(db, group); err != nil {
+		return err
+	}
+
+	current, err := getGroupDetails(db, groupID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE groups 
+		SET group_name = ?, group_nationality = ?
+		WHERE group_id = ?`, group.Name, group.Nationality, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to update group: %v", err)
+	}
+
+	if err := setGroupParent(db, groupID, group.ParentID); err != nil {
+		return err
+	}
+
+	// Index the stored structure
+	currentMembers := make(map[int]models.Member)
+	currentLocations := make(map[int]memberLocation)
+	currentTeams := make(map[int]models.Team)
+	currentInstances := make(map[int]models.Vehicle)
+	for _, m := range current.DirectMembers {
+		currentMembers[m.ID] = m
+		currentLocations[m.ID] = memberLocation{}
+	}
+	for _, team := range current.Teams {
+		currentTeams[team.ID] = team
+		for _, m := range team.Members {
+			currentMembers[m.ID] = m
+			currentLocations[m.ID] = memberLocation{teamID: int64(team.ID)}
+		}
+	}
+	for _, vehicle := range current.Vehicles {
+		currentInstances[vehicle.InstanceID] = vehicle
+		for _, m := range vehicle.Crew {
+			currentMembers[m.ID] = m
+			currentLocations[m.ID] = memberLocation{instanceID: int64(vehicle.InstanceID)}
+		}
+	}
+
+	// Update or insert teams
+	keptTeams := make(map[int]bool)
+	teamIDs := make([]int64, len(group.Teams))
+	for i, team := range group.Teams {
+		existing, ok := currentTeams[team.ID]
+		if ok && !keptTeams[team.ID] {
+			if existing.Name != team.Name || existing.Size != len(team.Members) {
+				_, err := db.Exec("UPDATE teams SET team_name = ?, team_size = ? WHERE team_id = ?",
+					team.Name, len(team.Members), team.ID)
+				if err != nil {
+					return fmt.Errorf("failed to update team: %v", err)
+				}
+			}
+			keptTeams[team.ID] = true
+			teamIDs[i] = int64(team.ID)
+			continue
+		}
+
+		teamID, err := insertTeam(db, groupID, team.Name, len(team.Members))
+		if err != nil {
+			return err
+		}
+		teamIDs[i] = teamID
+	}
+
+	// Update or insert vehicle instances
+	keptInstances := make(map[int]bool)
+	instanceIDs := make([]int64, len(group.Vehicles))
+	for i, vehicle := range group.Vehicles {
+		existing, ok := currentInstances[vehicle.InstanceID]
+		if ok && !keptInstances[vehicle.InstanceID] {
+			if existing.ID != vehicle.ID {
+				_, err := db.Exec("UPDATE group_vehicles SET vehicle_id = ? WHERE instance_id = ?",
+					vehicle.ID, vehicle.InstanceID)
+				if err != nil {
+					return fmt.Errorf("failed to update vehicle instance: %v", err)
+				}
+			}
+			keptInstances[vehicle.InstanceID] = true
+			instanceIDs[i] = int64(vehicle.InstanceID)
+			continue
+		}
+
+		instanceID, err := insertVehicleInstance(db, groupID, vehicle.ID)
+		if err != nil {
+			return err
+		}
+		instanceIDs[i] = instanceID
+	}
+
+	// Update, move or insert members
+	keptMembers := make(map[int]bool)
+	totalMembers := 0
+	syncMember := func(m models.Member, location memberLocation) error {
+		totalMembers++
+		existing, ok := currentMembers[m.ID]
+		if !ok || keptMembers[m.ID] {
+			memberID, err := insertMember(db, m)
+			if err != nil {
+				return err
+			}
+			return addMemberLocation(db, groupID, memberID, location)
+		}
+		keptMembers[m.ID] = true
+
+		if existing.Role != m.Role || existing.Rank != m.Rank {
+			_, err := db.Exec("UPDATE members SET member_role = ?, member_rank = ? WHERE member_id = ?",
+				m.Role, m.Rank, m.ID)
+			if err != nil {
+				return fmt.Errorf("failed to update member: %v", err)
+			}
+		}
+
+		if currentLocations[m.ID] != location {
+			if err := removeMemberLocation(db, groupID, int64(m.ID), currentLocations[m.ID]); err != nil {
+				return err
+			}
+			if err := addMemberLocation(db, groupID, int64(m.ID), location); err != nil {
+				return err
+			}
+		}
+
+		return syncMemberWeapons(db, m.ID, existing.Weapons, m.Weapons)
+	}
+
+	for _, m := range group.DirectMembers {
+		if err := syncMember(m, memberLocation{}); err != nil {
+			return err
+		}
+	}
+	for i, team := range group.Teams {
+		for _, m := range team.Members {
+			if err := syncMember(m, memberLocation{teamID: teamIDs[i]}); err != nil {
+				return err
+			}
+		}
+	}
+	for i, vehicle := range group.Vehicles {
+		for _, m := range vehicle.Crew {
+			if err := syncMember(m, memberLocation{instanceID: instanceIDs[i]}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Delete members that were removed
+	for memberID := range currentMembers {
+		if keptMembers[memberID] {
+			continue
+		}
+		if err := removeMemberLocation(db, groupID, int64(memberID), currentLocations[memberID]); err != nil {
+			return err
+		}
+		if _, err := db.Exec("DELETE FROM members_weapons WHERE member_id = ?", memberID); err != nil {
+			return fmt.Errorf("failed to delete weapon associations: %v", err)
+		}
+		if _, err := db.Exec("DELETE FROM members WHERE member_id = ?", memberID); err != nil {
+			return fmt.Errorf("failed to delete member: %v", err)
+		}
+	}
+
+	// Delete teams that were removed
+	for teamID := range currentTeams {
+		if keptTeams[teamID] {
+			continue
+		}
+		if _, err := db.Exec("DELETE FROM group_members WHERE group_id = ? AND team_id = ?", groupID, teamID); err != nil {
+			return fmt.Errorf("failed to remove team from group: %v", err)
+		}
+		if _, err := db.Exec("DELETE FROM teams WHERE team_id = ?", teamID); err != nil {
+			return fmt.Errorf("failed to delete team: %v", err)
+		}
+	}
+
+	// Delete vehicle instances that were removed
+	for instanceID := range currentInstances {
+		if keptInstances[instanceID] {
+			continue
+		}
+		if _, err := db.Exec("DELETE FROM group_vehicles WHERE instance_id = ?", instanceID); err != nil {
+			return fmt.Errorf("failed to delete vehicle instance: %v", err)
+		}
+	}
+
+	// Update group size
+	_, err = db.Exec("UPDATE groups SET group_size = ? WHERE group_id = ?", totalMembers, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to update group size: %v", err)
+	}
+
+	return nil
+}
+
+// insertTeam inserts a team and attaches it to a group
+func insertTeam(db DbOrTx, groupID interface{}, name string, size int) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO teams (team_name, team_size)
+		VALUES (?, ?)`, name, size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert team: %v", err)
+	}
+
+	teamID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
 	_, err = db.Exec(`
-		DELETE FROM teams 
-		WHERE team_id IN (
-			SELECT DISTINCT team_id 
-			FROM group_members 
-			WHERE group_id = ? AND team_id IS NOT NULL
-		)`, groupID)
+		INSERT INTO group_members (group_id, member_id, team_id)
+		VALUES (?, NULL, ?)`, groupID, teamID)
 	if err != nil {
-		return fmt.Errorf("failed to delete teams: %v", err)
+		return 0, fmt.Errorf("failed to add team to group: %v", err)
 	}
 
-	// 9. Finally delete the group
-	_, err = db.Exec("DELETE FROM groups WHERE group_id = ?", groupID)
+	return teamID, nil
+}
+
+// insertVehicleInstance adds a copy of a vehicle to a group and returns its instance ID
+func insertVehicleInstance(db DbOrTx, groupID interface{}, vehicleID string) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO group_vehicles (group_id, vehicle_id)
+		VALUES (?, ?)`, groupID, vehicleID)
 	if err != nil {
-		return fmt.Errorf("failed to delete group: %v", err)
+		return 0, fmt.Errorf("failed to insert vehicle instance: %v", err)
+	}
+	return result.LastInsertId()
+}
+
+// addMemberLocation attaches a member to the group, a team or a vehicle crew
+func addMemberLocation(db DbOrTx, groupID interface{}, memberID int64, location memberLocation) error {
+	var err error
+	switch {
+	case location.teamID != 0:
+		_, err = db.Exec("INSERT INTO team_members (team_id, member_id) VALUES (?, ?)",
+			location.teamID, memberID)
+	case location.instanceID != 0:
+		_, err = db.Exec("INSERT INTO vehicle_members (instance_id, member_id) VALUES (?, ?)",
+			location.instanceID, memberID)
+	default:
+		_, err = db.Exec("INSERT INTO group_members (group_id, member_id, team_id) VALUES (?, ?, NULL)",
+			groupID, memberID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add member to group: %v", err)
+	}
+	return nil
+}
+
+// removeMemberLocation detaches a member from the group, a team or a vehicle crew
+func removeMemberLocation(db DbOrTx, groupID interface{}, memberID int64, location memberLocation) error {
+	var err error
+	switch {
+	case location.teamID != 0:
+		_, err = db.Exec("DELETE FROM team_members WHERE team_id = ? AND member_id = ?",
+			location.teamID, memberID)
+	case location.instanceID != 0:
+		_, err = db.Exec("DELETE FROM vehicle_members WHERE instance_id = ? AND member_id = ?",
+			location.instanceID, memberID)
+	default:
+		_, err = db.Exec("DELETE FROM group_members WHERE group_id = ? AND member_id = ?",
+			groupID, memberID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove member from group: %v", err)
+	}
+	return nil
+}
+
+// syncMemberWeapons adds and removes weapon assignments so that a member
+// carries exactly the wanted weapons
+func syncMemberWeapons(db DbOrTx, memberID int, current, wanted []models.Weapon) error {
+	have := make(map[int]bool)
+	for _, w := range current {
+		have[w.ID] = true
+	}
+	want := make(map[int]bool)
+	for _, w := range wanted {
+		want[w.ID] = true
+	}
+
+	for weaponID := range have {
+		if want[weaponID] {
+			continue
+		}
+		_, err := db.Exec("DELETE FROM members_weapons WHERE member_id = ? AND weapon_id = ?", memberID, weaponID)
+		if err != nil {
+			return fmt.Errorf("failed to remove weapon from member: %v", err)
+		}
+	}
+	for weaponID := range want {
+		if have[weaponID] {
+			continue
+		}
+		_, err := db.Exec("INSERT INTO members_weapons (member_id, weapon_id) VALUES (?, ?)", memberID, weaponID)
+		if err != nil {
+			return fmt.Errorf("failed to assign weapon to member: %v", err)
+		}
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// insertGroupContents inserts the members, teams and vehicles of a new group
+// and updates the stored group size
+func insertGroupContents(db DbOrTx, groupID int64, group models.GroupDetails) error {
+	totalMembers := 0
+	insertMembers := func(members []models.Member, location memberLocation) error {
+		for _, m := range members {
+			memberID, err := insertMember(db, m)
+			if err != nil {
+				return err
+			}
+			if err := addMemberLocation(db, groupID, memberID, location); err != nil {
+				return err
+			}
+			totalMembers++
+		}
+		return nil
+	}
+
+	// Handle direct members
+	if err := insertMembers(group.DirectMembers, memberLocation{}); err != nil {
+		return err
+	}
+
+	// Handle teams
+	for _, team := range group.Teams {
+		teamID, err := insertTeam(db, groupID, team.Name, len(team.Members))
+		if err != nil {
+			return err
+		}
+		if err := insertMembers(team.Members, memberLocation{teamID: teamID}); err != nil {
+			return err
+		}
+	}
+
+	// Handle vehicles
+	for _, vehicle := range group.Vehicles {
+		instanceID, err := insertVehicleInstance(db, groupID, vehicle.ID)
+		if err != nil {
+			return err
+		}
+		if err := insertMembers(vehicle.Crew, memberLocation{instanceID: instanceID}); err != nil {
+			return err
+		}
+	}
+
+	// Update group size
+	_, err := db.Exec("UPDATE groups SET group_size = ? WHERE group_id = ?", totalMembers, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to update group size: %v", err)
+	}
+
+	return nil
+}
+
+// insertMember inserts a member and its weapon assignments and returns the new member ID
+func insertMember(db DbOrTx, m models.Member) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO members (member_role, member_rank)
+		VALUES (?, ?)`, m.Role, m.Rank)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert member: %v", err)
+	}
+
+	memberID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := syncMemberWeapons(db, int(memberID), nil, m.Weapons); err != nil {
+		return 0, err
+	}
+
+	return memberID, nil
+}
+
+// validateGroupReferences checks that every weapon and vehicle used by a group exists
+func validateGroupReferences(db DbOrTx, group models.GroupDetails) error {
+	checkedWeapons := make(map[int]bool)
+	checkWeapons := func(m models.Member) error {
+		for _, w := range m.Weapons {
+			if checkedWeapons[w.ID] {
+				continue
+			}
+			var exists bool
+			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM weapons WHERE weapon_id = ?)", w.ID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return &ReferenceError{Kind: "weapon", ID: fmt.Sprint(w.ID)}
+			}
+			checkedWeapons[w.ID] = true
+		}
+		return nil
+	}
+
+	for _, m := range group.DirectMembers {
+		if err := checkWeapons(m); err != nil {
+			return err
+		}
+	}
+	for _, team := range group.Teams {
+		for _, m := range team.Members {
+			if err := checkWeapons(m); err != nil {
+				return err
+			}
+		}
+	}
+	for _, vehicle := range group.Vehicles {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE vehicle_id = ?)", vehicle.ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return &ReferenceError{Kind: "vehicle", ID: vehicle.ID}
+		}
+		for _, m := range vehicle.Crew {
+			if err := checkWeapons(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"orbat/internal/models"
+)
+
+// ErrGroupCycle is returned when a group would become subordinate to itself
+var ErrGroupCycle = errors.New("a group cannot be subordinate to itself or to one of its subordinate groups")
+
+// subtreeCTE selects the IDs of a group and all its subordinate groups, with
+// their depth below the group. It takes the group ID as its only parameter.
+// The depth limit guards against cycles in data written outside this package.
+const subtreeCTE = `
+	WITH RECURSIVE subtree(group_id, depth) AS (
+		SELECT group_id, 0 FROM groups WHERE group_id = ?
+		UNION ALL
+		SELECT g.group_id, s.depth + 1
+		FROM groups g
+		JOIN subtree s ON g.parent_group_id = s.group_id
+		WHERE s.depth < 32
+	)`
+
+// setGroupParent places a group under parentID, or at the top level when
+// parentID is 0
+func setGroupParent(db DbOrTx, groupID interface{}, parentID int) error {
+	if parentID == 0 {
+		_, err := db.Exec("UPDATE groups SET parent_group_id = NULL WHERE group_id = ?", groupID)
+		return err
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE group_id = ?)", parentID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return &ReferenceError{Kind: "group", ID: fmt.Sprint(parentID)}
+	}
+
+	// The new parent must not be the group itself or one of its subordinates
+	var cycle bool
+	err := db.QueryRow(subtreeCTE+`
+		SELECT EXISTS(SELECT 1 FROM subtree WHERE group_id = ?)`, groupID, parentID).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check group hierarchy: %v", err)
+	}
+	if cycle {
+		return ErrGroupCycle
+	}
+
+	_, err = db.Exec("UPDATE groups SET parent_group_id = ? WHERE group_id = ?", parentID, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to set parent group: %v", err)
+	}
+	return nil
+}
+
+// GetGroupTree retrieves a group with all its subordinate groups
+func (s *Store) GetGroupTree(groupID string) (models.GroupNode, error) {
+	rows, err := s.db.Query(subtreeCTE+`
+		SELECT g.group_id, g.group_name, g.group_nationality, g.group_size, g.parent_group_id
+		FROM groups g
+		JOIN subtree s ON g.group_id = s.group_id
+		ORDER BY s.depth, g.group_name`, groupID)
+	if err != nil {
+		return models.GroupNode{}, fmt.Errorf("failed to get group tree: %v", err)
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		g, err := scanTreeGroup(rows)
+		if err != nil {
+			return models.GroupNode{}, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return models.GroupNode{}, err
+	}
+	if len(groups) == 0 {
+		return models.GroupNode{}, fmt.Errorf("failed to get group tree: %w", sql.ErrNoRows)
+	}
+
+	return buildGroupTree(groups[0], groups[1:]), nil
+}
+
+// scanTreeGroup scans a group row selected with its parent ID, followed by
+// any extra columns into extra
+func scanTreeGroup(rows *sql.Rows, extra ...interface{}) (models.Group, error) {
+	var g models.Group
+	var countryCode string
+	var parentID sql.NullInt64
+	dest := append([]interface{}{&g.ID, &g.Name, &countryCode, &g.Size, &parentID}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return g, fmt.Errorf("failed to scan group: %v", err)
+	}
+	g.ParentID = int(parentID.Int64)
+	g.Nationality = countryName(countryCode)
+	return g, nil
+}
+
+// buildGroupTree arranges the subordinate groups of root into a tree
+func buildGroupTree(root models.Group, subordinates []models.Group) models.GroupNode {
+	return buildGroupTrees([]models.Group{root}, subordinates)[0]
+}
+
+// buildGroupTrees arranges subordinate groups into a tree under each root
+func buildGroupTrees(roots, subordinates []models.Group) []models.GroupNode {
+	children := make(map[int][]models.Group)
+	for _, g := range subordinates {
+		children[g.ParentID] = append(children[g.ParentID], g)
+	}
+
+	var build func(g models.Group) models.GroupNode
+	build = func(g models.Group) models.GroupNode {
+		node := models.GroupNode{Group: g}
+		for _, child := range children[g.ID] {
+			node.Subgroups = append(node.Subgroups, build(child))
+		}
+		return node
+	}
+
+	var trees []models.GroupNode
+	for _, root := range roots {
+		trees = append(trees, build(root))
+	}
+	return trees
+}
+
+// GetGroupAncestors retrieves the groups above a group, starting with the
+// top-level group and ending with its direct parent
+func (s *Store) GetGroupAncestors(groupID string) ([]models.Group, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE ancestors(group_id, depth) AS (
+			SELECT parent_group_id, 1 FROM groups
+			WHERE group_id = ? AND parent_group_id IS NOT NULL
+			UNION ALL
+			SELECT g.parent_group_id, a.depth + 1
+			FROM groups g
+			JOIN ancestors a ON g.group_id = a.group_id
+			WHERE g.parent_group_id IS NOT NULL AND a.depth < 32
+		)
+		SELECT g.group_id, g.group_name, g.group_nationality, g.group_size, g.parent_group_id
+		FROM groups g
+		JOIN ancestors a ON g.group_id = a.group_id
+		ORDER BY a.depth DESC`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent groups: %v", err)
+	}
+	defer rows.Close()
+
+	var ancestors []models.Group
+	for rows.Next() {
+		g, err := scanTreeGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, g)
+	}
+	return ancestors, rows.Err()
+}
+
+// GetParentCandidates retrieves the groups that groupID can be placed under,
+// which are all groups except the group itself and its subordinates. An empty
+// groupID returns all groups.
+func (s *Store) GetParentCandidates(groupID string) ([]models.Group, error) {
+	groups, err := s.GetGroups()
+	if err != nil || groupID == "" {
+		return groups, err
+	}
+
+	rows, err := s.db.Query(subtreeCTE+`SELECT group_id FROM subtree`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subordinate groups: %v", err)
+	}
+	defer rows.Close()
+
+	excluded := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		excluded[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var candidates []models.Group
+	for _, g := range groups {
+		if !excluded[g.ID] {
+			candidates = append(candidates, g)
+		}
+	}
+	return candidates, nil
+}
+
+// GetGroupRollup totals the strength, weapons and vehicles of a group and all
+// its subordinate groups
+func (s *Store) GetGroupRollup(groupID string) (models.GroupRollup, error) {
+	var rollup models.GroupRollup
+
+	err := s.db.QueryRow(subtreeCTE+`
+		SELECT COALESCE(SUM(g.group_size), 0), COUNT(*) - 1
+		FROM groups g
+		JOIN subtree s ON g.group_id = s.group_id`, groupID).Scan(&rollup.Strength, &rollup.GroupCount)
+	if err != nil {
+		return rollup, fmt.Errorf("failed to total group strength: %v", err)
+	}
+
+	weapons, err := s.db.Query(subtreeCTE+`
+		SELECT
+			w.weapon_id,
+			w.weapon_name,
+			w.weapon_type,
+			w.weapon_caliber,
+			COALESCE(w.caliber_id, 0),
+			w.image_url,
+			COUNT(DISTINCT mw.member_id) as user_count
+		FROM weapons w
+		JOIN members_weapons mw ON w.weapon_id = mw.weapon_id
+		JOIN (
+			-- Direct group members
+			SELECT gm.member_id
+			FROM group_members gm
+			JOIN subtree s ON gm.group_id = s.group_id
+			WHERE gm.team_id IS NULL
+			UNION ALL
+			-- Team members
+			SELECT tm.member_id
+			FROM team_members tm
+			JOIN group_members gm ON tm.team_id = gm.team_id
+			JOIN subtree s ON gm.group_id = s.group_id
+			UNION ALL
+			-- Vehicle crew members
+			SELECT vm.member_id
+			FROM vehicle_members vm
+			JOIN group_vehicles gv ON vm.instance_id = gv.instance_id
+			JOIN subtree s ON gv.group_id = s.group_id
+		) membership ON mw.member_id = membership.member_id
+		GROUP BY w.weapon_id
+		ORDER BY user_count DESC, w.weapon_name`, groupID)
+	if err != nil {
+		return rollup, fmt.Errorf("failed to total weapons: %v", err)
+	}
+	defer weapons.Close()
+
+	for weapons.Next() {
+		var w models.WeaponUsage
+		if err := weapons.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber, &w.CaliberID, &w.ImageURL, &w.UserCount); err != nil {
+			return rollup, err
+		}
+		rollup.Weapons = append(rollup.Weapons, w)
+	}
+	if err := weapons.Err(); err != nil {
+		return rollup, err
+	}
+
+	vehicles, err := s.db.Query(subtreeCTE+`
+		SELECT
+			v.vehicle_id,
+			v.vehicle_name,
+			v.vehicle_type,
+			v.vehicle_armament,
+			v.image_url,
+			COUNT(gv.instance_id) as instance_count
+		FROM vehicles v
+		JOIN group_vehicles gv ON v.vehicle_id = gv.vehicle_id
+		JOIN subtree s ON gv.group_id = s.group_id
+		GROUP BY v.vehicle_id
+		ORDER BY instance_count DESC, v.vehicle_name`, groupID)
+	if err != nil {
+		return rollup, fmt.Errorf("failed to total vehicles: %v", err)
+	}
+	defer vehicles.Close()
+
+	for vehicles.Next() {
+		var v models.VehicleUsage
+		if err := vehicles.Scan(&v.ID, &v.Name, &v.Type, &v.Armament, &v.ImageURL, &v.InstanceCount); err != nil {
+			return rollup, err
+		}
+		rollup.Vehicles = append(rollup.Vehicles, v)
+	}
+
+	return rollup, vehicles.Err()
+}
+
+// getCountryFormations retrieves the top-level formations of a country with
+// their subordinate groups. A group is top-level for its country when it has
+// no parent or its parent belongs to another country. All the trees are read
+// with one query.
+func (s *Store) getCountryFormations(countryCode string) ([]models.GroupNode, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE formations(group_id, depth) AS (
+			SELECT g.group_id, 0
+			FROM groups g
+			LEFT JOIN groups p ON g.parent_group_id = p.group_id
+			WHERE g.group_nationality = ?
+			  AND (p.group_id IS NULL OR p.group_nationality != g.group_nationality)
+			UNION ALL
+			SELECT g.group_id, f.depth + 1
+			FROM groups g
+			JOIN formations f ON g.parent_group_id = f.group_id
+			WHERE f.depth < 32
+		)
+		SELECT g.group_id, g.group_name, g.group_nationality, g.group_size, g.parent_group_id, f.depth
+		FROM groups g
+		JOIN formations f ON g.group_id = f.group_id
+		ORDER BY f.depth, g.group_name`, countryCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get formations: %v", err)
+	}
+	defer rows.Close()
+
+	var roots, subordinates []models.Group
+	for rows.Next() {
+		var depth int
+		g, err := scanTreeGroup(rows, &depth)
+		if err != nil {
+			return nil, err
+		}
+		if depth == 0 {
+			roots = append(roots, g)
+		} else {
+			subordinates = append(subordinates, g)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildGroupTrees(roots, subordinates), nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// setImage records the storage key and rendition URLs of the image of a
+// weapon or vehicle and returns the key of the image it replaces, which is
+// left in storage for deleteReplacedImage once the change is committed. The
+// image is kept when image is nil. table and idColumn name the catalog table
+// and its key.
+func setImage(db DbOrTx, table, idColumn string, id interface{}, image *storage.Image) (string, error) {
+	if image == nil {
+		return "", nil
+	}
+	var oldKey sql.NullString
+	err := db.QueryRow("SELECT image_key FROM "+table+" WHERE "+idColumn+" = ?", id).Scan(&oldKey)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("UPDATE "+table+" SET image_url = ?, medium_url = ?, thumbnail_url = ?, image_key = ? WHERE "+idColumn+" = ?",
+		image.URL, image.MediumURL, image.ThumbnailURL, image.Key, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to set image: %v", err)
+	}
+
+	// An upload under the same key has already overwritten the old image
+	if oldKey.String == image.Key {
+		return "", nil
+	}
+	return oldKey.String, nil
+}
+
+// deleteReplacedImage deletes an image replaced by setImage from storage so
+// that it is not left behind
+func deleteReplacedImage(key string) {
+	if key == "" {
+		return
+	}
+	if err := storage.DeleteImage(key); err != nil {
+		fmt.Printf("Warning: Failed to delete replaced image from storage: %v\n", err)
+	}
+}
+
+// imageTables maps the entity types that have images to their tables and keys
+var imageTables = map[string]struct{ table, idColumn string }{
+	"weapon":  {"weapons", "weapon_id"},
+	"vehicle": {"vehicles", "vehicle_id"},
+}
+
+// GetImageReferences returns the images recorded for weapons and vehicles
+func (s *Store) GetImageReferences() ([]models.ImageReference, error) {
+	rows, err := s.db.Query(`
+		SELECT 'weapon', weapon_id, weapon_name, image_key, image_url, medium_url, thumbnail_url
+		FROM weapons WHERE image_url IS NOT NULL OR image_key IS NOT NULL
+		UNION ALL
+		SELECT 'vehicle', vehicle_id, vehicle_name, image_key, image_url, medium_url, thumbnail_url
+		FROM vehicles WHERE image_url IS NOT NULL OR image_key IS NOT NULL
+		ORDER BY 1, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query image references: %v", err)
+	}
+	defer rows.Close()
+
+	var refs []models.ImageReference
+	for rows.Next() {
+		var ref models.ImageReference
+		var key, url, medium, thumbnail sql.NullString
+		if err := rows.Scan(&ref.EntityType, &ref.EntityID, &ref.Name, &key, &url, &medium, &thumbnail); err != nil {
+			return nil, err
+		}
+		ref.Key, ref.URL, ref.MediumURL, ref.ThumbnailURL = key.String, url.String, medium.String, thumbnail.String
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// ClearImage forgets the image of a weapon or vehicle without touching
+// storage. It is used for images whose objects have gone missing. The image
+// is only cleared if it is still the one ref recorded, so an image replaced
+// since ref was read is left alone; ClearImage reports whether it was cleared.
+func (s *Store) ClearImage(ref models.ImageReference) (bool, error) {
+	t, ok := imageTables[ref.EntityType]
+	if !ok {
+		return false, fmt.Errorf("%s has no image", ref.EntityType)
+	}
+	result, err := s.db.Exec(`
+		UPDATE `+t.table+`
+		SET image_url = NULL, medium_url = NULL, thumbnail_url = NULL, image_key = NULL
+		WHERE `+t.idColumn+` = ? AND COALESCE(image_key, '') = ? AND COALESCE(image_url, '') = ?`,
+		ref.EntityID, ref.Key, ref.URL)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear image: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// MissingEquipmentError lists weapons and vehicles referenced by name that
+// are not in the catalog
+type MissingEquipmentError struct {
+	Weapons  []string
+	Vehicles []string
+}
+
+func (e *MissingEquipmentError) Error() string {
+	var parts []string
+	if len(e.Weapons) > 0 {
+		parts = append(parts, "unknown weapons: "+strings.Join(e.Weapons, ", "))
+	}
+	if len(e.Vehicles) > 0 {
+		parts = append(parts, "unknown vehicles: "+strings.Join(e.Vehicles, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ImportGroups creates groups whose weapons and vehicles are given by name,
+// all in one transaction. Missing weapons and vehicles are added to the
+// catalog when createMissing is set and reported as a MissingEquipmentError
+// otherwise. Nationalities may be country names or codes. A ParentID that is
+// the ID of another imported group makes the new group subordinate to that
+// group's copy, and any other ParentID must be an existing group. The new
+// groups and catalog entries are recorded in the audit log as created by
+// username. The IDs of the new groups are returned in the order given.
+func (s *Store) ImportGroups(groups []models.GroupDetails, createMissing bool, username string) ([]int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	missing := &MissingEquipmentError{Weapons: []string{}, Vehicles: []string{}}
+	for i := range groups {
+		code, err := CountryCode(groups[i].Nationality)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", groups[i].Name, &ReferenceError{Kind: "country", ID: groups[i].Nationality})
+		}
+		groups[i].Nationality = code
+
+		if err := resolveEquipment(tx, &groups[i], createMissing, username, missing); err != nil {
+			return nil, err
+		}
+	}
+	if len(missing.Weapons) > 0 || len(missing.Vehicles) > 0 {
+		sort.Strings(missing.Weapons)
+		sort.Strings(missing.Vehicles)
+		return nil, missing
+	}
+
+	order, err := importOrder(groups)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make([]int64, len(groups))
+	for _, i := range order {
+		group := groups[i]
+		if parent, ok := importedParent(groups, group.ParentID); ok {
+			group.ParentID = int(groupIDs[parent])
+		}
+		groupID, err := createGroup(tx, group)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", group.Name, err)
+		}
+		if err := recordChange(tx, username, "group", fmt.Sprint(groupID), "create", nil); err != nil {
+			return nil, err
+		}
+		groupIDs[i] = groupID
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return groupIDs, nil
+}
+
+// importedParent returns the index of the imported group with ID parentID
+func importedParent(groups []models.GroupDetails, parentID int) (int, bool) {
+	if parentID == 0 {
+		return 0, false
+	}
+	for i, g := range groups {
+		if g.ID == fmt.Sprint(parentID) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// importOrder returns the indexes of the groups to import with every group
+// after its parent, or ErrGroupCycle when the parents form a cycle
+func importOrder(groups []models.GroupDetails) ([]int, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(groups))
+	order := make([]int, 0, len(groups))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("group %q: %w", groups[i].Name, ErrGroupCycle)
+		case done:
+			return nil
+		}
+		state[i] = visiting
+		if parent, ok := importedParent(groups, groups[i].ParentID); ok {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		order = append(order, i)
+		return nil
+	}
+
+	for i := range groups {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// resolveEquipment fills in the IDs of weapons and vehicles that are given by
+// name, creating them or recording them in missing when they do not exist
+func resolveEquipment(db DbOrTx, group *models.GroupDetails, createMissing bool, username string, missing *MissingEquipmentError) error {
+	resolveWeapons := func(members []models.Member) error {
+		for i := range members {
+			for j := range members[i].Weapons {
+				w := &members[i].Weapons[j]
+				if w.Name == "" {
+					continue
+				}
+				id, err := findOrCreateWeapon(db, *w, createMissing, username)
+				if err != nil {
+					return err
+				}
+				if id == 0 {
+					missing.Weapons = appendUnique(missing.Weapons, w.Name)
+				}
+				w.ID = int(id)
+			}
+		}
+		return nil
+	}
+
+	if err := resolveWeapons(group.DirectMembers); err != nil {
+		return err
+	}
+	for i := range group.Teams {
+		if err := resolveWeapons(group.Teams[i].Members); err != nil {
+			return err
+		}
+	}
+	for i := range group.Vehicles {
+		v := &group.Vehicles[i]
+		if v.Name != "" {
+			id, err := findOrCreateVehicle(db, *v, createMissing, username)
+			if err != nil {
+				return err
+			}
+			if id == 0 {
+				missing.Vehicles = appendUnique(missing.Vehicles, v.Name)
+			}
+			v.ID = fmt.Sprint(id)
+		}
+		if err := resolveWeapons(v.Crew); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findOrCreateWeapon returns the ID of the weapon with the given name. When it
+// does not exist it is created for username if create is set, and 0 is
+// returned otherwise.
+func findOrCreateWeapon(db DbOrTx, w models.Weapon, create bool, username string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT weapon_id FROM weapons WHERE weapon_name = ?", w.Name).Scan(&id)
+	if err == nil || err != sql.ErrNoRows {
+		return id, err
+	}
+	if !create {
+		return 0, nil
+	}
+	id, err = createWeapon(db, models.Weapon{Name: w.Name, Type: w.Type, Caliber: w.Caliber})
+	if err != nil {
+		return 0, err
+	}
+	return id, recordChange(db, username, "weapon", fmt.Sprint(id), "create", nil)
+}
+
+// findOrCreateVehicle returns the ID of the vehicle with the given name. When
+// it does not exist it is created for username if create is set, and 0 is
+// returned otherwise.
+func findOrCreateVehicle(db DbOrTx, v models.Vehicle, create bool, username string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT vehicle_id FROM vehicles WHERE vehicle_name = ?", v.Name).Scan(&id)
+	if err == nil || err != sql.ErrNoRows {
+		return id, err
+	}
+	if !create {
+		return 0, nil
+	}
+	armament := v.Armament
+	if armament == "" {
+		armament = "None"
+	}
+	id, err = createVehicle(db, models.Vehicle{Name: v.Name, Type: v.Type, Armament: armament})
+	if err != nil {
+		return 0, err
+	}
+	return id, recordChange(db, username, "vehicle", fmt.Sprint(id), "create", nil)
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// SortError reports a sort field that a list does not support
+type SortError struct {
+	Field   string
+	Allowed []string
+}
+
+func (e *SortError) Error() string {
+	return fmt.Sprintf("cannot sort by %q, use one of: %s", e.Field, strings.Join(e.Allowed, ", "))
+}
+
+// listQuery collects the conditions and arguments of a filtered list query
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// clause returns the WHERE clause, or an empty string without conditions
+func (q *listQuery) clause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// orderBy returns the ORDER BY clause for opts. columns maps the sort fields
+// to their columns, and idColumn breaks ties so pages never overlap.
+func orderBy(opts models.ListOptions, columns map[string]string, defaultSort, idColumn string) (string, error) {
+	field := opts.Sort
+	if field == "" {
+		field = defaultSort
+	}
+	column, ok := columns[field]
+	if !ok {
+		allowed := make([]string, 0, len(columns))
+		for f := range columns {
+			allowed = append(allowed, f)
+		}
+		sort.Strings(allowed)
+		return "", &SortError{Field: field, Allowed: allowed}
+	}
+
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s", column, direction, idColumn, direction), nil
+}
+
+// limitClause returns the LIMIT and OFFSET clause for opts
+func limitClause(opts models.ListOptions) string {
+	if opts.Limit <= 0 {
+		if opts.Offset > 0 {
+			return fmt.Sprintf("LIMIT -1 OFFSET %d", opts.Offset)
+		}
+		return ""
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", opts.Limit, opts.Offset)
+}
+
+// countRows returns the number of rows a list query matches without paging,
+// running the count only when the page may not hold them all
+func (s *Store) countRows(opts models.ListOptions, returned int, table string, q *listQuery) (int, error) {
+	if opts.Offset == 0 && (opts.Limit <= 0 || returned < opts.Limit) {
+		return returned, nil
+	}
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" "+q.clause(), q.args...).Scan(&total)
+	return total, err
+}
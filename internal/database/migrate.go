@@ -0,0 +1,369 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionTable is the table goose records applied migrations in, so databases
+// migrated with goose and with the app can be used interchangeably
+const versionTable = "goose_db_version"
+
+// Migration is a schema change read from a goose SQL file
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	// NoTransaction is set for files marked "-- +goose NO TRANSACTION"
+	NoTransaction bool
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// SchemaOutdatedError is returned by CheckSchema when migrations are pending
+type SchemaOutdatedError struct {
+	Current int64
+	Pending []Migration
+}
+
+func (e *SchemaOutdatedError) Error() string {
+	latest := e.Pending[len(e.Pending)-1].Version
+	return fmt.Sprintf("database schema is at version %d but the latest migration is %d (%d pending)",
+		e.Current, latest, len(e.Pending))
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Migrator reads the migrations in fsys, which are named like
+// 001_CreateTables.sql, and returns a migrator for the store's database
+func (s *Store) Migrator(fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: s.db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads and parses the .sql files in fsys in version order
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int64]string)
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, name)
+		}
+		seen[version] = name
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMigration(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %v", name, err)
+		}
+		m.Version = version
+		m.Name = strings.TrimSuffix(path.Base(name), ".sql")
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// parseMigration splits a goose SQL file into its up and down statements.
+// Statements end with a semicolon at the end of a line, except between
+// "-- +goose StatementBegin" and "-- +goose StatementEnd".
+func parseMigration(data string) (Migration, error) {
+	var m Migration
+	var current *[]string
+	var statement strings.Builder
+	inBlock, hasUp := false, false
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "-- +goose") {
+			switch annotation := strings.TrimSpace(strings.TrimPrefix(trimmed, "-- +goose")); annotation {
+			case "Up":
+				current = &m.Up
+				hasUp = true
+			case "Down":
+				current = &m.Down
+			case "StatementBegin":
+				inBlock = true
+			case "StatementEnd":
+				inBlock = false
+				if current != nil && strings.TrimSpace(statement.String()) != "" {
+					*current = append(*current, statement.String())
+				}
+				statement.Reset()
+			case "NO TRANSACTION":
+				m.NoTransaction = true
+			default:
+				return m, fmt.Errorf("unknown annotation: %s", trimmed)
+			}
+			continue
+		}
+
+		if current == nil || (!inBlock && (trimmed == "" || strings.HasPrefix(trimmed, "--"))) {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			*current = append(*current, statement.String())
+			statement.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, err
+	}
+
+	if inBlock {
+		return m, fmt.Errorf("missing -- +goose StatementEnd")
+	}
+	if strings.TrimSpace(statement.String()) != "" {
+		return m, fmt.Errorf("statement is missing its final semicolon")
+	}
+	if !hasUp {
+		return m, fmt.Errorf("missing -- +goose Up")
+	}
+	return m, nil
+}
+
+// ensureVersionTable creates the version table the way goose does, with a
+// row for version 0
+func (m *Migrator) ensureVersionTable() error {
+	var exists bool
+	err := m.db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", versionTable).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check for %s: %v", versionTable, err)
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`CREATE TABLE ` + versionTable + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", versionTable, err)
+	}
+	if _, err := tx.Exec("INSERT INTO " + versionTable + " (version_id, is_applied) VALUES (0, 1)"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied returns the time each applied version was recorded. A version
+// counts as applied when its latest row is marked applied, which also covers
+// rollbacks recorded by older goose releases.
+func (m *Migrator) applied() (map[int64]time.Time, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query(`
+		SELECT version_id, is_applied, tstamp
+		FROM ` + versionTable + `
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", versionTable, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var tstamp sql.NullString
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, err
+		}
+		if !isApplied {
+			delete(applied, version)
+			continue
+		}
+		// Drivers return the timestamp in either format
+		at, err := time.Parse("2006-01-02 15:04:05", tstamp.String)
+		if err != nil {
+			at, _ = time.Parse(time.RFC3339, tstamp.String)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Status lists all migrations and whether they have been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		at, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: at}
+	}
+	return statuses, nil
+}
+
+// Version returns the highest applied version, or 0 for an empty database
+func (m *Migrator) Version() (int64, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Pending returns the migrations that have not been applied, in order
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema returns a SchemaOutdatedError if any migration is pending
+func (m *Migrator) CheckSchema() error {
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+	return &SchemaOutdatedError{Current: current, Pending: pending}
+}
+
+// Up applies all pending migrations in order and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range pending {
+		if err := m.run(migration, migration.Up, true); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+// Down rolls back the most recently applied migration and returns it. It
+// returns false when no migration is applied.
+func (m *Migrator) Down() (Migration, bool, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return Migration{}, false, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; ok {
+			return migration, true, m.run(migration, migration.Down, false)
+		}
+	}
+	return Migration{}, false, nil
+}
+
+// run executes the statements of a migration and records the new version
+// state, inside one transaction unless the migration opts out
+func (m *Migrator) run(migration Migration, statements []string, up bool) error {
+	record := "DELETE FROM " + versionTable + " WHERE version_id = ?"
+	if up {
+		record = "INSERT INTO " + versionTable + " (version_id, is_applied) VALUES (?, 1)"
+	}
+
+	if migration.NoTransaction {
+		for _, statement := range statements {
+			if _, err := m.db.Exec(statement); err != nil {
+				return fmt.Errorf("migration %s: %v", migration.Name, err)
+			}
+		}
+		_, err := m.db.Exec(record, migration.Version)
+		return err
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("migration %s: %v", migration.Name, err)
+		}
+	}
+	if _, err := tx.Exec(record, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration %s: %v", migration.Name, err)
+	}
+	return tx.Commit()
+}
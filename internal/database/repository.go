@@ -0,0 +1,118 @@
+package database
+
+import (
+	"time"
+
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// The methods that change groups, the catalogs or countries record the change
+// in the audit log as made by username, in the same transaction, so a change
+// is never saved without its entry.
+
+// GroupRepository stores groups and their hierarchy
+type GroupRepository interface {
+	GetGroups() ([]models.Group, error)
+	ListGroups(filter models.GroupFilter, opts models.ListOptions) ([]models.Group, int, error)
+	GetGroup(groupID string) (models.Group, error)
+	GetGroupDetails(groupID string) (models.GroupDetails, error)
+	GroupExists(groupID string) (bool, error)
+	CreateGroup(group models.GroupDetails, username string) (int64, error)
+	UpdateGroup(groupID string, group models.GroupDetails, username string) error
+	DuplicateGroup(groupID, name, nationality, username string) (int64, error)
+	DeleteGroup(groupID, username string) error
+	ImportGroups(groups []models.GroupDetails, createMissing bool, username string) ([]int64, error)
+	GetGroupTree(groupID string) (models.GroupNode, error)
+	GetGroupAncestors(groupID string) ([]models.Group, error)
+	GetParentCandidates(groupID string) ([]models.Group, error)
+	GetGroupRollup(groupID string) (models.GroupRollup, error)
+	GetGroupRevisions(groupID string) ([]models.GroupRevision, error)
+	RestoreGroup(groupID string, group models.GroupDetails, username string) error
+}
+
+// WeaponRepository stores the weapon catalog and the weapons carried by members
+type WeaponRepository interface {
+	GetWeapons() ([]models.Weapon, error)
+	ListWeapons(filter models.WeaponFilter, opts models.ListOptions) ([]models.Weapon, int, error)
+	GetWeapon(weaponID string) (models.Weapon, error)
+	GetWeaponDetails(weaponID string) (models.WeaponDetails, error)
+	WeaponExists(name string) (bool, int, error)
+	CreateWeapon(w models.Weapon, username string) (int64, error)
+	UpdateWeapon(w models.Weapon, image *storage.Image, username string) error
+	SaveWeapon(w models.Weapon, image *storage.Image, username string) (int64, error)
+	DeleteWeapon(weaponID, username string) error
+	GetMemberWeaponsData(memberID string) (map[string]interface{}, error)
+	UpdateMemberWeapons(memberID string, weaponIDs []string, username string) error
+}
+
+// VehicleRepository stores the vehicle catalog
+type VehicleRepository interface {
+	GetVehicles() ([]models.Vehicle, error)
+	ListVehicles(filter models.VehicleFilter, opts models.ListOptions) ([]models.Vehicle, int, error)
+	GetVehicle(vehicleID string) (models.Vehicle, error)
+	GetVehicleDetails(vehicleID string) (models.VehicleDetails, error)
+	VehicleExists(name string) (bool, string, error)
+	CreateVehicle(v models.Vehicle, username string) (int64, error)
+	UpdateVehicle(v models.Vehicle, image *storage.Image, username string) error
+	SaveVehicle(v models.Vehicle, image *storage.Image, username string) (int64, error)
+	DeleteVehicle(vehicleID, username string) error
+}
+
+// CaliberRepository stores the caliber catalog
+type CaliberRepository interface {
+	GetCalibers() ([]models.Caliber, error)
+	GetCaliber(caliberID string) (models.Caliber, error)
+	CreateCaliber(c models.Caliber, username string) (int64, error)
+	UpdateCaliber(c models.Caliber, username string) error
+	DeleteCaliber(caliberID, username string) error
+}
+
+// CountryRepository reads groups and equipment by country
+type CountryRepository interface {
+	GetCountries() ([]string, error)
+	GetCountryDetails(countryName string) (models.CountryDetails, error)
+	GetCountryGroupDetails(countryName string) ([]models.GroupDetails, error)
+	RenameCountry(countryCode, newCode, username string) error
+}
+
+// SearchRepository searches groups, members and equipment by text
+type SearchRepository interface {
+	Search(query string, limit int) ([]models.SearchResult, error)
+}
+
+// UserRepository stores accounts and their login sessions
+type UserRepository interface {
+	CreateUser(username, passwordHash, role string) (int64, error)
+	GetUserByName(username string) (models.User, error)
+	SetPassword(userID int, passwordHash string) error
+	SetRole(userID int, role string) error
+	CreateSession(tokenHash string, userID int, expires time.Time) error
+	GetSessionUser(tokenHash string) (models.User, error)
+	DeleteSession(tokenHash string) error
+}
+
+// AuditRepository stores the append-only log of data changes
+type AuditRepository interface {
+	RecordChange(entry models.AuditEntry) error
+	ListAuditEntries(filter models.AuditFilter, opts models.ListOptions) ([]models.AuditEntry, int, error)
+}
+
+// ImageRepository reads and clears the images recorded for weapons and
+// vehicles
+type ImageRepository interface {
+	GetImageReferences() ([]models.ImageReference, error)
+	ClearImage(ref models.ImageReference) (bool, error)
+}
+
+var (
+	_ GroupRepository   = (*Store)(nil)
+	_ WeaponRepository  = (*Store)(nil)
+	_ VehicleRepository = (*Store)(nil)
+	_ CaliberRepository = (*Store)(nil)
+	_ CountryRepository = (*Store)(nil)
+	_ SearchRepository  = (*Store)(nil)
+	_ UserRepository    = (*Store)(nil)
+	_ AuditRepository   = (*Store)(nil)
+	_ ImageRepository   = (*Store)(nil)
+)
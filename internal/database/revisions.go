@@ -0,0 +1,107 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"orbat/internal/models"
+)
+
+// GetGroupRevisions retrieves the saved versions of a group, oldest first.
+// They are read from the audit log, which holds the group as saved by every
+// change, and remain after the group is deleted.
+func (s *Store) GetGroupRevisions(groupID string) ([]models.GroupRevision, error) {
+	rows, err := s.db.Query(`
+		SELECT changed_at, username, action, COALESCE(after_json, before_json)
+		FROM audit_log
+		WHERE entity_type = 'group' AND entity_id = ?
+		ORDER BY audit_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group revisions: %v", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.GroupRevision
+	for rows.Next() {
+		var rev models.GroupRevision
+		var changedAt int64
+		var snapshot string
+		if err := rows.Scan(&changedAt, &rev.Username, &rev.Action, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to scan group revision: %v", err)
+		}
+		if err := json.Unmarshal([]byte(snapshot), &rev.Group); err != nil {
+			return nil, fmt.Errorf("failed to read group revision: %v", err)
+		}
+		rev.Number = len(revisions) + 1
+		rev.Time = time.Unix(changedAt, 0)
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// RestoreGroup makes a group match an earlier version of it, re-creating it
+// under its old ID when it was deleted. Members, teams and vehicles are
+// matched by ID as in UpdateGroup. A group whose parent no longer exists is
+// restored at the top level. The nationality may be a country name or code.
+func (s *Store) RestoreGroup(groupID string, group models.GroupDetails, username string) error {
+	code, err := CountryCode(group.Nationality)
+	if err != nil {
+		return &ReferenceError{Kind: "country", ID: group.Nationality}
+	}
+	group.Nationality = code
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if group.ParentID != 0 {
+		var parentExists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM groups WHERE group_id = ?)", group.ParentID).Scan(&parentExists); err != nil {
+			return err
+		}
+		if !parentExists {
+			group.ParentID = 0
+		}
+	}
+
+	before, err := snapshot(tx, "group", groupID)
+	if err != nil {
+		return err
+	}
+	if before != nil {
+		if err := updateGroup(tx, groupID, group); err != nil {
+			return err
+		}
+		if err := recordChange(tx, username, "group", groupID, "restore", before); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err := validateGroupReferences(tx, group); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO groups (group_id, group_name, group_nationality, group_size)
+		VALUES (?, ?, ?, 0)`, groupID, group.Name, group.Nationality)
+	if err != nil {
+		return fmt.Errorf("failed to restore group: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := setGroupParent(tx, id, group.ParentID); err != nil {
+		return err
+	}
+	if err := insertGroupContents(tx, id, group); err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "group", groupID, "restore", nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// memberGroupsQuery selects the group of every member, whether they belong to
+// the group directly, through a team or as vehicle crew
+const memberGroupsQuery = `
+	SELECT member_id, group_id FROM group_members WHERE member_id IS NOT NULL
+	UNION
+	SELECT tm.member_id, gm.group_id
+	FROM team_members tm
+	JOIN group_members gm ON gm.team_id = tm.team_id
+	UNION
+	SELECT vm.member_id, gv.group_id
+	FROM vehicle_members vm
+	JOIN group_vehicles gv ON gv.instance_id = vm.instance_id`
+
+// Search returns up to limit groups, member roles, weapons and vehicles
+// matching query, best matches first, with the best match of each kind
+// scoring 1. Every word of the query must match,
+// and the last word also matches as a prefix.
+func (s *Store) Search(query string, limit int) ([]models.SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	// bm25 ranks are negative, with the best match lowest, but they depend on
+	// the statistics of each index and cannot be compared across tables. Each
+	// rank is divided by the best of its table, so the best match of every
+	// kind scores 1 and the kinds interleave.
+	rows, err := s.db.Query(`
+		WITH matches (kind, position, id, name, detail, extra, count, rank) AS (
+			SELECT 'group', 1, g.group_id, COALESCE(g.group_name, ''), COALESCE(g.group_nationality, ''), '', 1, f.rank
+			FROM groups_fts f
+			JOIN groups g ON g.group_id = f.rowid
+			WHERE groups_fts MATCH ?
+			UNION ALL
+			SELECT 'member', 2, g.group_id, COALESCE(m.member_role, ''), COALESCE(m.member_rank, ''), COALESCE(g.group_name, ''),
+				   COUNT(*), MIN(f.rank)
+			FROM members_fts f
+			JOIN members m ON m.member_id = f.rowid
+			JOIN (`+memberGroupsQuery+`) mg ON mg.member_id = m.member_id
+			JOIN groups g ON g.group_id = mg.group_id
+			WHERE members_fts MATCH ?
+			GROUP BY g.group_id, m.member_role, m.member_rank
+			UNION ALL
+			SELECT 'weapon', 3, w.weapon_id, COALESCE(w.weapon_name, ''), COALESCE(w.weapon_type, ''), COALESCE(w.weapon_caliber, ''), 1, f.rank
+			FROM weapons_fts f
+			JOIN weapons w ON w.weapon_id = f.rowid
+			WHERE weapons_fts MATCH ?
+			UNION ALL
+			SELECT 'vehicle', 4, v.vehicle_id, COALESCE(v.vehicle_name, ''), COALESCE(v.vehicle_type, ''), COALESCE(v.vehicle_armament, ''), 1, f.rank
+			FROM vehicles_fts f
+			JOIN vehicles v ON v.vehicle_id = f.rowid
+			WHERE vehicles_fts MATCH ?
+		)
+		SELECT kind, id, name, detail, extra, count,
+			   COALESCE(rank / NULLIF(MIN(rank) OVER (PARTITION BY kind), 0), 1) AS score
+		FROM matches
+		ORDER BY score DESC, position, name
+		LIMIT ?`, match, match, match, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %v", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var r models.SearchResult
+		var detail, extra string
+		if err := rows.Scan(&r.Kind, &r.ID, &r.Name, &detail, &extra, &r.Count, &r.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %v", err)
+		}
+
+		switch r.Kind {
+		case "group":
+			r.URL = fmt.Sprintf("/group/%d", r.ID)
+			r.Details = countryName(detail)
+		case "member":
+			r.URL = fmt.Sprintf("/group/%d", r.ID)
+			r.Details = joinNonEmpty(" in ", detail, extra)
+		case "weapon":
+			r.URL = fmt.Sprintf("/weapon/%d", r.ID)
+			r.Details = joinNonEmpty(", ", detail, extra)
+		case "vehicle":
+			r.URL = fmt.Sprintf("/vehicle/%d", r.ID)
+			r.Details = joinNonEmpty(", ", detail, extra)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query matching every word. Words are
+// quoted so punctuation in the input is never read as query syntax.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	return strings.Join(words, " ") + "*"
+}
+
+// joinNonEmpty joins the non-empty strings with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"orbat/internal/models"
+)
+
+// ErrUserExists is returned when creating a user with a name that is taken
+var ErrUserExists = errors.New("a user with this name already exists")
+
+// CreateUser adds an account with an already hashed password and returns its ID
+func (s *Store) CreateUser(username, passwordHash, role string) (int64, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrUserExists
+	}
+
+	result, err := s.db.Exec("INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)", username, passwordHash, role)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %v", err)
+	}
+	return result.LastInsertId()
+}
+
+// GetUserByName retrieves an account by its username, ignoring case
+func (s *Store) GetUserByName(username string) (models.User, error) {
+	var u models.User
+	err := s.db.QueryRow(`
+		SELECT user_id, username, role, password_hash
+		FROM users WHERE username = ?`, username).Scan(&u.ID, &u.Username, &u.Role, &u.PasswordHash)
+	return u, err
+}
+
+// SetPassword replaces the password hash of an account and ends its sessions
+func (s *Store) SetPassword(userID int, passwordHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET password_hash = ? WHERE user_id = ?", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetRole changes the role of an account
+func (s *Store) SetRole(userID int, role string) error {
+	result, err := s.db.Exec("UPDATE users SET role = ? WHERE user_id = ?", role, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateSession stores a session for a user under the hash of its token.
+// Expired sessions are removed at the same time.
+func (s *Store) CreateSession(tokenHash string, userID int, expires time.Time) error {
+	if _, err := s.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to remove expired sessions: %v", err)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, expires_at)
+		VALUES (?, ?, ?)`, tokenHash, userID, expires.Unix())
+	return err
+}
+
+// GetSessionUser retrieves the user of an unexpired session, or returns
+// sql.ErrNoRows when there is none
+func (s *Store) GetSessionUser(tokenHash string) (models.User, error) {
+	var u models.User
+	err := s.db.QueryRow(`
+		SELECT u.user_id, u.username, u.role, u.password_hash
+		FROM sessions s
+		JOIN users u ON u.user_id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ?`, tokenHash, time.Now().Unix()).Scan(
+		&u.ID, &u.Username, &u.Role, &u.PasswordHash)
+	return u, err
+}
+
+// DeleteSession ends a session
+func (s *Store) DeleteSession(tokenHash string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
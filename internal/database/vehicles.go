@@ -9,38 +9,214 @@ import (
 )
 
 // GetVehicles retrieves all vehicles from the database
-func GetVehicles() ([]models.Vehicle, error) {
-	rows, err := DB.Query("SELECT vehicle_id, vehicle_name, vehicle_type, vehicle_armament, image_url FROM vehicles ORDER BY vehicle_name")
+func (s *Store) GetVehicles() ([]models.Vehicle, error) {
+	vehicles, _, err := s.ListVehicles(models.VehicleFilter{}, models.ListOptions{})
+	return vehicles, err
+}
+
+// vehicleSortColumns maps the fields vehicles can be sorted by to their columns
+var vehicleSortColumns = map[string]string{
+	"name":     "vehicle_name",
+	"type":     "vehicle_type",
+	"armament": "vehicle_armament",
+}
+
+// ListVehicles retrieves a page of the vehicles matching filter, together
+// with the number of matching vehicles on all pages. The type matches
+// regardless of case.
+func (s *Store) ListVehicles(filter models.VehicleFilter, opts models.ListOptions) ([]models.Vehicle, int, error) {
+	var q listQuery
+	if filter.Type != "" {
+		q.where("vehicle_type = ? COLLATE NOCASE", filter.Type)
+	}
+	order, err := orderBy(opts, vehicleSortColumns, "name", "vehicle_id")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT vehicle_id, vehicle_name, vehicle_type, vehicle_armament, image_url, medium_url, thumbnail_url FROM vehicles "+
+		q.clause()+" "+order+" "+limitClause(opts), q.args...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var vehicles []models.Vehicle
 	for rows.Next() {
 		var v models.Vehicle
-		if err := rows.Scan(&v.ID, &v.Name, &v.Type, &v.Armament, &v.ImageURL); err != nil {
-			return nil, err
+		if err := rows.Scan(&v.ID, &v.Name, &v.Type, &v.Armament, &v.ImageURL, &v.MediumURL, &v.ThumbnailURL); err != nil {
+			return nil, 0, err
 		}
 		vehicles = append(vehicles, v)
 	}
-	return vehicles, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.countRows(opts, len(vehicles), "vehicles", &q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return vehicles, total, nil
+}
+
+// VehicleExists checks if a vehicle with the given name exists
+func (s *Store) VehicleExists(name string) (bool, string, error) {
+	var id string
+	err := s.db.QueryRow("SELECT vehicle_id FROM vehicles WHERE vehicle_name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, id, nil
+}
+
+// GetVehicle retrieves a single vehicle by ID
+func (s *Store) GetVehicle(vehicleID string) (models.Vehicle, error) {
+	return getVehicle(s.db, vehicleID)
+}
+
+func getVehicle(db DbOrTx, vehicleID string) (models.Vehicle, error) {
+	var v models.Vehicle
+	err := db.QueryRow(`
+		SELECT vehicle_id, vehicle_name, vehicle_type, vehicle_armament, image_url, medium_url, thumbnail_url
+		FROM vehicles WHERE vehicle_id = ?`, vehicleID).Scan(
+		&v.ID, &v.Name, &v.Type, &v.Armament, &v.ImageURL, &v.MediumURL, &v.ThumbnailURL)
+	return v, err
+}
+
+// CreateVehicle inserts a new vehicle and returns its ID
+func (s *Store) CreateVehicle(v models.Vehicle, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createVehicle(tx, v)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "vehicle", fmt.Sprint(id), "create", nil); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func createVehicle(db DbOrTx, v models.Vehicle) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO vehicles (vehicle_name, vehicle_type, vehicle_armament, image_url)
+		VALUES (?, ?, ?, ?)`,
+		v.Name, v.Type, v.Armament, v.ImageURL)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateVehicle updates the name, type and armament of a vehicle and, unless
+// image is nil, replaces its image
+func (s *Store) UpdateVehicle(v models.Vehicle, image *storage.Image, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "vehicle", v.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE vehicles 
+		SET vehicle_name = ?,
+			vehicle_type = ?,
+			vehicle_armament = ?
+		WHERE vehicle_id = ?`,
+		v.Name, v.Type, v.Armament, v.ID)
+	if err != nil {
+		return err
+	}
+	replaced, err := setImage(tx, "vehicles", "vehicle_id", v.ID, image)
+	if err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "vehicle", v.ID, "update", before); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	deleteReplacedImage(replaced)
+	return nil
+}
+
+// SaveVehicle adds a vehicle, or updates the type and armament of the vehicle
+// with the same name, and returns its ID. Unless image is nil it becomes the
+// vehicle's image.
+func (s *Store) SaveVehicle(v models.Vehicle, image *storage.Image, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var before interface{}
+	action := "update"
+	err = tx.QueryRow("SELECT vehicle_id FROM vehicles WHERE vehicle_name = ?", v.Name).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		action = "create"
+		if id, err = createVehicle(tx, v); err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	default:
+		if before, err = snapshot(tx, "vehicle", fmt.Sprint(id)); err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			UPDATE vehicles 
+			SET vehicle_type = ?, vehicle_armament = ?
+			WHERE vehicle_id = ?`,
+			v.Type, v.Armament, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save vehicle: %v", err)
+		}
+	}
+
+	replaced, err := setImage(tx, "vehicles", "vehicle_id", id, image)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "vehicle", fmt.Sprint(id), action, before); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	deleteReplacedImage(replaced)
+	return id, nil
 }
 
 // GetVehicleDetails retrieves detailed information about a vehicle
-func GetVehicleDetails(vehicleID string) (models.VehicleDetails, error) {
+func (s *Store) GetVehicleDetails(vehicleID string) (models.VehicleDetails, error) {
 	var details models.VehicleDetails
 
-	err := DB.QueryRow(`
-		SELECT vehicle_id, vehicle_name, vehicle_type, vehicle_armament, image_url 
+	err := s.db.QueryRow(`
+		SELECT vehicle_id, vehicle_name, vehicle_type, vehicle_armament, image_url, medium_url, thumbnail_url
 		FROM vehicles WHERE vehicle_id = ?`, vehicleID).Scan(
 		&details.Vehicle.ID, &details.Vehicle.Name, &details.Vehicle.Type, 
-		&details.Vehicle.Armament, &details.Vehicle.ImageURL)
+		&details.Vehicle.Armament, &details.Vehicle.ImageURL, &details.Vehicle.MediumURL, &details.Vehicle.ThumbnailURL)
 	if err != nil {
 		return details, err
 	}
 
-	rows, err := DB.Query(`
+	rows, err := s.db.Query(`
 		SELECT 
 			g.group_id,
 			g.group_name,
@@ -106,16 +282,21 @@ func GetVehicleDetails(vehicleID string) (models.VehicleDetails, error) {
 }
 
 // DeleteVehicle deletes a vehicle and its associations
-func DeleteVehicle(vehicleID string) error {
-	tx, err := DB.Begin()
+func (s *Store) DeleteVehicle(vehicleID, username string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Get the image URL before deleting the vehicle
-	var imageURL sql.NullString
-	err = tx.QueryRow("SELECT image_url FROM vehicles WHERE vehicle_id = ?", vehicleID).Scan(&imageURL)
+	before, err := snapshot(tx, "vehicle", vehicleID)
+	if err != nil {
+		return err
+	}
+
+	// Get the image key before deleting the vehicle
+	var imageKey sql.NullString
+	err = tx.QueryRow("SELECT image_key FROM vehicles WHERE vehicle_id = ?", vehicleID).Scan(&imageKey)
 	if err != nil {
 		return err
 	}
@@ -153,13 +334,20 @@ func DeleteVehicle(vehicleID string) error {
 		return err
 	}
 
-	// Delete image from GCS if it exists
-	if imageURL.Valid && imageURL.String != "" {
-		if err := storage.DeleteImage(imageURL.String); err != nil {
-			// Log the error but continue with the transaction
+	if err := recordChange(tx, username, "vehicle", vehicleID, "delete", before); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Delete the image only once the row referring to it is gone, so a
+	// failed commit cannot leave a dangling URL
+	if imageKey.Valid && imageKey.String != "" {
+		if err := storage.DeleteImage(imageKey.String); err != nil {
 			fmt.Printf("Warning: Failed to delete image from storage: %v\n", err)
 		}
 	}
-
-	return tx.Commit()
+	return nil
 } 
\ No newline at end of file
@@ -8,29 +8,97 @@ import (
 	"orbat/internal/storage"
 )
 
+// weaponColumns are the columns of a weapon, in the order weaponFields scans
+// them. Unknown specs are read as 0.
+const weaponColumns = `weapon_id, weapon_name, weapon_type, weapon_caliber, COALESCE(caliber_id, 0),
+	COALESCE(effective_range, 0), COALESCE(rate_of_fire, 0), COALESCE(weight_empty, 0),
+	COALESCE(weight_loaded, 0), COALESCE(length, 0), COALESCE(magazine_capacity, 0),
+	image_url, medium_url, thumbnail_url`
+
+// specsSet sets the specs of a weapon from the arguments made by specsArgs,
+// storing unknown specs as null
+const specsSet = `effective_range = NULLIF(?, 0),
+			rate_of_fire = NULLIF(?, 0),
+			weight_empty = NULLIF(?, 0),
+			weight_loaded = NULLIF(?, 0),
+			length = NULLIF(?, 0),
+			magazine_capacity = NULLIF(?, 0)`
+
+// weaponFields returns the fields of w to scan weaponColumns into
+func weaponFields(w *models.Weapon) []interface{} {
+	return []interface{}{&w.ID, &w.Name, &w.Type, &w.Caliber, &w.CaliberID,
+		&w.Specs.EffectiveRange, &w.Specs.RateOfFire, &w.Specs.WeightEmpty,
+		&w.Specs.WeightLoaded, &w.Specs.Length, &w.Specs.MagazineCapacity,
+		&w.ImageURL, &w.MediumURL, &w.ThumbnailURL}
+}
+
+// specsArgs returns the specs of a weapon as query arguments, in column order
+func specsArgs(s models.WeaponSpecs) []interface{} {
+	return []interface{}{s.EffectiveRange, s.RateOfFire, s.WeightEmpty, s.WeightLoaded, s.Length, s.MagazineCapacity}
+}
+
 // GetWeapons retrieves all weapons from the database
-func GetWeapons() ([]models.Weapon, error) {
-	rows, err := DB.Query("SELECT weapon_id, weapon_name, weapon_type, weapon_caliber, image_url FROM weapons ORDER BY weapon_name")
+func (s *Store) GetWeapons() ([]models.Weapon, error) {
+	weapons, _, err := s.ListWeapons(models.WeaponFilter{}, models.ListOptions{})
+	return weapons, err
+}
+
+// weaponSortColumns maps the fields weapons can be sorted by to their columns
+var weaponSortColumns = map[string]string{
+	"name":    "weapon_name",
+	"type":    "weapon_type",
+	"caliber": "weapon_caliber",
+}
+
+// ListWeapons retrieves a page of the weapons matching filter, together with
+// the number of matching weapons on all pages. Type and caliber match
+// regardless of case.
+func (s *Store) ListWeapons(filter models.WeaponFilter, opts models.ListOptions) ([]models.Weapon, int, error) {
+	var q listQuery
+	if filter.Type != "" {
+		q.where("weapon_type = ? COLLATE NOCASE", filter.Type)
+	}
+	if filter.Caliber != "" {
+		q.where("weapon_caliber = ? COLLATE NOCASE", filter.Caliber)
+	}
+	if filter.CaliberID != 0 {
+		q.where("caliber_id = ?", filter.CaliberID)
+	}
+	order, err := orderBy(opts, weaponSortColumns, "name", "weapon_id")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("SELECT "+weaponColumns+" FROM weapons "+
+		q.clause()+" "+order+" "+limitClause(opts), q.args...)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	var weapons []models.Weapon
 	for rows.Next() {
 		var w models.Weapon
-		if err := rows.Scan(&w.ID, &w.Name, &w.Type, &w.Caliber, &w.ImageURL); err != nil {
-			return nil, err
+		if err := rows.Scan(weaponFields(&w)...); err != nil {
+			return nil, 0, err
 		}
 		weapons = append(weapons, w)
 	}
-	return weapons, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.countRows(opts, len(weapons), "weapons", &q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return weapons, total, nil
 }
 
 // WeaponExists checks if a weapon with the given name exists
-func WeaponExists(name string) (bool, int, error) {
+func (s *Store) WeaponExists(name string) (bool, int, error) {
 	var id int
-	err := DB.QueryRow("SELECT weapon_id FROM weapons WHERE weapon_name = ?", name).Scan(&id)
+	err := s.db.QueryRow("SELECT weapon_id FROM weapons WHERE weapon_name = ?", name).Scan(&id)
 	if err == sql.ErrNoRows {
 		return false, 0, nil
 	}
@@ -40,22 +108,168 @@ func WeaponExists(name string) (bool, int, error) {
 	return true, id, nil
 }
 
+// GetWeapon retrieves a single weapon by ID
+func (s *Store) GetWeapon(weaponID string) (models.Weapon, error) {
+	return getWeapon(s.db, weaponID)
+}
+
+func getWeapon(db DbOrTx, weaponID string) (models.Weapon, error) {
+	var w models.Weapon
+	err := db.QueryRow("SELECT "+weaponColumns+" FROM weapons WHERE weapon_id = ?", weaponID).Scan(weaponFields(&w)...)
+	return w, err
+}
+
+// CreateWeapon inserts a new weapon and returns its ID
+func (s *Store) CreateWeapon(w models.Weapon, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := createWeapon(tx, w)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "weapon", fmt.Sprint(id), "create", nil); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func createWeapon(db DbOrTx, w models.Weapon) (int64, error) {
+	caliberID, err := weaponCaliberID(db, w)
+	if err != nil {
+		return 0, err
+	}
+	args := append([]interface{}{w.Name, w.Type, w.Caliber, caliberID, w.ImageURL}, specsArgs(w.Specs)...)
+	result, err := db.Exec(`
+		INSERT INTO weapons (weapon_name, weapon_type, weapon_caliber, caliber_id, image_url,
+			effective_range, rate_of_fire, weight_empty, weight_loaded, length, magazine_capacity)
+		VALUES (?, ?, ?, ?, ?,
+			NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0))`,
+		args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateWeapon updates the name, type, caliber and specs of a weapon and,
+// unless image is nil, replaces its image
+func (s *Store) UpdateWeapon(w models.Weapon, image *storage.Image, username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshot(tx, "weapon", fmt.Sprint(w.ID))
+	if err != nil {
+		return err
+	}
+	caliberID, err := weaponCaliberID(tx, w)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{w.Name, w.Type, w.Caliber, caliberID}, specsArgs(w.Specs)...)
+	_, err = tx.Exec(`
+		UPDATE weapons 
+		SET weapon_name = ?,
+			weapon_type = ?,
+			weapon_caliber = ?,
+			caliber_id = ?,
+			`+specsSet+`
+		WHERE weapon_id = ?`,
+		append(args, w.ID)...)
+	if err != nil {
+		return err
+	}
+	replaced, err := setImage(tx, "weapons", "weapon_id", w.ID, image)
+	if err != nil {
+		return err
+	}
+	if err := recordChange(tx, username, "weapon", fmt.Sprint(w.ID), "update", before); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	deleteReplacedImage(replaced)
+	return nil
+}
+
+// SaveWeapon adds a weapon, or updates the type, caliber and specs of the
+// weapon with the same name, and returns its ID. Unless image is nil it
+// becomes the weapon's image.
+func (s *Store) SaveWeapon(w models.Weapon, image *storage.Image, username string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var before interface{}
+	action := "update"
+	err = tx.QueryRow("SELECT weapon_id FROM weapons WHERE weapon_name = ?", w.Name).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		action = "create"
+		if id, err = createWeapon(tx, w); err != nil {
+			return 0, err
+		}
+	case err != nil:
+		return 0, err
+	default:
+		if before, err = snapshot(tx, "weapon", fmt.Sprint(id)); err != nil {
+			return 0, err
+		}
+		caliberID, err := weaponCaliberID(tx, w)
+		if err != nil {
+			return 0, err
+		}
+		args := append([]interface{}{w.Type, w.Caliber, caliberID}, specsArgs(w.Specs)...)
+		_, err = tx.Exec(`
+			UPDATE weapons 
+			SET weapon_type = ?,
+				weapon_caliber = ?,
+				caliber_id = ?,
+				`+specsSet+`
+			WHERE weapon_id = ?`,
+			append(args, id)...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save weapon: %v", err)
+		}
+	}
+
+	replaced, err := setImage(tx, "weapons", "weapon_id", id, image)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordChange(tx, username, "weapon", fmt.Sprint(id), action, before); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	deleteReplacedImage(replaced)
+	return id, nil
+}
+
 // GetWeaponDetails retrieves detailed information about a weapon
-func GetWeaponDetails(weaponID string) (models.WeaponDetails, error) {
+func (s *Store) GetWeaponDetails(weaponID string) (models.WeaponDetails, error) {
 	var details models.WeaponDetails
 
 	// Get weapon details
-	err := DB.QueryRow(`
-		SELECT weapon_id, weapon_name, weapon_type, weapon_caliber, image_url 
-		FROM weapons WHERE weapon_id = ?`, weaponID).Scan(
-		&details.Weapon.ID, &details.Weapon.Name, &details.Weapon.Type, 
-		&details.Weapon.Caliber, &details.Weapon.ImageURL)
+	err := s.db.QueryRow("SELECT "+weaponColumns+" FROM weapons WHERE weapon_id = ?", weaponID).Scan(
+		weaponFields(&details.Weapon)...)
 	if err != nil {
 		return details, err
 	}
 
 	// Get all users of this weapon and their group info
-	rows, err := DB.Query(`
+	rows, err := s.db.Query(`
 		SELECT 
 			g.group_id,
 			g.group_name,
@@ -140,16 +354,21 @@ func GetWeaponDetails(weaponID string) (models.WeaponDetails, error) {
 }
 
 // DeleteWeapon deletes a weapon and its associations
-func DeleteWeapon(weaponID string) error {
-	tx, err := DB.Begin()
+func (s *Store) DeleteWeapon(weaponID, username string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Get the image URL before deleting the weapon
-	var imageURL sql.NullString
-	err = tx.QueryRow("SELECT image_url FROM weapons WHERE weapon_id = ?", weaponID).Scan(&imageURL)
+	before, err := snapshot(tx, "weapon", weaponID)
+	if err != nil {
+		return err
+	}
+
+	// Get the image key before deleting the weapon
+	var imageKey sql.NullString
+	err = tx.QueryRow("SELECT image_key FROM weapons WHERE weapon_id = ?", weaponID).Scan(&imageKey)
 	if err != nil {
 		return err
 	}
@@ -166,27 +385,34 @@ func DeleteWeapon(weaponID string) error {
 		return err
 	}
 
-	// If there was an image, delete it from GCS
-	if imageURL.Valid && imageURL.String != "" {
-		if err := storage.DeleteImage(imageURL.String); err != nil {
-			// Log the error but continue with the transaction
+	if err := recordChange(tx, username, "weapon", weaponID, "delete", before); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Delete the image only once the row referring to it is gone, so a
+	// failed commit cannot leave a dangling URL
+	if imageKey.Valid && imageKey.String != "" {
+		if err := storage.DeleteImage(imageKey.String); err != nil {
 			fmt.Printf("Warning: Failed to delete image from storage: %v\n", err)
 		}
 	}
-
-	return tx.Commit()
+	return nil
 }
 
 // GetMemberWeaponsData retrieves weapons data for a specific member
-func GetMemberWeaponsData(memberID string) (map[string]interface{}, error) {
+func (s *Store) GetMemberWeaponsData(memberID string) (map[string]interface{}, error) {
 	// Get all available weapons
-	allWeapons, err := GetWeapons()
+	allWeapons, err := s.GetWeapons()
 	if err != nil {
 		return nil, err
 	}
 
 	// Get member's current weapons
-	rows, err := DB.Query(`
+	rows, err := s.db.Query(`
 		SELECT w.weapon_id, w.weapon_name, w.weapon_type, w.weapon_caliber
 		FROM members_weapons mw
 		JOIN weapons w ON mw.weapon_id = w.weapon_id
@@ -218,23 +444,31 @@ func GetMemberWeaponsData(memberID string) (map[string]interface{}, error) {
 	}, nil
 }
 
-// UpdateMemberWeapons updates the weapons associated with a member
-func UpdateMemberWeapons(memberID string, weaponIDs []string) error {
-	tx, err := DB.Begin()
+// UpdateMemberWeapons updates the weapons associated with a member. The
+// change is recorded as an update of the member's group, so that it is one of
+// the group's revisions.
+func (s *Store) UpdateMemberWeapons(memberID string, weaponIDs []string, username string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Remove all existing weapons for this member
-	_, err = tx.Exec("DELETE FROM members_weapons WHERE member_id = ?", memberID)
+	groupIDs, err := memberGroups(tx, memberID)
 	if err != nil {
 		return err
 	}
+	before := make([]interface{}, len(groupIDs))
+	for i, groupID := range groupIDs {
+		if before[i], err = snapshot(tx, "group", groupID); err != nil {
+			return err
+		}
+	}
 
-	// If no weapons were selected, just return after deleting existing weapons
-	if len(weaponIDs) == 0 {
-		return tx.Commit()
+	// Remove all existing weapons for this member
+	_, err = tx.Exec("DELETE FROM members_weapons WHERE member_id = ?", memberID)
+	if err != nil {
+		return err
 	}
 
 	// Add new weapons
@@ -257,5 +491,29 @@ func UpdateMemberWeapons(memberID string, weaponIDs []string) error {
 		}
 	}
 
+	for i, groupID := range groupIDs {
+		if err := recordChange(tx, username, "group", groupID, "update", before[i]); err != nil {
+			return err
+		}
+	}
 	return tx.Commit()
+}
+
+// memberGroups returns the IDs of the groups a member belongs to
+func memberGroups(db DbOrTx, memberID string) ([]string, error) {
+	rows, err := db.Query("SELECT CAST(group_id AS TEXT) FROM ("+memberGroupsQuery+") WHERE member_id = ?", memberID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the groups of member %s: %v", memberID, err)
+	}
+	defer rows.Close()
+
+	var groupIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	return groupIDs, rows.Err()
 } 
\ No newline at end of file
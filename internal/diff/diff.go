@@ -0,0 +1,186 @@
+// Package diff describes the structural changes between two versions of a
+// group: renames, teams and vehicles added or removed, and members added,
+// removed, moved or given other weapons.
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// Kinds of change
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one difference between two versions of a group
+type Change struct {
+	Kind string
+	Text string
+}
+
+// Groups lists the changes that turn old into new. Teams, vehicles and
+// members are matched by ID, so a member keeps its identity when it moves
+// between teams or vehicles.
+func Groups(old, new models.GroupDetails) []Change {
+	var changes []Change
+	add := func(kind, format string, args ...interface{}) {
+		changes = append(changes, Change{Kind: kind, Text: fmt.Sprintf(format, args...)})
+	}
+
+	if old.Name != new.Name {
+		add(Changed, "Renamed from %q to %q", old.Name, new.Name)
+	}
+	if old.Nationality != new.Nationality {
+		add(Changed, "Nationality changed from %s to %s", old.Nationality, new.Nationality)
+	}
+	if old.ParentID != new.ParentID {
+		add(Changed, "Moved from %s to %s", parentLabel(old.ParentID), parentLabel(new.ParentID))
+	}
+
+	oldTeams := make(map[int]models.Team)
+	for _, t := range old.Teams {
+		oldTeams[t.ID] = t
+	}
+	newTeams := make(map[int]bool)
+	for _, t := range new.Teams {
+		newTeams[t.ID] = true
+		if before, ok := oldTeams[t.ID]; !ok {
+			add(Added, "Team %q added", t.Name)
+		} else if before.Name != t.Name {
+			add(Changed, "Team %q renamed to %q", before.Name, t.Name)
+		}
+	}
+	for _, t := range old.Teams {
+		if !newTeams[t.ID] {
+			add(Removed, "Team %q removed", t.Name)
+		}
+	}
+
+	oldVehicles := make(map[int]models.Vehicle)
+	for _, v := range old.Vehicles {
+		oldVehicles[v.InstanceID] = v
+	}
+	newVehicles := make(map[int]bool)
+	for _, v := range new.Vehicles {
+		newVehicles[v.InstanceID] = true
+		if before, ok := oldVehicles[v.InstanceID]; !ok {
+			add(Added, "Vehicle %s added", v.Name)
+		} else if before.ID != v.ID {
+			add(Changed, "Vehicle %s replaced by %s", before.Name, v.Name)
+		}
+	}
+	for _, v := range old.Vehicles {
+		if !newVehicles[v.InstanceID] {
+			add(Removed, "Vehicle %s removed", v.Name)
+		}
+	}
+
+	oldMembers := placeMembers(old)
+	newMembers := placeMembers(new)
+	for _, p := range newMembers {
+		before, ok := findMember(oldMembers, p.member.ID)
+		if !ok {
+			add(Added, "%s added to %s", memberLabel(p.member), p.location)
+			continue
+		}
+		if memberLabel(before.member) != memberLabel(p.member) {
+			add(Changed, "%s is now %s", memberLabel(before.member), memberLabel(p.member))
+		}
+		if before.place != p.place {
+			add(Changed, "%s moved from %s to %s", memberLabel(p.member), before.location, p.location)
+		}
+		gained, lost := weaponChanges(before.member.Weapons, p.member.Weapons)
+		switch {
+		case len(gained) > 0 && len(lost) > 0:
+			add(Changed, "%s: %s swapped for %s", memberLabel(p.member), strings.Join(lost, ", "), strings.Join(gained, ", "))
+		case len(gained) > 0:
+			add(Changed, "%s: %s added", memberLabel(p.member), strings.Join(gained, ", "))
+		case len(lost) > 0:
+			add(Changed, "%s: %s removed", memberLabel(p.member), strings.Join(lost, ", "))
+		}
+	}
+	for _, p := range oldMembers {
+		if _, ok := findMember(newMembers, p.member.ID); !ok {
+			add(Removed, "%s removed from %s", memberLabel(p.member), p.location)
+		}
+	}
+
+	return changes
+}
+
+// placedMember is a member together with where it sits in the group. place
+// identifies the team or vehicle, and location describes it.
+type placedMember struct {
+	member   models.Member
+	place    string
+	location string
+}
+
+func placeMembers(g models.GroupDetails) []placedMember {
+	var placed []placedMember
+	for _, m := range g.DirectMembers {
+		placed = append(placed, placedMember{m, "group", "the group"})
+	}
+	for _, t := range g.Teams {
+		for _, m := range t.Members {
+			placed = append(placed, placedMember{m, fmt.Sprintf("team %d", t.ID), fmt.Sprintf("team %q", t.Name)})
+		}
+	}
+	for _, v := range g.Vehicles {
+		for _, m := range v.Crew {
+			placed = append(placed, placedMember{m, fmt.Sprintf("vehicle %d", v.InstanceID), "the crew of " + v.Name})
+		}
+	}
+	return placed
+}
+
+func findMember(placed []placedMember, id int) (placedMember, bool) {
+	for _, p := range placed {
+		if p.member.ID == id {
+			return p, true
+		}
+	}
+	return placedMember{}, false
+}
+
+func memberLabel(m models.Member) string {
+	if m.Rank == "" {
+		return m.Role
+	}
+	return fmt.Sprintf("%s (%s)", m.Role, m.Rank)
+}
+
+func parentLabel(parentID int) string {
+	if parentID == 0 {
+		return "the top level"
+	}
+	return fmt.Sprintf("under group %d", parentID)
+}
+
+// weaponChanges returns the names of the weapons in new but not old, and in
+// old but not new, counting each copy of a weapon
+func weaponChanges(old, new []models.Weapon) (gained, lost []string) {
+	counts := make(map[int]int)
+	for _, w := range old {
+		counts[w.ID]++
+	}
+	for _, w := range new {
+		if counts[w.ID] > 0 {
+			counts[w.ID]--
+		} else {
+			gained = append(gained, w.Name)
+		}
+	}
+	for _, w := range old {
+		if counts[w.ID] > 0 {
+			counts[w.ID]--
+			lost = append(lost, w.Name)
+		}
+	}
+	return gained, lost
+}
@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"orbat/internal/models"
+)
+
+func TestGroups(t *testing.T) {
+	m4 := models.Weapon{ID: 1, Name: "M4"}
+	m249 := models.Weapon{ID: 2, Name: "M249"}
+	m320 := models.Weapon{ID: 3, Name: "M320"}
+
+	old := models.GroupDetails{
+		Name:          "Squad",
+		Nationality:   "United States",
+		DirectMembers: []models.Member{{ID: 1, Role: "Squad Leader", Rank: "SSG", Weapons: []models.Weapon{m4}}},
+		Teams: []models.Team{
+			{ID: 1, Name: "Alpha", Members: []models.Member{
+				{ID: 2, Role: "Automatic Rifleman", Rank: "SPC", Weapons: []models.Weapon{m249}},
+				{ID: 3, Role: "Grenadier", Rank: "PFC", Weapons: []models.Weapon{m4, m320}},
+			}},
+			{ID: 2, Name: "Bravo"},
+		},
+		Vehicles: []models.Vehicle{{ID: "1", InstanceID: 1, Name: "HMMWV"}},
+	}
+	new := models.GroupDetails{
+		Name:        "1st Squad",
+		Nationality: "United States",
+		ParentID:    7,
+		Teams: []models.Team{
+			{ID: 1, Name: "Alpha Team", Members: []models.Member{
+				{ID: 1, Role: "Squad Leader", Rank: "SSG", Weapons: []models.Weapon{m4}},
+				{ID: 2, Role: "Automatic Rifleman", Rank: "SPC", Weapons: []models.Weapon{m4}},
+				{ID: 4, Role: "Rifleman", Rank: "PVT"},
+			}},
+		},
+		Vehicles: []models.Vehicle{{ID: "2", InstanceID: 1, Name: "JLTV"}},
+	}
+
+	expected := []Change{
+		{Changed, `Renamed from "Squad" to "1st Squad"`},
+		{Changed, "Moved from the top level to under group 7"},
+		{Changed, `Team "Alpha" renamed to "Alpha Team"`},
+		{Removed, `Team "Bravo" removed`},
+		{Changed, "Vehicle HMMWV replaced by JLTV"},
+		{Changed, `Squad Leader (SSG) moved from the group to team "Alpha Team"`},
+		{Changed, "Automatic Rifleman (SPC): M249 swapped for M4"},
+		{Added, `Rifleman (PVT) added to team "Alpha Team"`},
+		{Removed, `Grenadier (PFC) removed from team "Alpha"`},
+	}
+	if changes := Groups(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+
+	if changes := Groups(new, new); len(changes) != 0 {
+		t.Errorf("Expected no changes between equal groups, got %v", changes)
+	}
+}
@@ -0,0 +1,216 @@
+// Package document reads and writes groups in the ORBAT interchange formats
+// described by Json/schema.json and Text/schema.txt
+package document
+
+import (
+	"fmt"
+	"strconv"
+
+	"orbat/internal/models"
+)
+
+// Group is a group as written in an ORBAT document. Members, teams and
+// vehicle instances are keyed by a label in the documents, so the labels are
+// kept alongside each entry and the order is preserved. ParentID is the ID of
+// the group it is subordinate to, or 0.
+type Group struct {
+	ID          int
+	Name        string
+	Nationality string
+	Size        int
+	ParentID    int
+	Members     []Member
+	Teams       []Team
+	Vehicles    []VehicleInstance
+}
+
+// Member is a member of a group, team or vehicle crew
+type Member struct {
+	Label   string
+	ID      int
+	Role    string
+	Rank    string
+	Weapons []Weapon
+}
+
+// Weapon is a weapon carried by a member. Weapons are matched by name on import.
+type Weapon struct {
+	ID       int    `json:"weapon_id,omitempty"`
+	Name     string `json:"weapon_name"`
+	Type     string `json:"weapon_type"`
+	Caliber  string `json:"caliber"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Team is a team within a group
+type Team struct {
+	Label   string
+	ID      int
+	Name    string
+	Size    int
+	Members []Member
+}
+
+// Vehicle is a vehicle type. Vehicles are matched by name on import.
+type Vehicle struct {
+	ID       int    `json:"vehicle_id,omitempty"`
+	Name     string `json:"vehicle_name"`
+	Type     string `json:"vehicle_type"`
+	Armament string `json:"vehicle_armament"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// VehicleInstance is a group's copy of a vehicle together with its crew
+type VehicleInstance struct {
+	Label      string
+	InstanceID int
+	Vehicle    Vehicle
+	Crew       []Member
+}
+
+// GroupDetails converts the document group into the structure used by the
+// database package. Weapons and vehicles carry their names but no IDs, so
+// they must be resolved before the group can be stored. The group keeps its
+// ID from the document, so that a parent in the same document can be found.
+func (g Group) GroupDetails() models.GroupDetails {
+	details := models.GroupDetails{
+		Name:        g.Name,
+		Nationality: g.Nationality,
+		ParentID:    g.ParentID,
+	}
+	if g.ID != 0 {
+		details.ID = strconv.Itoa(g.ID)
+	}
+
+	for _, m := range g.Members {
+		details.DirectMembers = append(details.DirectMembers, m.member())
+	}
+	for _, t := range g.Teams {
+		team := models.Team{Name: t.Name, Size: len(t.Members)}
+		for _, m := range t.Members {
+			team.Members = append(team.Members, m.member())
+		}
+		details.Teams = append(details.Teams, team)
+	}
+	for _, v := range g.Vehicles {
+		vehicle := models.Vehicle{
+			Name:     v.Vehicle.Name,
+			Type:     v.Vehicle.Type,
+			Armament: v.Vehicle.Armament,
+		}
+		if v.Vehicle.Name == "" && v.Vehicle.ID != 0 {
+			vehicle.ID = strconv.Itoa(v.Vehicle.ID)
+		}
+		for _, m := range v.Crew {
+			vehicle.Crew = append(vehicle.Crew, m.member())
+		}
+		details.Vehicles = append(details.Vehicles, vehicle)
+	}
+
+	return details
+}
+
+func (m Member) member() models.Member {
+	member := models.Member{Role: m.Role, Rank: m.Rank}
+	for _, w := range m.Weapons {
+		weapon := models.Weapon{Name: w.Name, Type: w.Type, Caliber: w.Caliber}
+		if w.Name == "" {
+			weapon.ID = w.ID
+		}
+		member.Weapons = append(member.Weapons, weapon)
+	}
+	return member
+}
+
+// FromGroupDetails converts a group loaded by the database package into a
+// document group. Members are labelled by role, numbering repeated roles as
+// in "Rifleman #1", "Rifleman #2", and vehicle instances by vehicle name.
+func FromGroupDetails(details models.GroupDetails) Group {
+	id, _ := strconv.Atoi(details.ID)
+	group := Group{
+		ID:          id,
+		Name:        details.Name,
+		Nationality: details.Nationality,
+		Size:        details.Size,
+		ParentID:    details.ParentID,
+		Members:     fromMembers(details.DirectMembers),
+	}
+
+	for _, t := range details.Teams {
+		group.Teams = append(group.Teams, Team{
+			Label:   t.Name,
+			ID:      t.ID,
+			Name:    t.Name,
+			Size:    t.Size,
+			Members: fromMembers(t.Members),
+		})
+	}
+
+	names := make([]string, len(details.Vehicles))
+	for i, v := range details.Vehicles {
+		names[i] = v.Name
+	}
+	vehicleLabels := numberedLabels(names)
+	for i, v := range details.Vehicles {
+		vehicleID, _ := strconv.Atoi(v.ID)
+		group.Vehicles = append(group.Vehicles, VehicleInstance{
+			Label:      vehicleLabels[i],
+			InstanceID: v.InstanceID,
+			Vehicle: Vehicle{
+				ID:       vehicleID,
+				Name:     v.Name,
+				Type:     v.Type,
+				Armament: v.Armament,
+				ImageURL: v.ImageURL.String,
+			},
+			Crew: fromMembers(v.Crew),
+		})
+	}
+
+	return group
+}
+
+func fromMembers(members []models.Member) []Member {
+	roles := make([]string, len(members))
+	for i, m := range members {
+		roles[i] = m.Role
+	}
+	labels := numberedLabels(roles)
+
+	var result []Member
+	for i, m := range members {
+		member := Member{Label: labels[i], ID: m.ID, Role: m.Role, Rank: m.Rank}
+		for _, w := range m.Weapons {
+			member.Weapons = append(member.Weapons, Weapon{
+				ID:       w.ID,
+				Name:     w.Name,
+				Type:     w.Type,
+				Caliber:  w.Caliber,
+				ImageURL: w.ImageURL.String,
+			})
+		}
+		result = append(result, member)
+	}
+	return result
+}
+
+// numberedLabels returns the names as labels, numbering names that occur
+// more than once
+func numberedLabels(names []string) []string {
+	counts := make(map[string]int)
+	for _, name := range names {
+		counts[name]++
+	}
+
+	seen := make(map[string]int)
+	labels := make([]string, len(names))
+	for i, name := range names {
+		if counts[name] == 1 {
+			labels[i] = name
+			continue
+		}
+		seen[name]++
+		labels[i] = fmt.Sprintf("%s #%d", name, seen[name])
+	}
+	return labels
+}
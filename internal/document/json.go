@@ -0,0 +1,449 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// teamsKey is the key inside group_members that holds the group's teams
+const teamsKey = "teams"
+
+// ParseJSON reads either a single group or an array of groups
+func ParseJSON(data []byte) ([]Group, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("document is empty")
+	}
+
+	var groups []Group
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &groups); err != nil {
+			return nil, err
+		}
+	} else {
+		var group Group
+		if err := json.Unmarshal(data, &group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	for i, g := range groups {
+		if err := g.Validate(); err != nil {
+			if len(groups) > 1 {
+				return nil, fmt.Errorf("group %d: %v", i+1, err)
+			}
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+// Validate checks that the fields needed to create the group are present
+func (g Group) Validate() error {
+	if strings.TrimSpace(g.Name) == "" {
+		return fmt.Errorf("group_name is required")
+	}
+	if strings.TrimSpace(g.Nationality) == "" {
+		return fmt.Errorf("group_nationality is required")
+	}
+
+	checkMembers := func(path string, members []Member) error {
+		for _, m := range members {
+			if strings.TrimSpace(m.Role) == "" {
+				return fmt.Errorf("%s.%s: member_role is required", path, m.Label)
+			}
+			for _, w := range m.Weapons {
+				if strings.TrimSpace(w.Name) == "" && w.ID == 0 {
+					return fmt.Errorf("%s.%s: member_weapon needs a weapon_name", path, m.Label)
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := checkMembers("group_members", g.Members); err != nil {
+		return err
+	}
+	for _, t := range g.Teams {
+		if strings.TrimSpace(t.Name) == "" {
+			return fmt.Errorf("group_members.teams.%s: team_name is required", t.Label)
+		}
+		if err := checkMembers("group_members.teams."+t.Label+".team_members", t.Members); err != nil {
+			return err
+		}
+	}
+	for _, v := range g.Vehicles {
+		if strings.TrimSpace(v.Vehicle.Name) == "" && v.Vehicle.ID == 0 {
+			return fmt.Errorf("group_vehicles.%s: Vehicle needs a vehicle_name", v.Label)
+		}
+		if err := checkMembers("group_vehicles."+v.Label+".vehicle_members", v.Crew); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type groupFields struct {
+	ID          int             `json:"group_id,omitempty"`
+	Name        string          `json:"group_name"`
+	Nationality string          `json:"group_nationality"`
+	Size        int             `json:"group_size"`
+	ParentID    int             `json:"parent_group_id,omitempty"`
+	Members     json.RawMessage `json:"group_members,omitempty"`
+	Vehicles    json.RawMessage `json:"group_vehicles,omitempty"`
+}
+
+// UnmarshalJSON decodes a group, keeping the order of labelled entries
+func (g *Group) UnmarshalJSON(data []byte) error {
+	var fields groupFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*g = Group{
+		ID:          fields.ID,
+		Name:        fields.Name,
+		Nationality: fields.Nationality,
+		Size:        fields.Size,
+		ParentID:    fields.ParentID,
+	}
+
+	if len(fields.Members) > 0 {
+		err := decodeObject(fields.Members, func(label string, value json.RawMessage) error {
+			if label == teamsKey {
+				return decodeObject(value, func(label string, value json.RawMessage) error {
+					var team Team
+					if err := json.Unmarshal(value, &team); err != nil {
+						return fmt.Errorf("group_members.teams.%s: %v", label, err)
+					}
+					team.Label = label
+					g.Teams = append(g.Teams, team)
+					return nil
+				})
+			}
+
+			var m Member
+			if err := json.Unmarshal(value, &m); err != nil {
+				return fmt.Errorf("group_members.%s: %v", label, err)
+			}
+			m.Label = label
+			g.Members = append(g.Members, m)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(fields.Vehicles) > 0 {
+		err := decodeObject(fields.Vehicles, func(label string, value json.RawMessage) error {
+			var v VehicleInstance
+			if err := json.Unmarshal(value, &v); err != nil {
+				return fmt.Errorf("group_vehicles.%s: %v", label, err)
+			}
+			v.Label = label
+			g.Vehicles = append(g.Vehicles, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes a group with its labelled members, teams and vehicles
+func (g Group) MarshalJSON() ([]byte, error) {
+	members := make(orderedObject, 0, len(g.Members)+1)
+	labels := newLabeler()
+	labels.used[teamsKey] = true
+	for _, m := range g.Members {
+		members = append(members, objectField{labels.label(m.Label, m.Role), m})
+	}
+	if len(g.Teams) > 0 {
+		teams := make(orderedObject, 0, len(g.Teams))
+		teamLabels := newLabeler()
+		for _, t := range g.Teams {
+			teams = append(teams, objectField{teamLabels.label(t.Label, t.Name), t})
+		}
+		members = append(members, objectField{teamsKey, teams})
+	}
+
+	var vehicles orderedObject
+	vehicleLabels := newLabeler()
+	for _, v := range g.Vehicles {
+		vehicles = append(vehicles, objectField{vehicleLabels.label(v.Label, v.Vehicle.Name), v})
+	}
+
+	fields := struct {
+		groupFields
+		Members  orderedObject `json:"group_members"`
+		Vehicles orderedObject `json:"group_vehicles,omitempty"`
+	}{
+		groupFields: groupFields{
+			ID:          g.ID,
+			Name:        g.Name,
+			Nationality: g.Nationality,
+			Size:        g.Size,
+			ParentID:    g.ParentID,
+		},
+		Members:  members,
+		Vehicles: vehicles,
+	}
+	return json.Marshal(fields)
+}
+
+type memberFields struct {
+	ID      int             `json:"member_id,omitempty"`
+	Role    string          `json:"member_role"`
+	Rank    string          `json:"member_rank"`
+	Weapons json.RawMessage `json:"member_weapon,omitempty"`
+}
+
+// UnmarshalJSON decodes a member. member_weapon may be a single weapon object
+// as in Json/schema.json or an array of weapons.
+func (m *Member) UnmarshalJSON(data []byte) error {
+	var fields memberFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*m = Member{ID: fields.ID, Role: fields.Role, Rank: fields.Rank}
+
+	weapons := bytes.TrimSpace(fields.Weapons)
+	switch {
+	case len(weapons) == 0 || bytes.Equal(weapons, []byte("null")):
+	case weapons[0] == '[':
+		if err := json.Unmarshal(weapons, &m.Weapons); err != nil {
+			return fmt.Errorf("member_weapon: %v", err)
+		}
+	default:
+		var w Weapon
+		if err := json.Unmarshal(weapons, &w); err != nil {
+			return fmt.Errorf("member_weapon: %v", err)
+		}
+		m.Weapons = []Weapon{w}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes a member, writing member_weapon as an object when the
+// member carries one weapon and as an array when it carries several
+func (m Member) MarshalJSON() ([]byte, error) {
+	fields := memberFields{ID: m.ID, Role: m.Role, Rank: m.Rank}
+
+	var err error
+	switch len(m.Weapons) {
+	case 0:
+	case 1:
+		fields.Weapons, err = json.Marshal(m.Weapons[0])
+	default:
+		fields.Weapons, err = json.Marshal(m.Weapons)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
+
+type teamFields struct {
+	ID      int             `json:"team_id,omitempty"`
+	Name    string          `json:"team_name"`
+	Size    int             `json:"team_size"`
+	Members json.RawMessage `json:"team_members,omitempty"`
+}
+
+// UnmarshalJSON decodes a team, keeping the order of its members
+func (t *Team) UnmarshalJSON(data []byte) error {
+	var fields teamFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*t = Team{ID: fields.ID, Name: fields.Name, Size: fields.Size}
+
+	members, err := decodeMembers(fields.Members)
+	if err != nil {
+		return fmt.Errorf("team_members.%v", err)
+	}
+	t.Members = members
+	return nil
+}
+
+// MarshalJSON encodes a team with its labelled members
+func (t Team) MarshalJSON() ([]byte, error) {
+	members, err := encodeMembers(t.Members)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(teamFields{ID: t.ID, Name: t.Name, Size: t.Size, Members: members})
+}
+
+type vehicleInstanceFields struct {
+	InstanceID int             `json:"instance_id,omitempty"`
+	Vehicle    Vehicle         `json:"Vehicle"`
+	Crew       json.RawMessage `json:"vehicle_members,omitempty"`
+}
+
+// UnmarshalJSON decodes a vehicle instance, keeping the order of its crew
+func (v *VehicleInstance) UnmarshalJSON(data []byte) error {
+	var fields vehicleInstanceFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*v = VehicleInstance{InstanceID: fields.InstanceID, Vehicle: fields.Vehicle}
+
+	crew, err := decodeMembers(fields.Crew)
+	if err != nil {
+		return fmt.Errorf("vehicle_members.%v", err)
+	}
+	v.Crew = crew
+	return nil
+}
+
+// MarshalJSON encodes a vehicle instance with its labelled crew
+func (v VehicleInstance) MarshalJSON() ([]byte, error) {
+	crew, err := encodeMembers(v.Crew)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(vehicleInstanceFields{InstanceID: v.InstanceID, Vehicle: v.Vehicle, Crew: crew})
+}
+
+// decodeMembers decodes a JSON object of labelled members
+func decodeMembers(data json.RawMessage) ([]Member, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var members []Member
+	err := decodeObject(data, func(label string, value json.RawMessage) error {
+		var m Member
+		if err := json.Unmarshal(value, &m); err != nil {
+			return fmt.Errorf("%s: %v", label, err)
+		}
+		m.Label = label
+		members = append(members, m)
+		return nil
+	})
+	return members, err
+}
+
+// encodeMembers encodes members as a JSON object keyed by their labels
+func encodeMembers(members []Member) (json.RawMessage, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	object := make(orderedObject, 0, len(members))
+	labels := newLabeler()
+	for _, m := range members {
+		object = append(object, objectField{labels.label(m.Label, m.Role), m})
+	}
+	return json.Marshal(object)
+}
+
+// decodeObject calls fn for each key of a JSON object in document order
+func decodeObject(data []byte, fn func(key string, value json.RawMessage) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected an object")
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+
+	_, err = decoder.Token()
+	return err
+}
+
+// objectField is a key and value of an orderedObject
+type objectField struct {
+	Key   string
+	Value interface{}
+}
+
+// orderedObject is a JSON object that keeps the order of its keys
+type orderedObject []objectField
+
+// MarshalJSON encodes the fields in order
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// labeler produces unique labels for entries of a JSON object, numbering
+// repeated names as in "Rifleman #1", "Rifleman #2"
+type labeler struct {
+	used map[string]bool
+}
+
+func newLabeler() *labeler {
+	return &labeler{used: make(map[string]bool)}
+}
+
+// label returns the preferred label if it is set and unused, and otherwise
+// derives a unique label from name
+func (l *labeler) label(preferred, name string) string {
+	if preferred != "" && !l.used[preferred] {
+		l.used[preferred] = true
+		return preferred
+	}
+	if name == "" {
+		name = "Unnamed"
+	}
+	if !l.used[name] {
+		l.used[name] = true
+		return name
+	}
+	for n := 2; ; n++ {
+		label := fmt.Sprintf("%s #%d", name, n)
+		if !l.used[label] {
+			l.used[label] = true
+			return label
+		}
+	}
+}
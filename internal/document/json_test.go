@@ -0,0 +1,328 @@
+package document
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONExample(t *testing.T) {
+	data, err := os.ReadFile("../../Json/example.json")
+	if err != nil {
+		t.Fatalf("Failed to read example: %v", err)
+	}
+
+	groups, err := ParseJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to parse example: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 group, got %d", len(groups))
+	}
+
+	g := groups[0]
+	if g.Name != "Ranger Rifle Squad" || g.Nationality != "United States of America" || g.Size != 9 {
+		t.Errorf("Unexpected group fields: %+v", g)
+	}
+	if len(g.Members) != 1 || g.Members[0].Label != "Squad Leader" {
+		t.Fatalf("Expected the squad leader as the only direct member, got %+v", g.Members)
+	}
+	if len(g.Teams) != 2 || g.Teams[0].Label != "Alpha" {
+		t.Fatalf("Expected teams Alpha and Bravo, got %+v", g.Teams)
+	}
+	if w := g.Teams[0].Members[1].Weapons; len(w) != 1 || w[0].Name != "M249" || w[0].ID != 2 {
+		t.Errorf("Expected the automatic rifleman to carry an M249, got %v", w)
+	}
+}
+
+func TestParseJSONSchemaShapes(t *testing.T) {
+	data := []byte(`{
+		"group_id": 4,
+		"group_name": "Mech Platoon",
+		"group_nationality": "Germany",
+		"group_size": 4,
+		"group_members": {
+			"Leader": {
+				"member_id": 1,
+				"member_role": "Leader",
+				"member_rank": "Lt",
+				"member_weapon": {"weapon_id": 3, "weapon_name": "P8", "weapon_type": "Pistol", "caliber": "9mm"}
+			},
+			"Gunner": {
+				"member_role": "Gunner",
+				"member_rank": "Cpl",
+				"member_weapon": [
+					{"weapon_name": "MG5", "weapon_type": "Machine Gun", "caliber": "7.62mm"},
+					{"weapon_name": "P8", "weapon_type": "Pistol", "caliber": "9mm"}
+				]
+			},
+			"Medic": {"member_role": "Medic", "member_rank": "Pvt"},
+			"teams": {
+				"Alpha": {
+					"team_id": 2,
+					"team_name": "Alpha",
+					"team_size": 1,
+					"team_members": {
+						"Rifleman": {"member_role": "Rifleman", "member_rank": "Pvt", "member_weapon": null}
+					}
+				}
+			}
+		},
+		"group_vehicles": {
+			"Puma #2": {
+				"instance_id": 7,
+				"Vehicle": {"vehicle_id": 5, "vehicle_name": "Puma", "vehicle_type": "IFV", "vehicle_armament": "30mm"},
+				"vehicle_members": {
+					"Driver": {"member_role": "Driver", "member_rank": "Pvt"}
+				}
+			}
+		}
+	}`)
+
+	groups, err := ParseJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to parse document: %v", err)
+	}
+
+	want := Group{
+		ID:          4,
+		Name:        "Mech Platoon",
+		Nationality: "Germany",
+		Size:        4,
+		Members: []Member{
+			{Label: "Leader", ID: 1, Role: "Leader", Rank: "Lt", Weapons: []Weapon{
+				{ID: 3, Name: "P8", Type: "Pistol", Caliber: "9mm"},
+			}},
+			{Label: "Gunner", Role: "Gunner", Rank: "Cpl", Weapons: []Weapon{
+				{Name: "MG5", Type: "Machine Gun", Caliber: "7.62mm"},
+				{Name: "P8", Type: "Pistol", Caliber: "9mm"},
+			}},
+			{Label: "Medic", Role: "Medic", Rank: "Pvt"},
+		},
+		Teams: []Team{{
+			Label:   "Alpha",
+			ID:      2,
+			Name:    "Alpha",
+			Size:    1,
+			Members: []Member{{Label: "Rifleman", Role: "Rifleman", Rank: "Pvt"}},
+		}},
+		Vehicles: []VehicleInstance{{
+			Label:      "Puma #2",
+			InstanceID: 7,
+			Vehicle:    Vehicle{ID: 5, Name: "Puma", Type: "IFV", Armament: "30mm"},
+			Crew:       []Member{{Label: "Driver", Role: "Driver", Rank: "Pvt"}},
+		}},
+	}
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0], want) {
+		t.Errorf("Unexpected group:\n got %+v\nwant %+v", groups, want)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	groups := []Group{
+		{
+			ID:          3,
+			Name:        "Mech Platoon",
+			Nationality: "Germany",
+			Size:        3,
+			ParentID:    9,
+			Members: []Member{
+				{Label: "Leader", Role: "Leader", Rank: "Lt", Weapons: []Weapon{
+					{Name: "P8", Type: "Pistol", Caliber: "9mm"},
+				}},
+				{Label: "Gunner", Role: "Gunner", Rank: "Cpl", Weapons: []Weapon{
+					{Name: "MG5", Type: "Machine Gun", Caliber: "7.62mm"},
+					{Name: "P8", Type: "Pistol", Caliber: "9mm"},
+				}},
+			},
+			Teams: []Team{{
+				Label:   "Alpha",
+				Name:    "Alpha",
+				Size:    1,
+				Members: []Member{{Label: "Rifleman", Role: "Rifleman", Rank: "Pvt"}},
+			}},
+			Vehicles: []VehicleInstance{{
+				Label:      "Puma",
+				InstanceID: 7,
+				Vehicle:    Vehicle{Name: "Puma", Type: "IFV", Armament: "30mm"},
+				Crew:       []Member{{Label: "Driver", Role: "Driver", Rank: "Pvt"}},
+			}},
+		},
+		{ID: 9, Name: "HQ", Nationality: "Germany"},
+	}
+
+	data, err := json.Marshal(groups)
+	if err != nil {
+		t.Fatalf("Failed to marshal groups: %v", err)
+	}
+	parsed, err := ParseJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to parse marshalled groups: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(parsed, groups) {
+		t.Errorf("Round trip changed the groups:\n got %+v\nwant %+v", parsed, groups)
+	}
+
+	// a single weapon is written as an object and several as an array
+	text := string(data)
+	if !strings.Contains(text, `"member_weapon":{"weapon_name":"P8"`) {
+		t.Errorf("Expected a single weapon to be written as an object:\n%s", text)
+	}
+	if !strings.Contains(text, `"member_weapon":[{"weapon_name":"MG5"`) {
+		t.Errorf("Expected several weapons to be written as an array:\n%s", text)
+	}
+}
+
+func TestMarshalJSONLabels(t *testing.T) {
+	group := Group{
+		Name:        "Squad",
+		Nationality: "US",
+		Members: []Member{
+			{Role: "Rifleman", Rank: "Pvt"},
+			{Role: "Rifleman", Rank: "Pvt"},
+			{Label: "teams", Role: "Clerk", Rank: "Pvt"},
+		},
+	}
+
+	data, err := json.Marshal(group)
+	if err != nil {
+		t.Fatalf("Failed to marshal group: %v", err)
+	}
+	parsed, err := ParseJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to parse marshalled group: %v\n%s", err, data)
+	}
+
+	var labels []string
+	for _, m := range parsed[0].Members {
+		labels = append(labels, m.Label)
+	}
+	want := []string{"Rifleman", "Rifleman #2", "Clerk"}
+	if !reflect.DeepEqual(labels, want) || len(parsed[0].Teams) != 0 {
+		t.Errorf("Expected labels %v and no teams, got %v and %d teams", want, labels, len(parsed[0].Teams))
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"empty", "  ", "document is empty"},
+		{"missing name", `{"group_nationality": "US"}`, "group_name is required"},
+		{"missing nationality", `{"group_name": "G"}`, "group_nationality is required"},
+		{"missing role", `{"group_name": "G", "group_nationality": "US", "group_members": {"A": {"member_rank": "Pvt"}}}`, "group_members.A: member_role is required"},
+		{"unnamed weapon", `{"group_name": "G", "group_nationality": "US", "group_members": {"A": {"member_role": "R", "member_weapon": {"caliber": "9mm"}}}}`, "member_weapon needs a weapon_name"},
+		{"bad weapon", `{"group_name": "G", "group_nationality": "US", "group_members": {"A": {"member_role": "R", "member_weapon": "M4"}}}`, "group_members.A: member_weapon"},
+		{"members not an object", `{"group_name": "G", "group_nationality": "US", "group_members": []}`, "expected an object"},
+		{"unnamed vehicle", `{"group_name": "G", "group_nationality": "US", "group_vehicles": {"V": {"Vehicle": {}}}}`, "group_vehicles.V: Vehicle needs a vehicle_name"},
+		{"second group", `[{"group_name": "G", "group_nationality": "US"}, {"group_name": "H"}]`, "group 2: group_nationality is required"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseJSON([]byte(tt.json))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestMarshalJSONMatchesSchema(t *testing.T) {
+	data, err := os.ReadFile("../../Json/schema.json")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+
+	// properties returns the property names of the schema object at path
+	properties := func(path ...string) map[string]bool {
+		node := schema
+		for _, key := range path {
+			node = node[key].(map[string]interface{})
+		}
+		names := make(map[string]bool)
+		for name := range node["properties"].(map[string]interface{}) {
+			names[name] = true
+		}
+		return names
+	}
+	groupKeys := properties("Group")
+	memberKeys := properties("Group", "properties", "group_members", "properties", "Member")
+	teamKeys := properties("Group", "properties", "group_members", "properties", "Team")
+	instanceKeys := properties("Group", "properties", "group_vehicles", "properties", "Vehicle Instance")
+	vehicleKeys := properties("Group", "properties", "group_vehicles", "properties", "Vehicle Instance", "properties", "Vehicle")
+	weaponKeys := properties("Weapon")
+
+	group := Group{
+		ID:          1,
+		Name:        "Mech Platoon",
+		Nationality: "Germany",
+		Size:        2,
+		Members: []Member{{ID: 1, Role: "Leader", Rank: "Lt", Weapons: []Weapon{
+			{ID: 3, Name: "P8", Type: "Pistol", Caliber: "9mm"},
+		}}},
+		Teams: []Team{{ID: 2, Name: "Alpha", Size: 1, Members: []Member{{ID: 2, Role: "Gunner", Rank: "Cpl", Weapons: []Weapon{
+			{ID: 4, Name: "MG5", Type: "Machine Gun", Caliber: "7.62mm"},
+			{ID: 3, Name: "P8", Type: "Pistol", Caliber: "9mm"},
+		}}}}},
+		Vehicles: []VehicleInstance{{
+			InstanceID: 7,
+			Vehicle:    Vehicle{ID: 5, Name: "Puma", Type: "IFV", Armament: "30mm"},
+			Crew:       []Member{{ID: 3, Role: "Driver", Rank: "Pvt"}},
+		}},
+	}
+	data, err = json.Marshal(group)
+	if err != nil {
+		t.Fatalf("Failed to marshal group: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Failed to decode marshalled group: %v", err)
+	}
+
+	checkKeys := func(what string, object interface{}, allowed map[string]bool) {
+		for key := range object.(map[string]interface{}) {
+			if !allowed[key] {
+				t.Errorf("%s has key %q, which is not in the schema", what, key)
+			}
+		}
+	}
+	checkMember := func(what string, member interface{}) {
+		checkKeys(what, member, memberKeys)
+		switch weapons := member.(map[string]interface{})["member_weapon"].(type) {
+		case map[string]interface{}:
+			checkKeys(what+" weapon", weapons, weaponKeys)
+		case []interface{}:
+			for _, w := range weapons {
+				checkKeys(what+" weapon", w, weaponKeys)
+			}
+		}
+	}
+
+	checkKeys("group", doc, groupKeys)
+	for label, value := range doc["group_members"].(map[string]interface{}) {
+		if label == teamsKey {
+			for label, team := range value.(map[string]interface{}) {
+				checkKeys("team "+label, team, teamKeys)
+				for label, member := range team.(map[string]interface{})["team_members"].(map[string]interface{}) {
+					checkMember("team member "+label, member)
+				}
+			}
+			continue
+		}
+		checkMember("member "+label, value)
+	}
+	for label, instance := range doc["group_vehicles"].(map[string]interface{}) {
+		checkKeys("vehicle instance "+label, instance, instanceKeys)
+		checkKeys("vehicle "+label, instance.(map[string]interface{})["Vehicle"], vehicleKeys)
+		for label, member := range instance.(map[string]interface{})["vehicle_members"].(map[string]interface{}) {
+			checkMember("crew member "+label, member)
+		}
+	}
+}
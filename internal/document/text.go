@@ -0,0 +1,503 @@
+package document
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The outline format of Text/schema.txt writes each entry as a line
+// "> Label - Kind" followed by its "key = value" properties, with nested
+// entries indented below it:
+//
+//	> Ranger Rifle Squad - Group
+//	    group_name = Ranger Rifle Squad
+//	    > group_members
+//	        > Squad Leader - Member
+//	            member_role = Group Leader
+//
+// Sections such as group_members have no kind. Indentation only needs to be
+// consistent; tabs count as four spaces.
+
+// textIndent is the indentation written for each level of the outline
+const textIndent = "    "
+
+// LineError reports a malformed line of an outline document
+type LineError struct {
+	Line    int
+	Message string
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func lineErrorf(line int, format string, args ...interface{}) error {
+	return &LineError{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// outlineNode is an entry of an outline document with its properties and
+// nested entries
+type outlineNode struct {
+	line        int
+	indent      int
+	childIndent int
+	label       string
+	kind        string
+	properties  []outlineProperty
+	children    []*outlineNode
+}
+
+type outlineProperty struct {
+	line  int
+	key   string
+	value string
+}
+
+// ParseText reads the groups of an outline document
+func ParseText(data []byte) ([]Group, error) {
+	roots, err := parseOutline(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("document is empty")
+	}
+
+	var groups []Group
+	for _, node := range roots {
+		if node.kind != "Group" {
+			return nil, lineErrorf(node.line, "expected a Group, found %q", node.label)
+		}
+		group, err := textGroup(node)
+		if err != nil {
+			return nil, err
+		}
+		if err := group.Validate(); err != nil {
+			return nil, lineErrorf(node.line, "%v", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// parseOutline splits the document into a tree of entries. The lines
+// directly inside an entry must all have the same indentation.
+func parseOutline(data []byte) ([]*outlineNode, error) {
+	root := &outlineNode{indent: -1, childIndent: -1}
+	stack := []*outlineNode{root}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		raw := strings.ReplaceAll(scanner.Text(), "\t", textIndent)
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+
+		// Close the entries this line is not nested in
+		for stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		if parent.childIndent < 0 {
+			parent.childIndent = indent
+		} else if parent.childIndent != indent {
+			return nil, lineErrorf(lineNumber, "indentation does not line up with the lines above")
+		}
+
+		if strings.HasPrefix(text, ">") {
+			node := &outlineNode{line: lineNumber, indent: indent, childIndent: -1}
+			node.label = strings.TrimSpace(strings.TrimPrefix(text, ">"))
+			if i := strings.LastIndex(node.label, " - "); i >= 0 {
+				node.kind = strings.TrimSpace(node.label[i+3:])
+				node.label = strings.TrimSpace(node.label[:i])
+			}
+			if node.label == "" {
+				return nil, lineErrorf(lineNumber, "entry has no name")
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+			continue
+		}
+
+		if parent == root {
+			return nil, lineErrorf(lineNumber, "property outside of an entry")
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, lineErrorf(lineNumber, "expected \"key = value\" or \"> Name - Kind\", found %q", text)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, lineErrorf(lineNumber, "property has no name")
+		}
+		parent.properties = append(parent.properties, outlineProperty{
+			line:  lineNumber,
+			key:   key,
+			value: strings.TrimSpace(value),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return root.children, nil
+}
+
+// setProperties assigns the node's properties to the string and integer
+// fields named by their keys
+func (n *outlineNode) setProperties(texts map[string]*string, ints map[string]*int) error {
+	for _, p := range n.properties {
+		if field, ok := texts[p.key]; ok {
+			*field = p.value
+			continue
+		}
+		if field, ok := ints[p.key]; ok {
+			if p.value == "" {
+				continue
+			}
+			value, err := strconv.Atoi(p.value)
+			if err != nil {
+				return lineErrorf(p.line, "%s must be a whole number, found %q", p.key, p.value)
+			}
+			*field = value
+			continue
+		}
+		return lineErrorf(p.line, "unknown property %q in %s", p.key, n.description())
+	}
+	return nil
+}
+
+// expectSection checks that the node is a section without properties
+func (n *outlineNode) expectSection() error {
+	if n.kind != "" {
+		return lineErrorf(n.line, "%s cannot have a kind", n.label)
+	}
+	if len(n.properties) > 0 {
+		return lineErrorf(n.properties[0].line, "%s cannot have properties", n.label)
+	}
+	return nil
+}
+
+func (n *outlineNode) description() string {
+	if n.kind == "" {
+		return n.label
+	}
+	return fmt.Sprintf("%q (%s)", n.label, n.kind)
+}
+
+func unexpectedEntry(n *outlineNode, parent string) error {
+	return lineErrorf(n.line, "unexpected entry %s in %s", n.description(), parent)
+}
+
+func textGroup(node *outlineNode) (Group, error) {
+	group := Group{}
+	err := node.setProperties(
+		map[string]*string{"group_name": &group.Name, "group_nationality": &group.Nationality},
+		map[string]*int{"group_id": &group.ID, "group_size": &group.Size, "parent_group_id": &group.ParentID},
+	)
+	if err != nil {
+		return group, err
+	}
+	if group.Name == "" {
+		group.Name = node.label
+	}
+
+	for _, child := range node.children {
+		switch child.label {
+		case "group_members":
+			if err := child.expectSection(); err != nil {
+				return group, err
+			}
+			for _, entry := range child.children {
+				switch entry.kind {
+				case "Member":
+					m, err := textMember(entry)
+					if err != nil {
+						return group, err
+					}
+					group.Members = append(group.Members, m)
+				case "Team":
+					t, err := textTeam(entry)
+					if err != nil {
+						return group, err
+					}
+					group.Teams = append(group.Teams, t)
+				default:
+					return group, unexpectedEntry(entry, "group_members")
+				}
+			}
+		case "group_vehicles":
+			if err := child.expectSection(); err != nil {
+				return group, err
+			}
+			for _, entry := range child.children {
+				v, err := textVehicleInstance(entry)
+				if err != nil {
+					return group, err
+				}
+				group.Vehicles = append(group.Vehicles, v)
+			}
+		default:
+			return group, unexpectedEntry(child, "group "+node.label)
+		}
+	}
+
+	return group, nil
+}
+
+func textMember(node *outlineNode) (Member, error) {
+	member := Member{Label: node.label}
+	err := node.setProperties(
+		map[string]*string{"member_role": &member.Role, "member_rank": &member.Rank},
+		map[string]*int{"member_id": &member.ID},
+	)
+	if err != nil {
+		return member, err
+	}
+	if member.Role == "" {
+		return member, lineErrorf(node.line, "member %q has no member_role", node.label)
+	}
+
+	for _, child := range node.children {
+		if child.label != "member_weapon" {
+			return member, unexpectedEntry(child, "member "+node.label)
+		}
+		var weapon Weapon
+		err := child.setProperties(map[string]*string{
+			"weapon_name": &weapon.Name,
+			"weapon_type": &weapon.Type,
+			"caliber":     &weapon.Caliber,
+			"image_url":   &weapon.ImageURL,
+		}, map[string]*int{"weapon_id": &weapon.ID})
+		if err != nil {
+			return member, err
+		}
+		if len(child.children) > 0 {
+			return member, unexpectedEntry(child.children[0], "member_weapon")
+		}
+		if weapon.Name == "" && weapon.ID == 0 {
+			return member, lineErrorf(child.line, "member_weapon has no weapon_name")
+		}
+		member.Weapons = append(member.Weapons, weapon)
+	}
+
+	return member, nil
+}
+
+// textMembers reads a section of members such as team_members
+func textMembers(node *outlineNode) ([]Member, error) {
+	if err := node.expectSection(); err != nil {
+		return nil, err
+	}
+	var members []Member
+	for _, entry := range node.children {
+		if entry.kind != "Member" {
+			return nil, unexpectedEntry(entry, node.label)
+		}
+		m, err := textMember(entry)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func textTeam(node *outlineNode) (Team, error) {
+	team := Team{Label: node.label}
+	err := node.setProperties(
+		map[string]*string{"team_name": &team.Name},
+		map[string]*int{"team_id": &team.ID, "team_size": &team.Size},
+	)
+	if err != nil {
+		return team, err
+	}
+	if team.Name == "" {
+		team.Name = node.label
+	}
+
+	for _, child := range node.children {
+		if child.label != "team_members" {
+			return team, unexpectedEntry(child, "team "+node.label)
+		}
+		members, err := textMembers(child)
+		if err != nil {
+			return team, err
+		}
+		team.Members = append(team.Members, members...)
+	}
+
+	return team, nil
+}
+
+func textVehicleInstance(node *outlineNode) (VehicleInstance, error) {
+	if node.kind != "Vehicle" && node.kind != "Object" && node.kind != "" {
+		return VehicleInstance{}, unexpectedEntry(node, "group_vehicles")
+	}
+	instance := VehicleInstance{Label: node.label}
+	err := node.setProperties(nil, map[string]*int{"instance_id": &instance.InstanceID})
+	if err != nil {
+		return instance, err
+	}
+
+	hasVehicle := false
+	for _, child := range node.children {
+		switch child.label {
+		case "Vehicle":
+			v := &instance.Vehicle
+			err := child.setProperties(map[string]*string{
+				"vehicle_name":     &v.Name,
+				"vehicle_type":     &v.Type,
+				"vehicle_armament": &v.Armament,
+				"image_url":        &v.ImageURL,
+			}, map[string]*int{"vehicle_id": &v.ID})
+			if err != nil {
+				return instance, err
+			}
+			if len(child.children) > 0 {
+				return instance, unexpectedEntry(child.children[0], "Vehicle")
+			}
+			hasVehicle = true
+		case "vehicle_members":
+			crew, err := textMembers(child)
+			if err != nil {
+				return instance, err
+			}
+			instance.Crew = append(instance.Crew, crew...)
+		default:
+			return instance, unexpectedEntry(child, "vehicle "+node.label)
+		}
+	}
+	if !hasVehicle || (instance.Vehicle.Name == "" && instance.Vehicle.ID == 0) {
+		return instance, lineErrorf(node.line, "vehicle %q has no Vehicle with a vehicle_name", node.label)
+	}
+
+	return instance, nil
+}
+
+// WriteText writes groups as an outline document
+func WriteText(w io.Writer, groups []Group) error {
+	out := &outlineWriter{w: bufio.NewWriter(w)}
+	for i, g := range groups {
+		if i > 0 {
+			out.blank()
+		}
+		out.entry(0, g.Name, "Group")
+		out.intProperty(1, "group_id", g.ID)
+		out.property(1, "group_name", g.Name)
+		out.property(1, "group_nationality", g.Nationality)
+		out.property(1, "group_size", strconv.Itoa(g.Size))
+		out.intProperty(1, "parent_group_id", g.ParentID)
+
+		if len(g.Members) > 0 || len(g.Teams) > 0 {
+			out.entry(1, "group_members", "")
+			out.members(2, g.Members)
+			teamLabels := newLabeler()
+			for _, t := range g.Teams {
+				out.entry(2, teamLabels.label(t.Label, t.Name), "Team")
+				out.intProperty(3, "team_id", t.ID)
+				out.property(3, "team_name", t.Name)
+				out.property(3, "team_size", strconv.Itoa(t.Size))
+				if len(t.Members) > 0 {
+					out.entry(3, "team_members", "")
+					out.members(4, t.Members)
+				}
+			}
+		}
+
+		if len(g.Vehicles) > 0 {
+			out.entry(1, "group_vehicles", "")
+			vehicleLabels := newLabeler()
+			for _, v := range g.Vehicles {
+				out.entry(2, vehicleLabels.label(v.Label, v.Vehicle.Name), "Vehicle")
+				out.intProperty(3, "instance_id", v.InstanceID)
+				out.entry(3, "Vehicle", "Object")
+				out.intProperty(4, "vehicle_id", v.Vehicle.ID)
+				out.property(4, "vehicle_name", v.Vehicle.Name)
+				out.property(4, "vehicle_type", v.Vehicle.Type)
+				out.property(4, "vehicle_armament", v.Vehicle.Armament)
+				if v.Vehicle.ImageURL != "" {
+					out.property(4, "image_url", v.Vehicle.ImageURL)
+				}
+				if len(v.Crew) > 0 {
+					out.entry(3, "vehicle_members", "")
+					out.members(4, v.Crew)
+				}
+			}
+		}
+	}
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// outlineWriter writes outline lines, keeping the first write error
+type outlineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (o *outlineWriter) line(depth int, text string) {
+	if o.err != nil {
+		return
+	}
+	_, o.err = fmt.Fprintf(o.w, "%s%s\n", strings.Repeat(textIndent, depth), text)
+}
+
+func (o *outlineWriter) blank() {
+	o.line(0, "")
+}
+
+func (o *outlineWriter) entry(depth int, label, kind string) {
+	label = outlineText(label)
+	if kind == "" {
+		o.line(depth, "> "+label)
+	} else {
+		o.line(depth, "> "+label+" - "+kind)
+	}
+}
+
+func (o *outlineWriter) property(depth int, key, value string) {
+	o.line(depth, key+" = "+outlineText(value))
+}
+
+// intProperty writes IDs, leaving out the zero value of entries not yet stored
+func (o *outlineWriter) intProperty(depth int, key string, value int) {
+	if value != 0 {
+		o.property(depth, key, strconv.Itoa(value))
+	}
+}
+
+func (o *outlineWriter) members(depth int, members []Member) {
+	labels := newLabeler()
+	for _, m := range members {
+		o.entry(depth, labels.label(m.Label, m.Role), "Member")
+		o.intProperty(depth+1, "member_id", m.ID)
+		o.property(depth+1, "member_role", m.Role)
+		o.property(depth+1, "member_rank", m.Rank)
+		for _, w := range m.Weapons {
+			o.entry(depth+1, "member_weapon", "Object")
+			o.intProperty(depth+2, "weapon_id", w.ID)
+			o.property(depth+2, "weapon_name", w.Name)
+			o.property(depth+2, "weapon_type", w.Type)
+			o.property(depth+2, "caliber", w.Caliber)
+			if w.ImageURL != "" {
+				o.property(depth+2, "image_url", w.ImageURL)
+			}
+		}
+	}
+}
+
+// outlineText keeps a value on a single line
+func outlineText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,101 @@
+package document
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTextExample(t *testing.T) {
+	data, err := os.ReadFile("../../Text/example.txt")
+	if err != nil {
+		t.Fatalf("Failed to read example: %v", err)
+	}
+
+	groups, err := ParseText(data)
+	if err != nil {
+		t.Fatalf("Failed to parse example: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("Expected 1 group, got %d", len(groups))
+	}
+
+	g := groups[0]
+	if g.Name != "Ranger Rifle Squad" {
+		t.Errorf("Expected group name 'Ranger Rifle Squad', got '%s'", g.Name)
+	}
+	if len(g.Members) != 1 || len(g.Teams) != 2 {
+		t.Fatalf("Expected 1 member and 2 teams, got %d and %d", len(g.Members), len(g.Teams))
+	}
+	if len(g.Teams[1].Members) != 4 {
+		t.Errorf("Expected 4 members in Bravo, got %d", len(g.Teams[1].Members))
+	}
+	if w := g.Teams[0].Members[1].Weapons; len(w) != 1 || w[0].Name != "M249" {
+		t.Errorf("Expected the automatic rifleman to carry an M249, got %v", w)
+	}
+}
+
+func TestTextRoundTrip(t *testing.T) {
+	groups := []Group{{
+		ID:          3,
+		Name:        "Mech Platoon",
+		Nationality: "Germany",
+		Size:        2,
+		ParentID:    1,
+		Members: []Member{{
+			Label: "Leader",
+			Role:  "Leader",
+			Rank:  "Lt",
+			Weapons: []Weapon{
+				{Name: "P8", Type: "Pistol", Caliber: "9mm"},
+				{Name: "G36", Type: "Rifle", Caliber: "5.56mm"},
+			},
+		}},
+		Vehicles: []VehicleInstance{{
+			Label:      "Puma",
+			InstanceID: 7,
+			Vehicle:    Vehicle{Name: "Puma", Type: "IFV", Armament: "30mm"},
+			Crew:       []Member{{Label: "Driver", Role: "Driver", Rank: "Pvt"}},
+		}},
+	}, {ID: 1, Name: "Mech Company", Nationality: "Germany"}}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, groups); err != nil {
+		t.Fatalf("Failed to write outline: %v", err)
+	}
+	parsed, err := ParseText(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse written outline: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(parsed, groups) {
+		t.Errorf("Round trip changed the groups:\n got %+v\nwant %+v", parsed, groups)
+	}
+}
+
+func TestParseTextErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		line int
+	}{
+		{"misaligned property", "> G - Group\n    group_name = G\n      group_nationality = US\n", 3},
+		{"missing role", "> G - Group\n    group_nationality = US\n    > group_members\n        > A - Member\n            member_rank = Pvt\n", 4},
+		{"bad number", "> G - Group\n    group_nationality = US\n\n    group_size = nine\n", 4},
+		{"not a property", "> G - Group\n    nonsense\n", 2},
+		{"unknown property", "> G - Group\n    group_colour = red\n", 2},
+		{"missing vehicle", "> G - Group\n    group_nationality = US\n    > group_vehicles\n        > V - Vehicle\n            instance_id = 1\n", 4},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseText([]byte(tt.text))
+		lineErr, ok := err.(*LineError)
+		if !ok {
+			t.Errorf("%s: expected a LineError, got %v", tt.name, err)
+			continue
+		}
+		if lineErr.Line != tt.line {
+			t.Errorf("%s: expected an error on line %d, got %v", tt.name, tt.line, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("JSON encoding error: %v", err)
+	}
+}
+
+// writeJSONError writes an error message as a JSON object
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": message,
+	})
+}
+
+// decodeJSON decodes the request body into v, rejecting unknown fields
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// apiResourceID returns the ID following prefix in the request path, or an
+// empty string when the path has no ID or extra segments
+func apiResourceID(r *http.Request, prefix string) string {
+	id := strings.TrimPrefix(r.URL.Path, prefix)
+	if id == r.URL.Path || id == "" || strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
+
+// writeJSONConflict reports that a field value is already used by another resource
+func writeJSONConflict(w http.ResponseWriter, message, field string, existingID interface{}) {
+	writeJSON(w, http.StatusConflict, map[string]interface{}{
+		"error": message,
+		"conflict": map[string]interface{}{
+			"field":       field,
+			"existing_id": existingID,
+		},
+	})
+}
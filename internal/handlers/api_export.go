@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"orbat/internal/document"
+)
+
+// APIExportHandler downloads groups as an ORBAT document. With ?group=ID the
+// document holds that group; with ?country=NAME it holds all the country's
+// groups. ?format=text selects the outline format instead of JSON.
+func (a *App) APIExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	var docs []document.Group
+	var filename string
+	switch {
+	case query.Get("group") != "":
+		details, err := a.Groups.GetGroupDetails(query.Get("group"))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Group not found")
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		docs = append(docs, document.FromGroupDetails(details))
+		filename = details.Name
+
+	case query.Get("country") != "":
+		groups, err := a.Countries.GetCountryGroupDetails(query.Get("country"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		docs = make([]document.Group, 0, len(groups))
+		for _, details := range groups {
+			docs = append(docs, document.FromGroupDetails(details))
+		}
+		filename = query.Get("country")
+
+	default:
+		writeJSONError(w, http.StatusBadRequest, "Either group or country is required")
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		// A single group is written as an object, a country as an array
+		var doc interface{} = docs
+		if query.Get("group") != "" {
+			doc = docs[0]
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", documentFilename(filename, ".json")))
+		w.Write(append(data, '\n'))
+
+	case "text":
+		var buf bytes.Buffer
+		if err := document.WriteText(&buf, docs); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", documentFilename(filename, ".txt")))
+		w.Write(buf.Bytes())
+
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be json or text")
+	}
+}
+
+// documentFilename turns a group or country name into a file name
+func documentFilename(name, extension string) string {
+	return slugify(name, "orbat") + extension
+}
+
+// slugify reduces a name to lowercase letters, digits and single hyphens, so
+// it is safe in file names, storage keys and URLs. It returns fallback when
+// nothing of the name is left.
+func slugify(name, fallback string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, name)
+	slug = strings.Trim(slug, "-")
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	if slug == "" {
+		slug = fallback
+	}
+	return slug
+}
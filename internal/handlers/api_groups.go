@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"orbat/internal/database"
+	"orbat/internal/models"
+)
+
+// APIGroupsHandler handles listing and creating groups as JSON
+func (a *App) APIGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		filter, err := parseGroupFilter(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts, err := parseListOptions(r, 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		groups, total, err := a.Groups.ListGroups(filter, opts)
+		if isSortError(err) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if groups == nil {
+			groups = []models.Group{}
+		}
+		writeListHeaders(w, newPager(r, opts, len(groups), total))
+		writeJSON(w, http.StatusOK, groups)
+
+	case "POST":
+		group, ok := decodeGroupRequest(w, r)
+		if !ok {
+			return
+		}
+
+		groupID, err := a.Groups.CreateGroup(group, changedBy(r))
+		if err != nil {
+			writeGroupWriteError(w, err)
+			return
+		}
+
+		details, err := a.Groups.GetGroupDetails(fmt.Sprint(groupID))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/groups/%d", groupID))
+		writeJSON(w, http.StatusCreated, details)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// APIGroupHandler handles reading, updating and deleting a single group as JSON
+func (a *App) APIGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id := apiResourceID(r, "/api/v1/groups/")
+	if id == "" {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		details, err := a.Groups.GetGroupDetails(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Group not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, details)
+
+	case "PUT":
+		if !a.requireGroup(w, id) {
+			return
+		}
+
+		group, ok := decodeGroupRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := a.Groups.UpdateGroup(id, group, changedBy(r)); err != nil {
+			writeGroupWriteError(w, err)
+			return
+		}
+
+		details, err := a.Groups.GetGroupDetails(id)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, details)
+
+	case "DELETE":
+		if !a.requireGroup(w, id) {
+			return
+		}
+
+		if err := a.Groups.DeleteGroup(id, changedBy(r)); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// requireGroup writes a 404 response and returns false if the group does not exist
+func (a *App) requireGroup(w http.ResponseWriter, id string) bool {
+	exists, err := a.Groups.GroupExists(id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "Group not found")
+		return false
+	}
+	return true
+}
+
+// decodeGroupRequest decodes and validates a group from the request body.
+// Nationality may be given as a country name or code.
+func decodeGroupRequest(w http.ResponseWriter, r *http.Request) (models.GroupDetails, bool) {
+	var group models.GroupDetails
+	if err := decodeJSON(w, r, &group); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return group, false
+	}
+
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Group name is required")
+		return group, false
+	}
+
+	code, err := database.CountryCode(group.Nationality)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return group, false
+	}
+	group.Nationality = code
+
+	return group, true
+}
+
+// writeGroupWriteError maps errors from creating or updating a group to a response
+func writeGroupWriteError(w http.ResponseWriter, err error) {
+	if isGroupInputError(err) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"orbat/internal/database"
+	"orbat/internal/document"
+	"orbat/internal/models"
+)
+
+// maxDocumentSize limits the size of uploaded ORBAT documents
+const maxDocumentSize = 10 << 20
+
+// APIImportHandler creates groups from a JSON ORBAT document. Weapons and
+// vehicles are matched by name; add create_missing=true to the query to add
+// unknown ones to the catalog instead of rejecting the document.
+func (a *App) APIImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentSize))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	docs, err := document.ParseJSON(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid document: %v", err))
+		return
+	}
+
+	a.importDocuments(w, r, docs, r.URL.Query().Get("create_missing") == "true")
+}
+
+// importDocuments stores parsed groups and writes the IDs of the new groups
+func (a *App) importDocuments(w http.ResponseWriter, r *http.Request, docs []document.Group, createMissing bool) {
+	groups := make([]models.GroupDetails, len(docs))
+	for i, doc := range docs {
+		groups[i] = doc.GroupDetails()
+	}
+
+	groupIDs, err := a.Groups.ImportGroups(groups, createMissing, changedBy(r))
+	if err != nil {
+		var missing *database.MissingEquipmentError
+		switch {
+		case errors.As(err, &missing):
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":            err.Error(),
+				"missing_weapons":  missing.Weapons,
+				"missing_vehicles": missing.Vehicles,
+			})
+		case isGroupInputError(err):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"group_ids": groupIDs,
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// APIVehiclesHandler handles listing and creating vehicles as JSON
+func (a *App) APIVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		opts, err := parseListOptions(r, 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		vehicles, total, err := a.Vehicles.ListVehicles(parseVehicleFilter(r), opts)
+		if isSortError(err) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if vehicles == nil {
+			vehicles = []models.Vehicle{}
+		}
+		writeListHeaders(w, newPager(r, opts, len(vehicles), total))
+		writeJSON(w, http.StatusOK, vehicles)
+
+	case "POST":
+		vehicle, ok := decodeVehicleRequest(w, r)
+		if !ok {
+			return
+		}
+
+		exists, existingID, err := a.Vehicles.VehicleExists(vehicle.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if exists {
+			writeJSONConflict(w, "Vehicle with this name already exists", "Name", existingID)
+			return
+		}
+
+		vehicleID, err := a.Vehicles.CreateVehicle(vehicle, changedBy(r))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		created, err := a.Vehicles.GetVehicle(fmt.Sprint(vehicleID))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/vehicles/%d", vehicleID))
+		writeJSON(w, http.StatusCreated, created)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// APIVehicleHandler handles reading, updating and deleting a single vehicle as JSON.
+// GET returns the vehicle together with the groups and crews using it.
+func (a *App) APIVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	id := apiResourceID(r, "/api/v1/vehicles/")
+	if id == "" {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		details, err := a.Vehicles.GetVehicleDetails(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Vehicle not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, details)
+
+	case "PUT":
+		current, err := a.Vehicles.GetVehicle(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Vehicle not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		vehicle, ok := decodeVehicleRequest(w, r)
+		if !ok {
+			return
+		}
+		vehicle.ID = current.ID
+
+		exists, existingID, err := a.Vehicles.VehicleExists(vehicle.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if exists && existingID != current.ID {
+			writeJSONConflict(w, "Vehicle with this name already exists", "Name", existingID)
+			return
+		}
+
+		if err := a.Vehicles.UpdateVehicle(vehicle, nil, changedBy(r)); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		updated, err := a.Vehicles.GetVehicle(id)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+
+	case "DELETE":
+		err := a.Vehicles.DeleteVehicle(id, changedBy(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Vehicle not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// decodeVehicleRequest decodes and validates a vehicle from the request body.
+// Images and crews are managed elsewhere and are ignored here.
+func decodeVehicleRequest(w http.ResponseWriter, r *http.Request) (models.Vehicle, bool) {
+	var vehicle models.Vehicle
+	if err := decodeJSON(w, r, &vehicle); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return vehicle, false
+	}
+
+	vehicle.Name = strings.TrimSpace(vehicle.Name)
+	if vehicle.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Vehicle name is required")
+		return vehicle, false
+	}
+	if vehicle.Armament == "" {
+		vehicle.Armament = "None"
+	}
+	vehicle.ImageURL = models.NullString{}
+	vehicle.MediumURL = models.NullString{}
+	vehicle.ThumbnailURL = models.NullString{}
+	vehicle.Crew = nil
+
+	return vehicle, true
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"orbat/internal/database"
+	"orbat/internal/models"
+)
+
+// APIWeaponsHandler handles listing and creating weapons as JSON
+func (a *App) APIWeaponsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		filter, err := parseWeaponFilter(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts, err := parseListOptions(r, 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		weapons, total, err := a.Weapons.ListWeapons(filter, opts)
+		if isSortError(err) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if weapons == nil {
+			weapons = []models.Weapon{}
+		}
+		writeListHeaders(w, newPager(r, opts, len(weapons), total))
+		writeJSON(w, http.StatusOK, weapons)
+
+	case "POST":
+		weapon, ok := decodeWeaponRequest(w, r)
+		if !ok {
+			return
+		}
+
+		exists, existingID, err := a.Weapons.WeaponExists(weapon.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if exists {
+			writeJSONConflict(w, "Weapon with this name already exists", "Name", existingID)
+			return
+		}
+
+		weaponID, err := a.Weapons.CreateWeapon(weapon, changedBy(r))
+		if isReferenceError(err) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		created, err := a.Weapons.GetWeapon(fmt.Sprint(weaponID))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/weapons/%d", weaponID))
+		writeJSON(w, http.StatusCreated, created)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// APIWeaponHandler handles reading, updating and deleting a single weapon as JSON.
+// GET returns the weapon together with the groups and members using it.
+func (a *App) APIWeaponHandler(w http.ResponseWriter, r *http.Request) {
+	id := apiResourceID(r, "/api/v1/weapons/")
+	if id == "" {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		details, err := a.Weapons.GetWeaponDetails(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Weapon not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, details)
+
+	case "PUT":
+		current, err := a.Weapons.GetWeapon(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Weapon not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		weapon, ok := decodeWeaponRequest(w, r)
+		if !ok {
+			return
+		}
+		weapon.ID = current.ID
+
+		exists, existingID, err := a.Weapons.WeaponExists(weapon.Name)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if exists && existingID != current.ID {
+			writeJSONConflict(w, "Weapon with this name already exists", "Name", existingID)
+			return
+		}
+
+		err = a.Weapons.UpdateWeapon(weapon, nil, changedBy(r))
+		if isReferenceError(err) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		updated, err := a.Weapons.GetWeapon(id)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+
+	case "DELETE":
+		err := a.Weapons.DeleteWeapon(id, changedBy(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "Weapon not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// decodeWeaponRequest decodes and validates a weapon from the request body.
+// Images are managed through the weapons page and are ignored here.
+func decodeWeaponRequest(w http.ResponseWriter, r *http.Request) (models.Weapon, bool) {
+	var weapon models.Weapon
+	if err := decodeJSON(w, r, &weapon); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return weapon, false
+	}
+
+	weapon.Name = strings.TrimSpace(weapon.Name)
+	if weapon.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Weapon name is required")
+		return weapon, false
+	}
+	if err := validateWeaponSpecs(weapon.Specs); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return weapon, false
+	}
+	weapon.ImageURL = models.NullString{}
+	weapon.MediumURL = models.NullString{}
+	weapon.ThumbnailURL = models.NullString{}
+
+	return weapon, true
+}
+
+// isReferenceError reports whether err is caused by a reference to a catalog
+// entry that does not exist, such as the caliber of a weapon
+func isReferenceError(err error) bool {
+	var refErr *database.ReferenceError
+	return errors.As(err, &refErr)
+}
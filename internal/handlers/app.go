@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"orbat/internal/database"
+	"orbat/internal/storage"
+)
+
+// App holds the repositories and templates the handlers work with
+type App struct {
+	Groups    database.GroupRepository
+	Weapons   database.WeaponRepository
+	Vehicles  database.VehicleRepository
+	Calibers  database.CaliberRepository
+	Countries database.CountryRepository
+	Search    database.SearchRepository
+	Users     database.UserRepository
+	Audit     database.AuditRepository
+
+	// Ping checks the database connection for the health check
+	Ping func() error
+
+	// AnonymousRead lets visitors who are not logged in browse with GET
+	// requests. Everything else always needs a login.
+	AnonymousRead bool
+	// SecureCookies restricts the session cookie to HTTPS
+	SecureCookies bool
+
+	templates *template.Template
+}
+
+// NewApp creates an app backed by store, with the page templates in templatesDir
+func NewApp(store *database.Store, templatesDir string) (*App, error) {
+	templates, err := parseTemplates(templatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &App{
+		Groups:        store,
+		Weapons:       store,
+		Vehicles:      store,
+		Calibers:      store,
+		Countries:     store,
+		Search:        store,
+		Users:         store,
+		Audit:         store,
+		Ping:          store.Ping,
+		SecureCookies: true,
+		templates:     templates,
+	}, nil
+}
+
+// Routes returns the handler serving all pages and API endpoints to users
+// with permission to use them
+func (a *App) Routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", a.GroupsHandler)
+	mux.HandleFunc("/group/", func(w http.ResponseWriter, r *http.Request) {
+		// Check if this is an edit request
+		if strings.HasSuffix(r.URL.Path, "/edit") {
+			a.EditGroupHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/symbol.svg") {
+			a.GroupSymbolHandler(w, r)
+		} else if strings.Contains(r.URL.Path, "/revisions") {
+			a.GroupRevisionsHandler(w, r)
+		} else {
+			a.GroupDetailsHandler(w, r)
+		}
+	})
+	mux.HandleFunc("/add_group", a.AddGroupHandler)
+	mux.HandleFunc("/add_group/import", a.ImportOutlineHandler)
+	mux.HandleFunc("/weapons", a.WeaponsHandler)
+	mux.HandleFunc("/weapon/", a.WeaponDetailsHandler)
+	mux.HandleFunc("/member/", a.MemberWeaponsHandler)
+	mux.HandleFunc("/vehicles", a.VehiclesHandler)
+	mux.HandleFunc("/vehicle/", a.VehicleDetailsHandler)
+	mux.HandleFunc("/calibers", a.CalibersHandler)
+	mux.HandleFunc("/caliber/", a.CaliberDetailsHandler)
+	mux.HandleFunc("/countries", a.CountriesHandler)
+	mux.HandleFunc("/country/", a.CountryDetailsHandler)
+	mux.HandleFunc("/search", a.SearchHandler)
+	mux.HandleFunc("/compare", a.CompareHandler)
+	mux.HandleFunc("/audit", a.AuditHandler)
+	mux.HandleFunc("/health", a.HealthCheckHandler)
+	mux.HandleFunc("/login", a.LoginHandler)
+	mux.HandleFunc("/logout", a.LogoutHandler)
+	mux.HandleFunc("/api/validate-country", a.ValidateCountryHandler)
+	if images := storage.Handler(); images != nil {
+		mux.Handle(storage.ImagePath, images)
+	}
+
+	// JSON API
+	mux.HandleFunc("/api/v1/groups", a.APIGroupsHandler)
+	mux.HandleFunc("/api/v1/groups/", a.APIGroupHandler)
+	mux.HandleFunc("/api/v1/weapons", a.APIWeaponsHandler)
+	mux.HandleFunc("/api/v1/weapons/", a.APIWeaponHandler)
+	mux.HandleFunc("/api/v1/vehicles", a.APIVehiclesHandler)
+	mux.HandleFunc("/api/v1/vehicles/", a.APIVehicleHandler)
+	mux.HandleFunc("/api/v1/calibers", a.APICalibersHandler)
+	mux.HandleFunc("/api/v1/calibers/", a.APICaliberHandler)
+	mux.HandleFunc("/api/v1/ammunition", a.APIAmmunitionHandler)
+	mux.HandleFunc("/api/v1/import", a.APIImportHandler)
+	mux.HandleFunc("/api/v1/export", a.APIExportHandler)
+	mux.HandleFunc("/api/v1/search", a.APISearchHandler)
+	mux.HandleFunc("/api/v1/compare", a.APICompareHandler)
+
+	return a.authorize(mux)
+}
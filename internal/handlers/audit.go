@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// auditEntityTypes are the kinds of entity whose changes are audited. Changes
+// to members are recorded as updates of their groups.
+var auditEntityTypes = []string{"group", "weapon", "vehicle", "caliber", "country"}
+
+// auditRow is an audit entry as shown on the audit page, with its JSON
+// indented and the fields that changed listed
+type auditRow struct {
+	models.AuditEntry
+	Label   string
+	URL     string
+	Changed []string
+}
+
+func newAuditRow(e models.AuditEntry) auditRow {
+	row := auditRow{AuditEntry: e, Label: e.EntityType + " " + e.EntityID}
+
+	var before, after map[string]json.RawMessage
+	json.Unmarshal([]byte(e.Before), &before)
+	json.Unmarshal([]byte(e.After), &after)
+	for _, fields := range []map[string]json.RawMessage{before, after} {
+		var name string
+		if json.Unmarshal(fields["Name"], &name) == nil && name != "" {
+			row.Label = fmt.Sprintf("%s %q", e.EntityType, name)
+		}
+	}
+	if e.Action == "update" || e.Action == "restore" {
+		for field, value := range after {
+			if !bytes.Equal(before[field], value) {
+				row.Changed = append(row.Changed, field)
+			}
+		}
+		sort.Strings(row.Changed)
+	}
+
+	switch {
+	case e.EntityType == "group" && e.Action == "delete":
+		// A deleted group can be restored from its revisions
+		row.URL = "/group/" + url.PathEscape(e.EntityID) + "/revisions"
+	case e.Action == "delete":
+	case e.EntityType == "group", e.EntityType == "weapon", e.EntityType == "vehicle",
+		e.EntityType == "caliber":
+		row.URL = "/" + e.EntityType + "/" + url.PathEscape(e.EntityID)
+	}
+
+	row.Before = indentJSON(e.Before)
+	row.After = indentJSON(e.After)
+	return row
+}
+
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, []byte(s), "", "  ") != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// AuditHandler shows the audit log, newest first. ?type= and ?id= narrow it
+// to the history of one kind of entity or one entity, and ?user= to the
+// changes of one user.
+func (a *App) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		EntityType: query.Get("type"),
+		EntityID:   strings.TrimSpace(query.Get("id")),
+		Username:   strings.TrimSpace(query.Get("user")),
+	}
+	if filter.EntityType == "" && filter.EntityID != "" {
+		http.Error(w, "id needs a type", http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(r, defaultPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := a.Audit.ListAuditEntries(filter, opts)
+	if err != nil {
+		log.Printf("Audit log error: %v", err)
+		http.Error(w, "Failed to read the audit log", http.StatusInternalServerError)
+		return
+	}
+	rows := make([]auditRow, len(entries))
+	for i, e := range entries {
+		rows[i] = newAuditRow(e)
+	}
+
+	data := struct {
+		Entries     []auditRow
+		Filter      models.AuditFilter
+		EntityTypes []string
+		Pager       pager
+	}{rows, filter, auditEntityTypes, newPager(r, opts, len(rows), total)}
+	if err := a.render(w, r, "audit.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
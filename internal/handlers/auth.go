@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"orbat/internal/auth"
+	"orbat/internal/models"
+)
+
+const (
+	sessionCookieName = "orbat_session"
+	sessionDuration   = 7 * 24 * time.Hour
+)
+
+type contextKey int
+
+const userKey contextKey = iota
+
+// currentUser returns the user logged in for a request
+func currentUser(r *http.Request) (models.User, bool) {
+	user, ok := r.Context().Value(userKey).(models.User)
+	return user, ok
+}
+
+// changedBy returns the name of the user making a request, which the changes
+// it makes are recorded under in the audit log
+func changedBy(r *http.Request) string {
+	user, _ := currentUser(r)
+	return user.Username
+}
+
+// authorize identifies the user of a request from its session cookie and
+// checks they have the permission the request needs. Visitors who are not
+// logged in are sent to the login page, or get 401 from the API. Users
+// without the permission get 403.
+func (a *App) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			user, err := a.Users.GetSessionUser(auth.HashToken(cookie.Value))
+			if err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), userKey, user))
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Session lookup error: %v", err)
+				http.Error(w, "Failed to check session", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		permission, needed := requiredPermission(r)
+		if !needed || a.can(r, permission) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, loggedIn := currentUser(r)
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+		switch {
+		case loggedIn && api:
+			writeJSONError(w, http.StatusForbidden, "Permission denied")
+		case loggedIn:
+			http.Error(w, "You do not have permission to do this", http.StatusForbidden)
+		case api:
+			writeJSONError(w, http.StatusUnauthorized, "Login required")
+		default:
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		}
+	})
+}
+
+// LoginHandler shows the login form and starts a session for valid credentials
+func (a *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Username string
+		Next     string
+		Error    string
+	}{Next: localRedirect(r.FormValue("next"))}
+
+	if r.Method != "POST" {
+		a.renderLogin(w, r, http.StatusOK, data)
+		return
+	}
+
+	data.Username = strings.TrimSpace(r.FormValue("username"))
+	user, err := a.Users.GetUserByName(data.Username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// An unknown user has no hash, which never matches
+	if err := auth.CheckPassword(user.PasswordHash, r.FormValue("password")); err != nil {
+		if !errors.Is(err, auth.ErrWrongPassword) {
+			log.Printf("Password check error: %v", err)
+		}
+		data.Error = "Invalid username or password"
+		a.renderLogin(w, r, http.StatusUnauthorized, data)
+		return
+	}
+
+	token, err := auth.NewSessionToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(sessionDuration)
+	if err := a.Users.CreateSession(auth.HashToken(token), user.ID, expires); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, a.sessionCookie(token, expires))
+	http.Redirect(w, r, data.Next, http.StatusSeeOther)
+}
+
+// LogoutHandler ends the current session
+func (a *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := a.Users.DeleteSession(auth.HashToken(cookie.Value)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, a.sessionCookie("", time.Time{}))
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (a *App) renderLogin(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := a.render(w, r, "login.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// sessionCookie returns the cookie holding a session token, or removing it
+// when the token is empty. The cookie is not sent with cross-site form posts,
+// which guards against request forgery.
+func (a *App) sessionCookie(token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   a.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// localRedirect returns target if it is a path on this site, and "/" otherwise
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"orbat/internal/ammo"
+	"orbat/internal/database"
+	"orbat/internal/models"
+)
+
+// CalibersHandler lists the caliber catalog and adds calibers to it
+func (a *App) CalibersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		a.renderCalibers(w, r, http.StatusOK, models.Caliber{}, "")
+		return
+	case "POST":
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	caliber, err := parseCaliberForm(r)
+	if err != nil {
+		a.renderCalibers(w, r, http.StatusBadRequest, caliber, err.Error())
+		return
+	}
+	id, err := a.Calibers.CreateCaliber(caliber, changedBy(r))
+	if status := caliberWriteStatus(err); status != http.StatusOK {
+		if status == http.StatusInternalServerError {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		a.renderCalibers(w, r, status, caliber, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/caliber/%d", id), http.StatusSeeOther)
+}
+
+func (a *App) renderCalibers(w http.ResponseWriter, r *http.Request, status int, form models.Caliber, formError string) {
+	calibers, err := a.Calibers.GetCalibers()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch calibers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Calibers []models.Caliber
+		Form     models.Caliber
+		Error    string
+	}{calibers, form, formError}
+
+	w.WriteHeader(status)
+	if err := a.render(w, r, "calibers.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// CaliberDetailsHandler shows a caliber with the weapons firing it, saves
+// changes to it and deletes it
+func (a *App) CaliberDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 3 || pathParts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	id := pathParts[2]
+
+	current, err := a.Calibers.GetCaliber(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case len(pathParts) == 4 && pathParts[3] == "delete":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := a.Calibers.DeleteCaliber(id, changedBy(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/calibers", http.StatusSeeOther)
+
+	case len(pathParts) > 3:
+		http.NotFound(w, r)
+
+	case r.Method == "GET":
+		a.renderCaliber(w, r, http.StatusOK, current, "")
+
+	case r.Method == "POST":
+		caliber, err := parseCaliberForm(r)
+		caliber.ID = current.ID
+		if err != nil {
+			a.renderCaliber(w, r, http.StatusBadRequest, caliber, err.Error())
+			return
+		}
+		err = a.Calibers.UpdateCaliber(caliber, changedBy(r))
+		if status := caliberWriteStatus(err); status != http.StatusOK {
+			if status == http.StatusInternalServerError {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			a.renderCaliber(w, r, status, caliber, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/caliber/"+id, http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderCaliber shows the details page of a caliber, with the form to edit
+// it filled in from caliber
+func (a *App) renderCaliber(w http.ResponseWriter, r *http.Request, status int, caliber models.Caliber, formError string) {
+	weapons, _, err := a.Weapons.ListWeapons(models.WeaponFilter{CaliberID: caliber.ID}, models.ListOptions{})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch weapons: %v", err), http.StatusInternalServerError)
+		return
+	}
+	calibers, err := a.Calibers.GetCalibers()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch calibers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	substitutes := make(map[int]bool)
+	for _, sub := range caliber.Substitutes {
+		substitutes[sub.ID] = true
+	}
+	data := struct {
+		Caliber     models.Caliber
+		Weapons     []models.Weapon
+		Calibers    []models.Caliber
+		Substitutes map[int]bool
+		Error       string
+	}{caliber, weapons, calibers, substitutes, formError}
+
+	w.WriteHeader(status)
+	if err := a.render(w, r, "caliber_details.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// parseCaliberForm reads a caliber from a posted form: its name, its aliases
+// separated by commas and the IDs of its substitutes
+func parseCaliberForm(r *http.Request) (models.Caliber, error) {
+	var caliber models.Caliber
+	if err := r.ParseForm(); err != nil {
+		return caliber, err
+	}
+
+	caliber.Name = strings.TrimSpace(r.FormValue("name"))
+	for _, alias := range strings.Split(r.FormValue("aliases"), ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			caliber.Aliases = append(caliber.Aliases, alias)
+		}
+	}
+	for _, value := range r.Form["substitutes"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return caliber, fmt.Errorf("invalid substitute: %s", value)
+		}
+		caliber.Substitutes = append(caliber.Substitutes, models.Caliber{ID: id})
+	}
+
+	if caliber.Name == "" {
+		return caliber, fmt.Errorf("Caliber name is required")
+	}
+	return caliber, nil
+}
+
+// caliberWriteStatus returns the status for the outcome of saving a caliber:
+// 200 when it was saved, 409 for an alias of another caliber and 400 for a
+// substitute that does not exist
+func caliberWriteStatus(err error) int {
+	var aliasErr *database.AliasTakenError
+	var refErr *database.ReferenceError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &aliasErr):
+		return http.StatusConflict
+	case errors.As(err, &refErr):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ammunitionDemand works out the ammunition needed by the weapons carried by
+// members and the vehicles in use
+func (a *App) ammunitionDemand(weapons []models.WeaponUsage, vehicles []models.VehicleUsage) (models.AmmunitionDemand, error) {
+	catalog, err := a.Weapons.GetWeapons()
+	if err != nil {
+		return models.AmmunitionDemand{}, err
+	}
+	calibers, err := a.Calibers.GetCalibers()
+	if err != nil {
+		return models.AmmunitionDemand{}, err
+	}
+	return ammo.Demand(weapons, vehicles, catalog, calibers), nil
+}
+
+// APICalibersHandler lists the caliber catalog and adds calibers to it as JSON
+func (a *App) APICalibersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		calibers, err := a.Calibers.GetCalibers()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if calibers == nil {
+			calibers = []models.Caliber{}
+		}
+		writeJSON(w, http.StatusOK, calibers)
+
+	case "POST":
+		caliber, ok := decodeCaliberRequest(w, r)
+		if !ok {
+			return
+		}
+		id, err := a.Calibers.CreateCaliber(caliber, changedBy(r))
+		if status := caliberWriteStatus(err); status != http.StatusOK {
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		created, err := a.Calibers.GetCaliber(fmt.Sprint(id))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/calibers/%d", id))
+		writeJSON(w, http.StatusCreated, created)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// APICaliberHandler handles reading, updating and deleting a single caliber
+// as JSON. PUT replaces its name, aliases and substitutes.
+func (a *App) APICaliberHandler(w http.ResponseWriter, r *http.Request) {
+	id := apiResourceID(r, "/api/v1/calibers/")
+	if id == "" {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	current, err := a.Calibers.GetCaliber(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "Caliber not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, current)
+
+	case "PUT":
+		caliber, ok := decodeCaliberRequest(w, r)
+		if !ok {
+			return
+		}
+		caliber.ID = current.ID
+		err := a.Calibers.UpdateCaliber(caliber, changedBy(r))
+		if status := caliberWriteStatus(err); status != http.StatusOK {
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		updated, err := a.Calibers.GetCaliber(id)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+
+	case "DELETE":
+		if err := a.Calibers.DeleteCaliber(id, changedBy(r)); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// decodeCaliberRequest reads a caliber from a JSON request body, writing an
+// error response and returning false if it is invalid. Only the IDs of the
+// substitutes are used.
+func decodeCaliberRequest(w http.ResponseWriter, r *http.Request) (models.Caliber, bool) {
+	var caliber models.Caliber
+	if err := decodeJSON(w, r, &caliber); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+		return caliber, false
+	}
+
+	caliber.Name = strings.TrimSpace(caliber.Name)
+	if caliber.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "Caliber name is required")
+		return caliber, false
+	}
+	return caliber, true
+}
+
+// APIAmmunitionHandler returns the ammunition demand of ?group=ID, covering
+// its subordinate groups, or of ?country=NAME
+func (a *App) APIAmmunitionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var weapons []models.WeaponUsage
+	var vehicles []models.VehicleUsage
+	groupID, country := r.URL.Query().Get("group"), r.URL.Query().Get("country")
+	switch {
+	case groupID != "" && country == "":
+		if !a.requireGroup(w, groupID) {
+			return
+		}
+		rollup, err := a.Groups.GetGroupRollup(groupID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		weapons, vehicles = rollup.Weapons, rollup.Vehicles
+	case country != "" && groupID == "":
+		details, err := a.Countries.GetCountryDetails(country)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		weapons, vehicles = details.Weapons, details.Vehicles
+	default:
+		writeJSONError(w, http.StatusBadRequest, "either group or country is required")
+		return
+	}
+
+	demand, err := a.ammunitionDemand(weapons, vehicles)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if demand.Calibers == nil {
+		demand.Calibers = []models.CaliberDemand{}
+	}
+	writeJSON(w, http.StatusOK, demand)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"orbat/internal/compare"
+	"orbat/internal/models"
+)
+
+// maxCompareGroups limits how many groups are set side by side
+const maxCompareGroups = 8
+
+// CompareHandler shows the groups given by ?groups=1,2,3 side by side, with a
+// form to pick the groups to compare
+func (a *App) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseCompareGroups(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var comparison models.GroupComparison
+	if len(ids) >= 2 {
+		comparison, err = a.compareGroups(ids)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Compare error: %v", err)
+			http.Error(w, "Failed to compare groups", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	groups, err := a.Groups.GetGroups()
+	if err != nil {
+		http.Error(w, "Failed to fetch groups", http.StatusInternalServerError)
+		return
+	}
+	selected := make(map[int]bool)
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	data := struct {
+		Options    []models.Group
+		Selected   map[int]bool
+		Comparison models.GroupComparison
+	}{groups, selected, comparison}
+	if err := a.render(w, r, "compare.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// APICompareHandler returns the comparison of the groups given by ?groups=1,2,3
+func (a *App) APICompareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ids, err := parseCompareGroups(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(ids) < 2 {
+		writeJSONError(w, http.StatusBadRequest, "groups must list at least two group IDs")
+		return
+	}
+
+	comparison, err := a.compareGroups(ids)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+// parseCompareGroups reads the group IDs to compare from ?groups=, which may
+// be a comma-separated list, repeated, or both. Repeated IDs are dropped.
+func parseCompareGroups(r *http.Request) ([]int, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, value := range r.URL.Query()["groups"] {
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group ID: %s", s)
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) > maxCompareGroups {
+		return nil, fmt.Errorf("at most %d groups can be compared", maxCompareGroups)
+	}
+	return ids, nil
+}
+
+// compareGroups loads the groups and sets them side by side
+func (a *App) compareGroups(ids []int) (models.GroupComparison, error) {
+	groups := make([]models.GroupDetails, len(ids))
+	for i, id := range ids {
+		group, err := a.Groups.GetGroupDetails(strconv.Itoa(id))
+		if err != nil {
+			return models.GroupComparison{}, err
+		}
+		groups[i] = group
+	}
+	return compare.Groups(groups), nil
+}
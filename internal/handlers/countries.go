@@ -5,29 +5,30 @@ import (
 	"net/url"
 	"strings"
 
-	"orbat/internal/database"
 	"log"
 	"encoding/json"
 	"github.com/biter777/countries"
+	"orbat/internal/database"
+	"orbat/internal/models"
 )
 
 // CountriesHandler handles the countries list
-func CountriesHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) CountriesHandler(w http.ResponseWriter, r *http.Request) {
 	// Get countries data
-	countries, err := database.GetCountries()
+	countries, err := a.Countries.GetCountries()
 	if err != nil {
 		http.Error(w, "Failed to fetch countries", http.StatusInternalServerError)
 		return
 	}
 
 	// Use the global templates variable instead of creating a new one
-	if err := templates.ExecuteTemplate(w, "countries.html", countries); err != nil {
+	if err := a.render(w, r, "countries.html", countries); err != nil {
 		log.Printf("Template execution error: %v", err)
 	}
 }
 
 // CountryDetailsHandler handles country details and editing
-func CountryDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) CountryDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
 		http.NotFound(w, r)
@@ -56,22 +57,15 @@ func CountryDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		newCode := country.Info().Alpha2
 
-		tx, err := database.DB.Begin()
+		// The page may be addressed by the country's name or code
+		oldCode, err := database.CountryCode(countryName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		defer tx.Rollback()
 
 		// Update country code in groups table
-		_, err = tx.Exec("UPDATE groups SET group_nationality = ? WHERE group_nationality = ?", 
-			newCode, countryName)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if err := tx.Commit(); err != nil {
+		if err := a.Countries.RenameCountry(oldCode, newCode, changedBy(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -80,21 +74,31 @@ func CountryDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	details, err := database.GetCountryDetails(countryName)
+	details, err := a.Countries.GetCountryDetails(countryName)
 	if err != nil {
 		log.Printf("Error getting country details: %v", err)
 		http.Error(w, "Failed to get country details", http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "country_details.html", details); err != nil {
+	ammunition, err := a.ammunitionDemand(details.Weapons, details.Vehicles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		models.CountryDetails
+		Ammunition models.AmmunitionDemand
+	}{details, ammunition}
+
+	if err := a.render(w, r, "country_details.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		// Don't write an error header here since the template might have already written a response
 	}
 }
 
 // ValidateCountryHandler handles country validation
-func ValidateCountryHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) ValidateCountryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
 	countryName := r.URL.Query().Get("name")
@@ -1,38 +1,72 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"orbat/internal/database"
+	"orbat/internal/document"
+	"orbat/internal/load"
+	"orbat/internal/models"
 )
 
 // GroupsHandler handles the root path - shows all groups
-func GroupsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) GroupsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
 		return
 	}
 
+	filter, err := parseGroupFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(r, defaultPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Get groups data
-	groups, err := database.GetGroups()
+	groups, total, err := a.Groups.ListGroups(filter, opts)
+	if isSortError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch groups", http.StatusInternalServerError)
 		return
 	}
 
+	// Nationalities to filter by
+	nationalities, err := a.Countries.GetCountries()
+	if err != nil {
+		http.Error(w, "Failed to fetch countries", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Groups        []models.Group
+		Nationalities []string
+		Pager         pager
+	}{groups, nationalities, newPager(r, opts, len(groups), total, "name", "size", "nationality")}
+
 	// Use the global templates variable instead of parsing the template directly
-	if err := templates.ExecuteTemplate(w, "groups.html", groups); err != nil {
+	if err := a.render(w, r, "groups.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		// Don't write header here since template.Execute might have already written it
 	}
 }
 
 // GroupDetailsHandler handles group details and deletion
-func GroupDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) GroupDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
 		http.NotFound(w, r)
@@ -46,7 +80,7 @@ func GroupDetailsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := database.DeleteGroup(database.DB, id); err != nil {
+		if err := a.Groups.DeleteGroup(id, changedBy(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -54,59 +88,105 @@ func GroupDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	if len(pathParts) == 4 && pathParts[3] == "duplicate" {
+		a.duplicateGroup(w, r, id)
+		return
+	}
 
-	group, err := database.GetGroupDetails(id)
+	group, err := a.Groups.GetGroupDetails(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "group_details.html", group); err != nil {
+	ancestors, err := a.Groups.GetGroupAncestors(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tree, err := a.Groups.GetGroupTree(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rollup, err := a.Groups.GetGroupRollup(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ammunition, err := a.ammunitionDemand(rollup.Weapons, rollup.Vehicles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		models.GroupDetails
+		Ancestors  []models.Group
+		Subgroups  []models.GroupNode
+		Rollup     models.GroupRollup
+		Ammunition models.AmmunitionDemand
+		Load       models.GroupLoad
+	}{
+		GroupDetails: group,
+		Ancestors:    ancestors,
+		Subgroups:    tree.Subgroups,
+		Rollup:       rollup,
+		Ammunition:   ammunition,
+		Load:         load.Group(group),
+	}
+
+	if err := a.render(w, r, "group_details.html", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-// AddGroupHandler handles the addition of new groups
-func AddGroupHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "GET" {
-		weapons, err := database.GetWeapons()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// duplicateGroup copies a group under the posted name and, optionally, a new
+// nationality, then opens the copy in the editor
+func (a *App) duplicateGroup(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		vehicles, err := database.GetVehicles()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
 
-		// Convert data to JSON for the template
-		weaponsJSON, err := json.Marshal(weapons)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	newID, err := a.Groups.DuplicateGroup(id, name, strings.TrimSpace(r.FormValue("nationality")), changedBy(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
 			return
 		}
-
-		vehiclesJSON, err := json.Marshal(vehicles)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if isGroupInputError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		data := struct {
-			Weapons        interface{}
-			WeaponOptions string
-			VehicleOptions string
-		}{
-			Weapons:        weapons,  // For the template weapon select
-			WeaponOptions: string(weaponsJSON),  // For JavaScript
-			VehicleOptions: string(vehiclesJSON), // For JavaScript
-		}
+	http.Redirect(w, r, fmt.Sprintf("/group/%d/edit", newID), http.StatusSeeOther)
+}
 
-		if err := templates.ExecuteTemplate(w, "add_group.html", data); err != nil {
-			log.Printf("Template execution error: %v", err)
-		}
+// AddGroupHandler handles the addition of new groups
+func (a *App) AddGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		a.renderAddGroup(w, r, http.StatusOK, "", "")
 		return
 	}
 
@@ -122,236 +202,231 @@ func AddGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := database.DB.Begin()
+	group, err := parseGroupForm(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.Nationality = countryCode
+
+	_, err = a.Groups.CreateGroup(group, changedBy(r))
+	if err != nil {
+		if isGroupInputError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
 
-	// Insert group with country code
-	result, err := tx.Exec(`
-		INSERT INTO groups (group_name, group_nationality, group_size)
-		VALUES (?, ?, 0)
-	`, r.FormValue("name"), countryCode)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renderAddGroup shows the add group page. The outline and importError are
+// shown in the outline import form after a failed import.
+func (a *App) renderAddGroup(w http.ResponseWriter, r *http.Request, status int, outline, importError string) {
+	weapons, err := a.Weapons.GetWeapons()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	groupID, err := result.LastInsertId()
+	vehicles, err := a.Vehicles.GetVehicles()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Handle direct members
-	roles := r.PostForm["role[]"]
-	ranks := r.PostForm["rank[]"]
-	totalMembers := len(roles)
-	
-	for i := range roles {
-		// Insert member
-		result, err := tx.Exec(`
-			INSERT INTO members (member_role, member_rank)
-			VALUES (?, ?)
-		`, roles[i], ranks[i])
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	parentOptions, err := a.Groups.GetParentCandidates("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		memberID, err := result.LastInsertId()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// Convert data to JSON for the template
+	weaponsJSON, err := json.Marshal(weapons)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		// Associate member with group
-		_, err = tx.Exec(`
-			INSERT INTO group_members (group_id, member_id, team_id)
-			VALUES (?, ?, NULL)
-		`, groupID, memberID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	vehiclesJSON, err := json.Marshal(vehicles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		// Handle weapons for this member
-		weaponIDs := r.PostForm[fmt.Sprintf("weapons_%d[]", i)]
-		for _, weaponID := range weaponIDs {
-			_, err = tx.Exec(`
-				INSERT INTO members_weapons (member_id, weapon_id)
-				VALUES (?, ?)
-			`, memberID, weaponID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
+	data := struct {
+		Weapons        interface{}
+		WeaponOptions  string
+		VehicleOptions string
+		ParentOptions  []models.Group
+		Outline        string
+		ImportError    string
+	}{
+		Weapons:        weapons,              // For the template weapon select
+		WeaponOptions:  string(weaponsJSON),  // For JavaScript
+		VehicleOptions: string(vehiclesJSON), // For JavaScript
+		ParentOptions:  parentOptions,
+		Outline:        outline,
+		ImportError:    importError,
 	}
 
-	// Handle teams
-	teamNames := r.PostForm["team_name[]"]
-	for i, name := range teamNames {
-		teamRoles := r.PostForm[fmt.Sprintf("team_%d_role[]", i)]
-		teamSize := len(teamRoles)
-		totalMembers += teamSize
-
-		// Insert team
-		result, err := tx.Exec(`
-			INSERT INTO teams (team_name, team_size)
-			VALUES (?, ?)
-		`, name, teamSize)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	w.WriteHeader(status)
+	if err := a.render(w, r, "add_group.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
 
-		teamID, err := result.LastInsertId()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// ImportOutlineHandler creates groups from an outline pasted into the add
+// group page, showing the page again with the error if the outline is invalid
+func (a *App) ImportOutlineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		// Associate team with group
-		_, err = tx.Exec(`
-			INSERT INTO group_members (group_id, member_id, team_id)
-			VALUES (?, NULL, ?)
-		`, groupID, teamID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	outline := r.FormValue("outline")
+	docs, err := document.ParseText([]byte(outline))
+	if err != nil {
+		a.renderAddGroup(w, r, http.StatusBadRequest, outline, err.Error())
+		return
+	}
+
+	groups := make([]models.GroupDetails, len(docs))
+	for i, doc := range docs {
+		groups[i] = doc.GroupDetails()
+	}
+
+	groupIDs, err := a.Groups.ImportGroups(groups, r.FormValue("create_missing") == "on", changedBy(r))
+	if err != nil {
+		var missing *database.MissingEquipmentError
+		if errors.As(err, &missing) || isGroupInputError(err) {
+			a.renderAddGroup(w, r, http.StatusBadRequest, outline, err.Error())
 			return
 		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		// Handle team members
-		teamRanks := r.PostForm[fmt.Sprintf("team_%d_rank[]", i)]
-		
-		for j := range teamRoles {
-			// Insert member
-			result, err := tx.Exec(`
-				INSERT INTO members (member_role, member_rank)
-				VALUES (?, ?)
-			`, teamRoles[j], teamRanks[j])
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	if len(groupIDs) == 1 {
+		http.Redirect(w, r, fmt.Sprintf("/group/%d", groupIDs[0]), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
 
-			memberID, err := result.LastInsertId()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+// isGroupInputError reports whether an error from creating or updating a
+// group was caused by the submitted group rather than by the database
+func isGroupInputError(err error) bool {
+	var refErr *database.ReferenceError
+	return errors.As(err, &refErr) || errors.Is(err, database.ErrGroupCycle)
+}
 
-			// Associate member with team
-			_, err = tx.Exec(`
-				INSERT INTO team_members (team_id, member_id)
-				VALUES (?, ?)
-			`, teamID, memberID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+// parseGroupForm builds the group structure from the form fields posted by
+// add_group.html and edit_group.html. The edit form also posts the IDs of
+// existing members, teams and vehicle instances so they can be matched up.
+func parseGroupForm(r *http.Request) (models.GroupDetails, error) {
+	var group models.GroupDetails
+	group.Name = r.FormValue("name")
 
-			// Handle weapons for this team member
-			weaponIDs := r.PostForm[fmt.Sprintf("team_%d_weapons_%d[]", i, j)]
-			for _, weaponID := range weaponIDs {
-				_, err = tx.Exec(`
-					INSERT INTO members_weapons (member_id, weapon_id)
-					VALUES (?, ?)
-				`, memberID, weaponID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-			}
+	parentID, err := formID([]string{r.FormValue("parent_id")}, 0)
+	if err != nil {
+		return group, err
+	}
+	group.ParentID = parentID
+
+	// Handle direct members
+	members, err := parseMembersForm(r, "")
+	if err != nil {
+		return group, err
+	}
+	group.DirectMembers = members
+
+	// Handle teams
+	for i, name := range r.PostForm["team_name[]"] {
+		teamID, err := formID(r.PostForm["team_id[]"], i)
+		if err != nil {
+			return group, err
 		}
+		members, err := parseMembersForm(r, fmt.Sprintf("team_%d_", i))
+		if err != nil {
+			return group, err
+		}
+		group.Teams = append(group.Teams, models.Team{
+			ID:      teamID,
+			Name:    name,
+			Size:    len(members),
+			Members: members,
+		})
 	}
 
 	// Handle vehicles
-	vehicleIDs := r.PostForm["vehicle_id[]"]
-	for i, vehicleID := range vehicleIDs {
-		// Insert vehicle instance
-		result, err := tx.Exec(`
-			INSERT INTO group_vehicles (group_id, vehicle_id)
-			VALUES (?, ?)
-		`, groupID, vehicleID)
+	for i, vehicleID := range r.PostForm["vehicle_id[]"] {
+		instanceID, err := formID(r.PostForm["instance_id[]"], i)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return group, err
 		}
-
-		instanceID, err := result.LastInsertId()
+		crew, err := parseMembersForm(r, fmt.Sprintf("vehicle_%d_", i))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return group, err
 		}
+		group.Vehicles = append(group.Vehicles, models.Vehicle{
+			ID:         vehicleID,
+			InstanceID: instanceID,
+			Crew:       crew,
+		})
+	}
 
-		// Handle vehicle members
-		vehicleRoles := r.PostForm[fmt.Sprintf("vehicle_%d_role[]", i)]
-		vehicleRanks := r.PostForm[fmt.Sprintf("vehicle_%d_rank[]", i)]
-		totalMembers += len(vehicleRoles)
-		
-		for j := range vehicleRoles {
-			// Insert member
-			result, err := tx.Exec(`
-				INSERT INTO members (member_role, member_rank)
-				VALUES (?, ?)
-			`, vehicleRoles[j], vehicleRanks[j])
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	return group, nil
+}
 
-			memberID, err := result.LastInsertId()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+// parseMembersForm reads the role, rank, ID and weapon fields sharing a prefix
+func parseMembersForm(r *http.Request, prefix string) ([]models.Member, error) {
+	roles := r.PostForm[prefix+"role[]"]
+	ranks := r.PostForm[prefix+"rank[]"]
+	if len(ranks) != len(roles) {
+		return nil, fmt.Errorf("mismatched %srole[] and %srank[] fields", prefix, prefix)
+	}
 
-			// Associate member with vehicle instance
-			_, err = tx.Exec(`
-				INSERT INTO vehicle_members (instance_id, member_id)
-				VALUES (?, ?)
-			`, instanceID, memberID)
+	var members []models.Member
+	for i := range roles {
+		memberID, err := formID(r.PostForm[prefix+"member_id[]"], i)
+		if err != nil {
+			return nil, err
+		}
+		m := models.Member{ID: memberID, Role: roles[i], Rank: ranks[i]}
+		for _, weaponID := range r.PostForm[fmt.Sprintf("%sweapons_%d[]", prefix, i)] {
+			id, err := strconv.Atoi(weaponID)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Handle weapons for this vehicle member
-			weaponIDs := r.PostForm[fmt.Sprintf("vehicle_%d_weapons_%d[]", i, j)]
-			for _, weaponID := range weaponIDs {
-				_, err = tx.Exec(`
-					INSERT INTO members_weapons (member_id, weapon_id)
-					VALUES (?, ?)
-				`, memberID, weaponID)
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
+				return nil, fmt.Errorf("invalid weapon ID: %s", weaponID)
 			}
+			m.Weapons = append(m.Weapons, models.Weapon{ID: id})
 		}
+		members = append(members, m)
 	}
+	return members, nil
+}
 
-	// Update group size
-	_, err = tx.Exec("UPDATE groups SET group_size = ? WHERE group_id = ?", totalMembers, groupID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// formID parses the optional ID at position i of a repeated form field.
+// Missing or empty values mean the entry is new and yield 0.
+func formID(values []string, i int) (int, error) {
+	if i >= len(values) || values[i] == "" {
+		return 0, nil
 	}
-
-	if err := tx.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	id, err := strconv.Atoi(values[i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID: %s", values[i])
 	}
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return id, nil
 }
 
 // EditGroupHandler handles editing existing groups
-func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
 		http.NotFound(w, r)
@@ -373,29 +448,18 @@ func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Start transaction
-		tx, err := database.DB.Begin()
+		group, err := parseGroupForm(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer tx.Rollback()
-
-		// Update group with country code
-		_, err = tx.Exec(`
-			UPDATE groups 
-			SET group_name = ?, group_nationality = ?
-			WHERE group_id = ?
-		`, r.FormValue("name"), countryCode, groupID)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		group.Nationality = countryCode
 
-		// Process the rest of the form data...
-		// ... (your existing code for processing members, teams, etc.)
-
-		if err := tx.Commit(); err != nil {
+		if err := a.Groups.UpdateGroup(groupID, group, changedBy(r)); err != nil {
+			if isGroupInputError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -405,7 +469,11 @@ func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle GET request
-	group, err := database.GetGroupDetails(groupID)
+	group, err := a.Groups.GetGroupDetails(groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting group details: %v", err)
 		http.Error(w, "Failed to get group details", http.StatusInternalServerError)
@@ -413,7 +481,7 @@ func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get weapon options
-	weaponOptions, err := database.GetWeapons()
+	weaponOptions, err := a.Weapons.GetWeapons()
 	if err != nil {
 		log.Printf("Error getting weapons: %v", err)
 		http.Error(w, "Failed to get weapons", http.StatusInternalServerError)
@@ -421,13 +489,21 @@ func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get vehicle options
-	vehicleOptions, err := database.GetVehicles()
+	vehicleOptions, err := a.Vehicles.GetVehicles()
 	if err != nil {
 		log.Printf("Error getting vehicles: %v", err)
 		http.Error(w, "Failed to get vehicles", http.StatusInternalServerError)
 		return
 	}
 
+	// Get the groups this group can be placed under
+	parentOptions, err := a.Groups.GetParentCandidates(groupID)
+	if err != nil {
+		log.Printf("Error getting parent groups: %v", err)
+		http.Error(w, "Failed to get parent groups", http.StatusInternalServerError)
+		return
+	}
+
 	// Convert data to JSON for template
 	weaponOptionsJSON, err := json.Marshal(weaponOptions)
 	if err != nil {
@@ -455,9 +531,11 @@ func EditGroupHandler(w http.ResponseWriter, r *http.Request) {
 		"WeaponOptions":  string(weaponOptionsJSON),
 		"VehicleOptions": string(vehicleOptionsJSON),
 		"Nationality":    group.Nationality,
+		"ParentID":       group.ParentID,
+		"ParentOptions":  parentOptions,
 	}
 
-	if err := templates.ExecuteTemplate(w, "edit_group.html", data); err != nil {
+	if err := a.render(w, r, "edit_group.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		// Don't write an error header here since the template might have already written a response
 	}
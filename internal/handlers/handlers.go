@@ -2,23 +2,20 @@ package handlers
 
 import (
 	"html/template"
+	"io"
 	"net/http"
 	"path/filepath"
 	"reflect"
 	"fmt"
 	"strings"
 	
-	"orbat/internal/database"
 	"github.com/biter777/countries"
+	"orbat/internal/auth"
+	"orbat/internal/models"
 )
 
-// Templates is the global template cache
-var templates *template.Template
-
-// Initialize sets up the templates with custom functions
-func Initialize(templatesDir string) error {
-	var err error
-	
+// parseTemplates parses the page templates with custom functions
+func parseTemplates(templatesDir string) (*template.Template, error) {
 	// Create function map
 	funcMap := template.FuncMap{
 		"countryCode": func(name string) string {
@@ -37,20 +34,39 @@ func Initialize(templatesDir string) error {
 			}
 			return template.HTML(`<i class="bi bi-flag"></i>`) // Fallback to generic flag
 		},
+		// groupSymbol draws a group's unit symbol inline, height pixels high
+		"groupSymbol": func(group models.Group, height int) template.HTML {
+			return template.HTML(groupSymbol(group).SizedSVG(height))
+		},
+		// Replaced for each request by render
+		"can":         func(permission string) bool { return false },
+		"currentUser": func() models.User { return models.User{} },
 	}
 	
 	// Parse templates with the function map
-	templates, err = template.New("").Funcs(funcMap).ParseGlob(filepath.Join(templatesDir, "*.html"))
+	return template.New("").Funcs(funcMap).ParseGlob(filepath.Join(templatesDir, "*.html"))
+}
+
+// render executes a page template, with the can and currentUser template
+// functions answering for the user of the request. Templates are cloned
+// before binding the functions, so the parsed set is never executed itself.
+func (a *App) render(w io.Writer, r *http.Request, name string, data interface{}) error {
+	t, err := a.templates.Clone()
 	if err != nil {
 		return err
 	}
-	return nil
+	user, _ := currentUser(r)
+	t.Funcs(template.FuncMap{
+		"can":         func(permission string) bool { return a.can(r, auth.Permission(permission)) },
+		"currentUser": func() models.User { return user },
+	})
+	return t.ExecuteTemplate(w, name, data)
 }
 
 // HealthCheckHandler handles the health check endpoint
-func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Check database connection
-	if err := database.DB.Ping(); err != nil {
+	if err := a.Ping(); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte("Database connection error: " + err.Error()))
 		return
@@ -0,0 +1,2078 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	migrations "orbat/SQL/Migrations"
+	"orbat/internal/auth"
+	"orbat/internal/database"
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// testApp is an app under test with the session of a logged-in user
+type testApp struct {
+	*App
+	session *http.Cookie
+	db      *sql.DB
+}
+
+// newTestApp creates an app backed by a fresh in-memory SQLite database with
+// all migrations applied by the app's own migration runner, and logs in
+func newTestApp(t testing.TB) *testApp {
+	t.Helper()
+
+	// A named shared-cache database lets the pool's connections see the same data
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store := database.NewStore(db)
+	migrator, err := store.Migrator(migrations.FS)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			t.Fatalf("Failed to apply migrations: %v (run the tests with -tags sqlite_fts5)", err)
+		}
+		t.Fatalf("Failed to apply migrations: %v", err)
+	}
+
+	storage.SetStore(storage.NewMemoryStore(storage.ImagePath))
+
+	app, err := NewApp(store, "../../templates")
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	ta := logIn(t, app, "tester", auth.RoleAdmin)
+	ta.db = db
+	return ta
+}
+
+// logIn creates a user with the password "password123" and returns the app
+// with a session for them
+func logIn(t testing.TB, app *App, username, role string) *testApp {
+	t.Helper()
+	hash, err := auth.HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if _, err := app.Users.CreateUser(username, hash, role); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	ta := &testApp{App: app}
+	form := url.Values{"username": {username}, "password": {"password123"}}
+	rec := do(ta, "POST", "/login", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			ta.session = cookie
+		}
+	}
+	if ta.session == nil {
+		t.Fatalf("Failed to log in, got %d: %s", rec.Code, rec.Body)
+	}
+	return ta
+}
+
+// do sends a request to the app with its session and returns the recorded response
+func do(app *testApp, method, target, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if app.session != nil {
+		req.AddCookie(app.session)
+	}
+	rec := httptest.NewRecorder()
+	app.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func doJSON(t *testing.T, app *testApp, method, target string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	return do(app, method, target, "application/json", body)
+}
+
+func TestGroupsAPI(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M4A1", Type: "Rifle", Caliber: "5.56mm"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected weapon to be created, got %d: %s", rec.Code, rec.Body)
+	}
+	var weapon models.Weapon
+	json.Unmarshal(rec.Body.Bytes(), &weapon)
+
+	group := models.GroupDetails{
+		Name:        "Rifle Squad",
+		Nationality: "United States",
+		DirectMembers: []models.Member{
+			{Role: "Squad Leader", Rank: "SSG", Weapons: []models.Weapon{{ID: weapon.ID}}},
+		},
+		Teams: []models.Team{{Name: "Alpha", Members: []models.Member{{Role: "Rifleman", Rank: "PFC"}}}},
+	}
+	rec = doJSON(t, app, "POST", "/api/v1/groups", group)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected group to be created, got %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+
+	var created models.GroupDetails
+	json.Unmarshal(do(app, "GET", location, "", nil).Body.Bytes(), &created)
+	if created.Name != "Rifle Squad" || created.Size != 2 {
+		t.Errorf("Expected Rifle Squad with 2 members, got %s with %d", created.Name, created.Size)
+	}
+	if len(created.DirectMembers) != 1 || len(created.DirectMembers[0].Weapons) != 1 {
+		t.Errorf("Expected the squad leader to carry one weapon, got %+v", created.DirectMembers)
+	}
+
+	rec = do(app, "GET", "/", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Rifle Squad") {
+		t.Errorf("Expected the groups page to list the new group, got %d", rec.Code)
+	}
+
+	if rec := do(app, "DELETE", location, "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected group to be deleted, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(app, "GET", location, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted group, got %d", rec.Code)
+	}
+}
+
+func TestGroupsAPIRejectsInvalidGroups(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name  string
+		group models.GroupDetails
+	}{
+		{"missing name", models.GroupDetails{Nationality: "US"}},
+		{"unknown country", models.GroupDetails{Name: "G", Nationality: "Atlantis"}},
+		{"unknown weapon", models.GroupDetails{
+			Name:          "G",
+			Nationality:   "US",
+			DirectMembers: []models.Member{{Role: "Rifleman", Weapons: []models.Weapon{{ID: 99}}}},
+		}},
+		{"unknown parent", models.GroupDetails{Name: "G", Nationality: "US", ParentID: 99}},
+	}
+
+	for _, tt := range tests {
+		if rec := doJSON(t, app, "POST", "/api/v1/groups", tt.group); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestImportGroups(t *testing.T) {
+	app := newTestApp(t)
+	if _, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M4", Type: "Rifle", Caliber: "5.56mm"}, "tester"); err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+
+	squad := func() models.GroupDetails {
+		return models.GroupDetails{
+			Name:        "Rifle Squad",
+			Nationality: "United States of America",
+			DirectMembers: []models.Member{
+				{Role: "Squad Leader", Weapons: []models.Weapon{{Name: "M4"}}},
+				{Role: "Automatic Rifleman", Weapons: []models.Weapon{{Name: "M249", Type: "LMG", Caliber: "5.56mm"}}},
+			},
+			Vehicles: []models.Vehicle{{Name: "M1151", Type: "Utility", Crew: []models.Member{{Role: "Driver"}}}},
+		}
+	}
+	countGroups := func() int {
+		groups, err := app.Groups.GetGroups()
+		if err != nil {
+			t.Fatalf("Failed to list groups: %v", err)
+		}
+		return len(groups)
+	}
+
+	// Equipment that is not in the catalog is reported and nothing is saved
+	_, err := app.Groups.ImportGroups([]models.GroupDetails{squad()}, false, "tester")
+	var missing *database.MissingEquipmentError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Expected a MissingEquipmentError, got %v", err)
+	}
+	if fmt.Sprint(missing.Weapons) != "[M249]" || fmt.Sprint(missing.Vehicles) != "[M1151]" {
+		t.Errorf("Expected the M249 and M1151 to be missing, got %+v", missing)
+	}
+	if n := countGroups(); n != 0 {
+		t.Errorf("Expected no groups after a refused import, got %d", n)
+	}
+
+	// A failure on a later group rolls back the catalog entries created for
+	// the earlier ones
+	tests := []struct {
+		name  string
+		group models.GroupDetails
+	}{
+		{"unknown country", models.GroupDetails{Name: "Lost Squad", Nationality: "Atlantis"}},
+		{"unknown weapon", models.GroupDetails{
+			Name:          "Lost Squad",
+			Nationality:   "US",
+			DirectMembers: []models.Member{{Role: "Rifleman", Weapons: []models.Weapon{{ID: 99}}}},
+		}},
+	}
+	for _, tt := range tests {
+		_, err := app.Groups.ImportGroups([]models.GroupDetails{squad(), tt.group}, true, "tester")
+		var refErr *database.ReferenceError
+		if !errors.As(err, &refErr) {
+			t.Errorf("%s: expected a ReferenceError, got %v", tt.name, err)
+		}
+		if n := countGroups(); n != 0 {
+			t.Errorf("%s: expected no groups after a failed import, got %d", tt.name, n)
+		}
+		if exists, _, _ := app.Weapons.WeaponExists("M249"); exists {
+			t.Errorf("%s: expected the M249 not to be created by a failed import", tt.name)
+		}
+		if exists, _, _ := app.Vehicles.VehicleExists("M1151"); exists {
+			t.Errorf("%s: expected the M1151 not to be created by a failed import", tt.name)
+		}
+	}
+
+	// With createMissing the catalog entries are created and shared
+	ids, err := app.Groups.ImportGroups([]models.GroupDetails{squad(), squad()}, true, "tester")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Expected two groups to be imported, got %v (%v)", ids, err)
+	}
+	weapons, err := app.Weapons.GetWeapons()
+	if err != nil || len(weapons) != 2 {
+		t.Errorf("Expected the M249 to be added once to the catalog, got %+v (%v)", weapons, err)
+	}
+	details, err := app.Groups.GetGroupDetails(fmt.Sprint(ids[1]))
+	if err != nil {
+		t.Fatalf("Failed to load imported group: %v", err)
+	}
+	if details.Nationality != "United States" || len(details.DirectMembers) != 2 || details.DirectMembers[1].Weapons[0].Name != "M249" {
+		t.Errorf("Unexpected imported group: %+v", details)
+	}
+	if len(details.Vehicles) != 1 || details.Vehicles[0].Name != "M1151" || details.Vehicles[0].Armament != "None" {
+		t.Errorf("Expected the M1151 to be created with no armament, got %+v", details.Vehicles)
+	}
+	entries, _, err := app.Audit.ListAuditEntries(models.AuditFilter{Username: "tester"}, models.ListOptions{})
+	if err != nil || len(entries) != 5 {
+		t.Errorf("Expected creations of the M4, M249, M1151 and both groups to be audited, got %d (%v)", len(entries), err)
+	}
+}
+
+func TestAddGroupForm(t *testing.T) {
+	app := newTestApp(t)
+
+	form := url.Values{
+		"name":        {"Weapons Team"},
+		"nationality": {"GB"},
+		"role[]":      {"Gunner", "Loader"},
+		"rank[]":      {"Cpl", "Pte"},
+	}
+	rec := do(app, "POST", "/add_group", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after adding a group, got %d: %s", rec.Code, rec.Body)
+	}
+
+	groups, err := app.Groups.GetGroups()
+	if err != nil {
+		t.Fatalf("Failed to get groups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "Weapons Team" || groups[0].Size != 2 {
+		t.Fatalf("Expected one group of 2 called Weapons Team, got %+v", groups)
+	}
+
+	rec = do(app, "GET", fmt.Sprintf("/group/%d", groups[0].ID), "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Gunner") {
+		t.Errorf("Expected the group page to show its members, got %d", rec.Code)
+	}
+}
+
+// testPNG returns a small PNG image for upload tests
+func testPNG() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestWeaponsForm(t *testing.T) {
+	app := newTestApp(t)
+
+	post := func(fields map[string]string, image []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		if image != nil {
+			fw, _ := mw.CreateFormFile("image", "m249.png")
+			fw.Write(image)
+		}
+		mw.Close()
+		return do(app, "POST", "/weapons", mw.FormDataContentType(), body.Bytes())
+	}
+
+	if rec := post(map[string]string{"name": "M249", "type": "LMG", "caliber": "5.56mm"}, []byte("image")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an upload that isn't an image, got %d", rec.Code)
+	}
+	if rec := post(map[string]string{"name": "M249", "type": "LMG", "caliber": "5.56mm"}, testPNG()); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after adding a weapon, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post(map[string]string{"name": "M249", "type": "SAW", "caliber": "5.56mm"}, nil); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate weapon, got %d", rec.Code)
+	}
+	if rec := post(map[string]string{"name": "M249", "type": "SAW", "caliber": "5.56mm", "replace": "true"}, nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after replacing a weapon, got %d: %s", rec.Code, rec.Body)
+	}
+
+	weapons, err := app.Weapons.GetWeapons()
+	if err != nil {
+		t.Fatalf("Failed to get weapons: %v", err)
+	}
+	if len(weapons) != 1 || weapons[0].Type != "SAW" {
+		t.Fatalf("Expected the weapon to be replaced, got %+v", weapons)
+	}
+
+	// Replacing without an image keeps the uploaded one, re-encoded as JPEG
+	// alongside its smaller renditions
+	imageURL := weapons[0].ImageURL.String
+	if rec := do(app, "GET", imageURL, "", nil); rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte{0xff, 0xd8}) {
+		t.Errorf("Expected a JPEG to be served from %q, got %d", imageURL, rec.Code)
+	}
+	if !weapons[0].ThumbnailURL.Valid || !strings.HasSuffix(weapons[0].ThumbnailURL.String, "-thumb.jpg") {
+		t.Errorf("Expected a thumbnail to be stored, got %+v", weapons[0].ThumbnailURL)
+	}
+}
+
+func TestAPIImageURLs(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := doJSON(t, app, "POST", "/api/v1/vehicles", models.Vehicle{Name: "M1151", Type: "Utility"})
+	var vehicle models.Vehicle
+	json.NewDecoder(rec.Body).Decode(&vehicle)
+	if _, err := app.Vehicles.SaveVehicle(vehicle, &storage.Image{
+		Key:          "vehicles/m1151",
+		URL:          "/images/vehicles/m1151.jpg",
+		MediumURL:    "/images/vehicles/m1151-medium.jpg",
+		ThumbnailURL: "/images/vehicles/m1151-thumb.jpg",
+	}, "tester"); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+	doJSON(t, app, "POST", "/api/v1/vehicles", models.Vehicle{Name: "M1126", Type: "APC"})
+	rec = doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{
+		Name:        "Patrol",
+		Nationality: "US",
+		Vehicles:    []models.Vehicle{{ID: vehicle.ID}},
+	})
+	location := rec.Header().Get("Location")
+
+	// Image URLs are written as strings
+	for _, target := range []string{"/api/v1/vehicles", "/api/v1/vehicles/" + vehicle.ID, location} {
+		body := do(app, "GET", target, "", nil).Body.String()
+		if strings.Contains(body, `"Valid"`) || !strings.Contains(body, `"ImageURL":"/images/vehicles/m1151.jpg"`) {
+			t.Errorf("%s: expected the image URLs as strings, got %s", target, body)
+		}
+	}
+
+	if body := do(app, "GET", "/api/v1/vehicles?type=APC", "", nil).Body.String(); !strings.Contains(body, `"ImageURL":null`) {
+		t.Errorf("Expected a null image URL for a vehicle without an image, got %s", body)
+	}
+
+	// The group payload can be sent back unchanged
+	var group models.GroupDetails
+	json.NewDecoder(do(app, "GET", location, "", nil).Body).Decode(&group)
+	if len(group.Vehicles) != 1 || group.Vehicles[0].ImageURL.String != "/images/vehicles/m1151.jpg" {
+		t.Errorf("Expected the image URLs to decode, got %+v", group.Vehicles[0])
+	}
+	if rec := doJSON(t, app, "PUT", location, group); rec.Code != http.StatusOK {
+		t.Errorf("Expected the group to be updated, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Audit entries written before the URLs had their own encoding still decode
+	var old models.Vehicle
+	err := json.Unmarshal([]byte(`{"ImageURL": {"String": "/images/old.jpg", "Valid": true}, "MediumURL": {"String": "", "Valid": false}}`), &old)
+	if err != nil || old.ImageURL.String != "/images/old.jpg" || !old.ImageURL.Valid || old.MediumURL.Valid {
+		t.Errorf("Expected the old encoding to decode, got %+v (%v)", old, err)
+	}
+}
+
+func TestCatalogEditPages(t *testing.T) {
+	app := newTestApp(t)
+	images := storage.NewMemoryStore(storage.ImagePath)
+	storage.SetStore(images)
+
+	post := func(target string, fields map[string]string, filename string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		if filename != "" {
+			fw, _ := mw.CreateFormFile("image", filename)
+			fw.Write(testPNG())
+		}
+		mw.Close()
+		return do(app, "POST", target, mw.FormDataContentType(), body.Bytes())
+	}
+
+	post("/weapons", map[string]string{"name": "M249", "type": "LMG", "caliber": "5.56mm"}, "m249.png")
+	post("/weapons", map[string]string{"name": "M240", "type": "GPMG", "caliber": "7.62mm"}, "")
+	_, weaponID, _ := app.Weapons.WeaponExists("M249")
+	editURL := fmt.Sprintf("/weapon/%d/edit", weaponID)
+
+	if rec := do(app, "GET", editURL, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="M249"`) {
+		t.Fatalf("Expected the edit form, got %d", rec.Code)
+	}
+	if rec := post(editURL, map[string]string{"name": "M240", "type": "LMG", "caliber": "5.56mm"}, ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 renaming to a taken name, got %d", rec.Code)
+	}
+
+	// Renaming with a new image deletes the old one from storage
+	rec := post(editURL, map[string]string{"name": "M249 SAW", "type": "LMG", "caliber": "5.56mm"}, "saw.png")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after editing, got %d: %s", rec.Code, rec.Body)
+	}
+	weapon, err := app.Weapons.GetWeapon(fmt.Sprint(weaponID))
+	if err != nil || weapon.Name != "M249 SAW" {
+		t.Fatalf("Expected the weapon to be renamed, got %+v (%v)", weapon, err)
+	}
+	keys := images.Keys()
+	sort.Strings(keys)
+	if len(keys) != 3 || !strings.HasPrefix(keys[0], "weapons/m249-saw-") || !strings.HasSuffix(keys[1], "-thumb.jpg") {
+		t.Errorf("Expected only the new image and its renditions to be stored, got %v", keys)
+	}
+
+	vehicleID, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "HMMWV", Type: "Utility"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	vehicleURL := fmt.Sprintf("/vehicle/%d/edit", vehicleID)
+	stored := make(map[string]bool)
+	for _, filename := range []string{"hmmwv.png", "m1151.png"} {
+		rec := post(vehicleURL, map[string]string{"name": "M1151", "type": "Utility", "armament": "M2"}, filename)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("Expected a redirect after editing, got %d: %s", rec.Code, rec.Body)
+		}
+
+		// Each upload is stored under a new key and the one it replaces is deleted
+		var vehicleKeys []string
+		for _, key := range images.Keys() {
+			if strings.HasPrefix(key, "vehicles/") {
+				vehicleKeys = append(vehicleKeys, key)
+			}
+		}
+		if len(vehicleKeys) != 3 {
+			t.Errorf("Expected only the %s image and its renditions to be stored, got %v", filename, vehicleKeys)
+		}
+		for _, key := range vehicleKeys {
+			if stored[key] {
+				t.Errorf("Expected the image before %s to be replaced, got %v", filename, vehicleKeys)
+			}
+			if !strings.HasPrefix(key, "vehicles/m1151-") {
+				t.Errorf("Expected the image to be stored under the new name, got %s", key)
+			}
+		}
+		stored = make(map[string]bool)
+		for _, key := range vehicleKeys {
+			stored[key] = true
+		}
+	}
+
+	// Names are reduced to characters that need no escaping in image URLs
+	for _, test := range []struct {
+		name   string
+		prefix string
+	}{
+		{"Mk 12 #2 ?50% Über", "weapons/mk-12-2-50-ber-"},
+		{"Тип 56", "weapons/56-"},
+		{"№ ?#%", "weapons/weapon-"},
+	} {
+		if rec := post("/weapons", map[string]string{"name": test.name, "type": "Rifle", "caliber": "5.56mm"}, "rifle.png"); rec.Code != http.StatusSeeOther {
+			t.Fatalf("Expected a redirect after adding %s, got %d: %s", test.name, rec.Code, rec.Body)
+		}
+		_, id, _ := app.Weapons.WeaponExists(test.name)
+		weapon, err := app.Weapons.GetWeapon(fmt.Sprint(id))
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", test.name, err)
+		}
+		key := strings.TrimPrefix(weapon.ImageURL.String, storage.ImagePath)
+		if !strings.HasPrefix(key, test.prefix) || strings.Trim(key, "abcdefghijklmnopqrstuvwxyz0123456789-./") != "" {
+			t.Errorf("Expected %s to be stored under %s, got %s", test.name, test.prefix, weapon.ImageURL.String)
+		}
+	}
+
+	viewer := logIn(t, app.App, "viewer", auth.RoleViewer)
+	if rec := do(viewer, "GET", vehicleURL, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected viewers to be refused the edit form, got %d", rec.Code)
+	}
+	if rec := do(app, "GET", "/weapon/99/edit", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing weapon, got %d", rec.Code)
+	}
+}
+
+func TestMissingPages(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		method string
+		target string
+	}{
+		{"GET", "/group/999"},
+		{"GET", "/group/999/edit"},
+		{"GET", "/weapon/999"},
+		{"POST", "/weapon/999/delete"},
+		{"GET", "/weapon/999/edit"},
+		{"GET", "/vehicle/999"},
+		{"POST", "/vehicle/999/delete"},
+	}
+	for _, tt := range tests {
+		if rec := do(app, tt.method, tt.target, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d: %s", tt.method, tt.target, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCountryRename(t *testing.T) {
+	app := newTestApp(t)
+
+	movedID, err := app.Groups.CreateGroup(models.GroupDetails{Name: "Section", Nationality: "AU"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	otherID, err := app.Groups.CreateGroup(models.GroupDetails{Name: "Troop", Nationality: "GB"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	form := url.Values{"name": {"New Zealand"}}
+	rec := do(app, "POST", "/country/AU", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after renaming, got %d: %s", rec.Code, rec.Body)
+	}
+
+	groups, err := app.Groups.GetGroups()
+	if err != nil {
+		t.Fatalf("Failed to get groups: %v", err)
+	}
+	for _, g := range groups {
+		if int64(g.ID) == movedID && g.Nationality != "New Zealand" {
+			t.Errorf("Expected the group to move to New Zealand, got %+v", g)
+		}
+	}
+
+	// The move is in the history of each group moved, and only of those
+	tests := []struct {
+		groupID   int64
+		revisions int
+	}{
+		{movedID, 2},
+		{otherID, 1},
+	}
+	for _, tt := range tests {
+		revisions, err := app.Groups.GetGroupRevisions(fmt.Sprint(tt.groupID))
+		if err != nil || len(revisions) != tt.revisions {
+			t.Errorf("group %d: expected %d revisions, got %d (%v)", tt.groupID, tt.revisions, len(revisions), err)
+		}
+	}
+	entries, _, err := app.Audit.ListAuditEntries(models.AuditFilter{EntityType: "group", EntityID: fmt.Sprint(movedID)}, models.ListOptions{})
+	if err != nil || len(entries) != 2 || !strings.Contains(entries[0].Before, "Australia") || !strings.Contains(entries[0].After, "New Zealand") {
+		t.Errorf("Expected the move from Australia to New Zealand to be recorded, got %+v (%v)", entries, err)
+	}
+}
+
+func TestGroupSymbols(t *testing.T) {
+	app := newTestApp(t)
+	rec := doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{Name: "1st Tank Platoon", Nationality: "GB"})
+	var group models.GroupDetails
+	json.NewDecoder(rec.Body).Decode(&group)
+
+	// Lists draw the symbols inline rather than requesting one per group
+	rec = do(app, "GET", "/", "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "<title>friend Armour Platoon") || strings.Contains(body, "symbol.svg") {
+		t.Errorf("Expected the group list to embed the symbol")
+	}
+
+	rec = do(app, "GET", "/group/"+group.ID+"/symbol.svg", "", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") == "no-cache" {
+		t.Fatalf("Expected a cacheable symbol, got %d with %v", rec.Code, rec.Header())
+	}
+	req := httptest.NewRequest("GET", "/group/"+group.ID+"/symbol.svg", nil)
+	req.AddCookie(app.session)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	app.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged symbol, got %d", rec.Code)
+	}
+	if rec := do(app, "GET", "/group/99/symbol.svg", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing group, got %d", rec.Code)
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	app := newTestApp(t)
+
+	for i, nationality := range []string{"US", "GB", "US", "US", "CA"} {
+		group := models.GroupDetails{Name: fmt.Sprintf("Group %d", i), Nationality: nationality}
+		for j := 0; j <= i; j++ {
+			group.DirectMembers = append(group.DirectMembers, models.Member{Role: "Rifleman"})
+		}
+		if _, err := app.Groups.CreateGroup(group, "tester"); err != nil {
+			t.Fatalf("Failed to create group: %v", err)
+		}
+	}
+
+	rec := do(app, "GET", "/api/v1/groups?nationality=United+States&sort=size&order=desc&limit=2", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var groups []models.Group
+	json.Unmarshal(rec.Body.Bytes(), &groups)
+	if len(groups) != 2 || groups[0].Name != "Group 3" || groups[1].Name != "Group 2" {
+		t.Errorf("Expected the two largest US groups, got %+v", groups)
+	}
+	if total := rec.Header().Get("X-Total-Count"); total != "3" {
+		t.Errorf("Expected 3 matching groups, got %q", total)
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, "offset=2") || !strings.Contains(link, `rel="next"`) {
+		t.Errorf("Expected a link to the next page, got %q", link)
+	}
+
+	json.Unmarshal(do(app, "GET", "/api/v1/groups?min_size=2&max_size=4", "", nil).Body.Bytes(), &groups)
+	if len(groups) != 3 {
+		t.Errorf("Expected 3 groups of 2 to 4 members, got %+v", groups)
+	}
+
+	for _, target := range []string{"/api/v1/groups?sort=parent", "/api/v1/groups?limit=0", "/api/v1/groups?order=up", "/?nationality=Atlantis"} {
+		if rec := do(app, "GET", target, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+
+	rec = do(app, "GET", "/?limit=2&offset=2", "", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "Group 2") ||
+		strings.Contains(body, "Group 1<") || !strings.Contains(body, "3&ndash;4 of 5") {
+		t.Errorf("Expected the second page of groups, got %d", rec.Code)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	app := newTestApp(t)
+	anonymous := &testApp{App: app.App}
+
+	// Without a session, pages redirect to the login page and the API refuses
+	rec := do(anonymous, "GET", "/weapons?type=LMG", "", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?next=%2Fweapons%3Ftype%3DLMG" {
+		t.Errorf("Expected a redirect to log in, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := doJSON(t, anonymous, "POST", "/api/v1/weapons", models.Weapon{Name: "M240"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 from the API, got %d", rec.Code)
+	}
+	if rec := do(anonymous, "GET", "/health", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the health check to stay public, got %d", rec.Code)
+	}
+
+	// Anonymous reads can be allowed, but writes still need a login
+	app.AnonymousRead = true
+	if rec := do(anonymous, "GET", "/weapons", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected anonymous reads to be allowed, got %d", rec.Code)
+	}
+	if rec := do(anonymous, "POST", "/group/1/delete", "", nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("Expected deleting to need a login, got %d", rec.Code)
+	}
+	app.AnonymousRead = false
+
+	form := url.Values{"username": {"TESTER"}, "password": {"wrong password"}, "next": {"//evil.example"}}
+	if rec := do(anonymous, "POST", "/login", "application/x-www-form-urlencoded", []byte(form.Encode())); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to be refused, got %d", rec.Code)
+	}
+	form.Set("password", "password123")
+	rec = do(anonymous, "POST", "/login", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Errorf("Expected a redirect home after logging in, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookie := rec.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected a secure session cookie, got %+v", cookie)
+	}
+
+	// Logging out ends the session
+	if rec := do(app, "POST", "/logout", "", nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after logging out, got %d", rec.Code)
+	}
+	if rec := do(app, "GET", "/", "", nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("Expected the old session to be refused, got %d", rec.Code)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	admin := newTestApp(t)
+	editor := logIn(t, admin.App, "editor", auth.RoleEditor)
+	viewer := logIn(t, admin.App, "viewer", auth.RoleViewer)
+
+	rec := doJSON(t, admin, "POST", "/api/v1/weapons", models.Weapon{Name: "M240", Type: "LMG"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the admin to add a weapon, got %d: %s", rec.Code, rec.Body)
+	}
+	var weapon models.Weapon
+	json.NewDecoder(rec.Body).Decode(&weapon)
+
+	// Viewers can read but not change anything, and do not see the buttons
+	rec = do(viewer, "GET", "/", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a viewer to see the groups, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), `href="/add_group"`) {
+		t.Error("Expected the add group button to be hidden from a viewer")
+	}
+	if rec := doJSON(t, viewer, "POST", "/api/v1/groups", models.GroupDetails{Name: "Alpha", Nationality: "United States"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer to be refused adding a group, got %d", rec.Code)
+	}
+	if rec := do(viewer, "GET", "/add_group", "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer to be refused the add group form, got %d", rec.Code)
+	}
+
+	// Editors change groups and the catalog, but cannot delete from it
+	if rec := doJSON(t, editor, "POST", "/api/v1/groups", models.GroupDetails{Name: "Alpha", Nationality: "United States"}); rec.Code != http.StatusCreated {
+		t.Errorf("Expected an editor to add a group, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(editor, "GET", fmt.Sprintf("/weapon/%d", weapon.ID), "", nil)
+	if strings.Contains(rec.Body.String(), "/delete") {
+		t.Error("Expected the delete button to be hidden from an editor")
+	}
+	if rec := do(editor, "DELETE", fmt.Sprintf("/api/v1/weapons/%d", weapon.ID), "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected an editor to be refused deleting a weapon, got %d", rec.Code)
+	}
+	form := url.Values{"name": {"Somewhere"}}
+	if rec := do(editor, "POST", "/country/US", "application/x-www-form-urlencoded", []byte(form.Encode())); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected an editor to be refused renaming a country, got %d", rec.Code)
+	}
+
+	if rec := do(admin, "DELETE", fmt.Sprintf("/api/v1/weapons/%d", weapon.ID), "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected the admin to delete a weapon, got %d", rec.Code)
+	}
+
+	// Calibers follow the same rules in the API as in the forms
+	if rec := doJSON(t, viewer, "POST", "/api/v1/calibers", models.Caliber{Name: "30x173mm"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer to be refused adding a caliber, got %d", rec.Code)
+	}
+	rec = doJSON(t, editor, "POST", "/api/v1/calibers", models.Caliber{Name: "30x173mm", Aliases: []string{"30mm"}})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected an editor to add a caliber, got %d: %s", rec.Code, rec.Body)
+	}
+	caliberURL := rec.Header().Get("Location")
+	rec = doJSON(t, editor, "PUT", caliberURL, models.Caliber{Name: "30x173mm NATO", Aliases: []string{"30mm", "30x173mm"}, Substitutes: []models.Caliber{{ID: 1}}})
+	var caliber models.Caliber
+	json.NewDecoder(rec.Body).Decode(&caliber)
+	if rec.Code != http.StatusOK || caliber.Name != "30x173mm NATO" || len(caliber.Aliases) != 2 || len(caliber.Substitutes) != 1 {
+		t.Errorf("Expected an editor to edit a caliber, got %d: %+v", rec.Code, caliber)
+	}
+	if rec := doJSON(t, editor, "POST", "/api/v1/calibers", models.Caliber{Name: "Bushmaster", Aliases: []string{"30MM"}}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an alias of another caliber, got %d", rec.Code)
+	}
+	if rec := do(editor, "DELETE", caliberURL, "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected an editor to be refused deleting a caliber, got %d", rec.Code)
+	}
+	if rec := do(admin, "DELETE", caliberURL, "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected the admin to delete a caliber, got %d", rec.Code)
+	}
+	if rec := do(viewer, "GET", caliberURL, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted caliber, got %d", rec.Code)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M249", Type: "LMG"})
+	var weapon models.Weapon
+	json.NewDecoder(rec.Body).Decode(&weapon)
+	rec = doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{
+		Name:          "Fire Team",
+		Nationality:   "United States",
+		DirectMembers: []models.Member{{Role: "Automatic Rifleman", Weapons: []models.Weapon{{ID: weapon.ID}}}},
+	})
+	var group models.GroupDetails
+	json.NewDecoder(rec.Body).Decode(&group)
+
+	// Taking the weapon away from a member shows in the group's history
+	memberID := group.DirectMembers[0].ID
+	if rec := do(app, "POST", fmt.Sprintf("/member/%d/weapons", memberID), "application/x-www-form-urlencoded", nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the member's weapons to be updated, got %d", rec.Code)
+	}
+	entries, total, err := app.Audit.ListAuditEntries(models.AuditFilter{EntityType: "group", EntityID: group.ID}, models.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list audit entries: %v", err)
+	}
+	if total != 2 || entries[0].Action != "update" || entries[1].Action != "create" {
+		t.Fatalf("Expected the group's creation and the member change, got %+v", entries)
+	}
+	if e := entries[0]; e.Username != "tester" || e.EntityType != "group" || !strings.Contains(e.Before, "M249") || strings.Contains(e.After, "M249") {
+		t.Errorf("Expected the removed weapon to be recorded as a group update, got %+v", e)
+	}
+	revisions, err := app.Groups.GetGroupRevisions(group.ID)
+	if err != nil || len(revisions) != 2 || len(revisions[1].Group.DirectMembers[0].Weapons) != 0 {
+		t.Errorf("Expected the member change to be a revision of the group, got %+v (%v)", revisions, err)
+	}
+
+	if rec := do(app, "DELETE", fmt.Sprintf("/api/v1/weapons/%d", weapon.ID), "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the weapon to be deleted, got %d", rec.Code)
+	}
+	entries, _, err = app.Audit.ListAuditEntries(models.AuditFilter{EntityType: "weapon", Username: "TESTER"}, models.ListOptions{})
+	if err != nil || len(entries) != 2 || entries[0].Action != "delete" || entries[0].After != "" || !strings.Contains(entries[0].Before, "M249") {
+		t.Errorf("Expected the weapon's creation and deletion, got %+v (%v)", entries, err)
+	}
+
+	rec = do(app, "GET", "/audit?type=group&id="+group.ID, "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Automatic Rifleman") {
+		t.Errorf("Expected the group history page, got %d", rec.Code)
+	}
+	viewer := logIn(t, app.App, "viewer", auth.RoleViewer)
+	if rec := do(viewer, "GET", "/audit", "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected viewers to be refused the audit log, got %d", rec.Code)
+	}
+}
+
+func TestAuditFailure(t *testing.T) {
+	app := newTestApp(t)
+	rec := doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{Name: "Section", Nationality: "US"})
+	var group models.GroupDetails
+	json.NewDecoder(rec.Body).Decode(&group)
+
+	_, err := app.db.Exec(`CREATE TRIGGER audit_unavailable BEFORE INSERT ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'audit log unavailable'); END`)
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	// A change that cannot be audited is not saved
+	if rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M249", Type: "LMG"}); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the weapon to be refused, got %d", rec.Code)
+	}
+	if exists, _, _ := app.Weapons.WeaponExists("M249"); exists {
+		t.Error("Expected the weapon not to be saved without its audit entry")
+	}
+	group.Name = "Renamed Section"
+	if rec := doJSON(t, app, "PUT", "/api/v1/groups/"+group.ID, group); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the group update to be refused, got %d", rec.Code)
+	}
+	if details, _ := app.Groups.GetGroupDetails(group.ID); details.Name != "Section" {
+		t.Errorf("Expected the group to keep its name, got %q", details.Name)
+	}
+}
+
+func TestGroupRevisions(t *testing.T) {
+	app := newTestApp(t)
+
+	rec := doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{
+		Name:          "Fire Team",
+		Nationality:   "United States",
+		DirectMembers: []models.Member{{Role: "Team Leader", Rank: "SGT"}},
+	})
+	location := rec.Header().Get("Location")
+	var group models.GroupDetails
+	json.NewDecoder(do(app, "GET", location, "", nil).Body).Decode(&group)
+
+	group.Name = "Alpha Team"
+	if rec := doJSON(t, app, "PUT", location, group); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the group to be updated, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(app, "DELETE", location, "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the group to be deleted, got %d", rec.Code)
+	}
+
+	revisionsURL := "/group/" + group.ID + "/revisions"
+	rec = do(app, "GET", revisionsURL+"?from=1&to=2", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Renamed from &#34;Fire Team&#34; to &#34;Alpha Team&#34;") {
+		t.Fatalf("Expected the rename between revisions 1 and 2, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(app, "GET", revisionsURL+"?from=1&to=current", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected no current version of a deleted group, got %d", rec.Code)
+	}
+
+	// Restoring brings the group back under its old ID
+	if rec := do(app, "POST", revisionsURL+"/2/restore", "", nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after restoring, got %d: %s", rec.Code, rec.Body)
+	}
+	var restored models.GroupDetails
+	json.NewDecoder(do(app, "GET", location, "", nil).Body).Decode(&restored)
+	if restored.Name != "Alpha Team" || restored.Size != 1 {
+		t.Errorf("Expected Alpha Team with 1 member, got %+v", restored)
+	}
+	revisions, err := app.Groups.GetGroupRevisions(group.ID)
+	if err != nil || len(revisions) != 4 || revisions[3].Action != "restore" {
+		t.Errorf("Expected the restore to be the fourth revision, got %+v (%v)", revisions, err)
+	}
+
+	// A deleted group's ID is never given to a new group
+	if rec := do(app, "DELETE", location, "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the group to be deleted, got %d", rec.Code)
+	}
+	rec = doJSON(t, app, "POST", "/api/v1/groups", models.GroupDetails{Name: "Bravo Team", Nationality: "United States"})
+	if rec.Header().Get("Location") == location {
+		t.Errorf("Expected a new ID for a new group, got %s", location)
+	}
+
+	viewer := logIn(t, app.App, "viewer", auth.RoleViewer)
+	if rec := do(viewer, "POST", revisionsURL+"/1/restore", "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected viewers to be refused a restore, got %d", rec.Code)
+	}
+}
+
+func TestUpdateGroupMatchesByID(t *testing.T) {
+	app := newTestApp(t)
+
+	rifleID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M4", Type: "Rifle"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	pistolID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M17", Type: "Pistol"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	humveeID, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "M1151", Type: "Utility", Armament: "M2"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	strykerID, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "M1126", Type: "APC", Armament: "M2"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	rifle := models.Weapon{ID: int(rifleID)}
+	pistol := models.Weapon{ID: int(pistolID)}
+
+	// Each case edits a fresh copy of this group: a leader, teams Alpha and
+	// Bravo and a crewed M1151
+	newGroup := func() models.GroupDetails {
+		id, err := app.Groups.CreateGroup(models.GroupDetails{
+			Name:          "Patrol",
+			Nationality:   "US",
+			DirectMembers: []models.Member{{Role: "Leader", Rank: "SSG", Weapons: []models.Weapon{rifle, pistol}}},
+			Teams: []models.Team{
+				{Name: "Alpha", Members: []models.Member{
+					{Role: "Grenadier", Rank: "SPC", Weapons: []models.Weapon{rifle}},
+					{Role: "Rifleman", Rank: "PFC", Weapons: []models.Weapon{rifle}},
+				}},
+				{Name: "Bravo", Members: []models.Member{{Role: "Medic", Rank: "SPC"}}},
+			},
+			Vehicles: []models.Vehicle{{ID: fmt.Sprint(humveeID), Crew: []models.Member{{Role: "Driver", Rank: "PFC"}}}},
+		}, "tester")
+		if err != nil {
+			t.Fatalf("Failed to create group: %v", err)
+		}
+		group, err := app.Groups.GetGroupDetails(fmt.Sprint(id))
+		if err != nil {
+			t.Fatalf("Failed to load group: %v", err)
+		}
+		return group
+	}
+
+	// place finds a member by ID and returns where it is and the member
+	place := func(g models.GroupDetails, memberID int) (string, models.Member) {
+		for _, m := range g.DirectMembers {
+			if m.ID == memberID {
+				return "group", m
+			}
+		}
+		for _, team := range g.Teams {
+			for _, m := range team.Members {
+				if m.ID == memberID {
+					return "team " + team.Name, m
+				}
+			}
+		}
+		for _, v := range g.Vehicles {
+			for _, m := range v.Crew {
+				if m.ID == memberID {
+					return "vehicle " + v.Name, m
+				}
+			}
+		}
+		return "", models.Member{}
+	}
+	weaponNames := func(m models.Member) string {
+		var names []string
+		for _, w := range m.Weapons {
+			names = append(names, w.Name)
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+	teamNames := func(g models.GroupDetails) string {
+		var names []string
+		for _, team := range g.Teams {
+			names = append(names, fmt.Sprintf("%s:%d", team.Name, team.ID))
+		}
+		return strings.Join(names, " ")
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(g *models.GroupDetails)
+		check func(before, after models.GroupDetails) string
+	}{
+		{
+			name: "member moves from the group into a team",
+			edit: func(g *models.GroupDetails) {
+				g.Teams[1].Members = append(g.Teams[1].Members, g.DirectMembers[0])
+				g.DirectMembers = nil
+			},
+			check: func(before, after models.GroupDetails) string {
+				where, m := place(after, before.DirectMembers[0].ID)
+				if where != "team Bravo" || m.Role != "Leader" || weaponNames(m) != "M17,M4" {
+					return fmt.Sprintf("expected the leader to keep their ID and weapons in Bravo, found %q %+v", where, m)
+				}
+				return ""
+			},
+		},
+		{
+			name: "member moves from a team into a vehicle crew",
+			edit: func(g *models.GroupDetails) {
+				g.Vehicles[0].Crew = append(g.Vehicles[0].Crew, g.Teams[0].Members[1])
+				g.Teams[0].Members = g.Teams[0].Members[:1]
+			},
+			check: func(before, after models.GroupDetails) string {
+				if where, _ := place(after, before.Teams[0].Members[1].ID); where != "vehicle M1151" {
+					return fmt.Sprintf("expected the rifleman in the M1151's crew, found %q", where)
+				}
+				if after.Teams[0].Size != 1 {
+					return fmt.Sprintf("expected Alpha's size to be 1, got %d", after.Teams[0].Size)
+				}
+				return ""
+			},
+		},
+		{
+			name: "member moves from a vehicle crew into the group",
+			edit: func(g *models.GroupDetails) {
+				g.DirectMembers = append(g.DirectMembers, g.Vehicles[0].Crew[0])
+				g.Vehicles[0].Crew = nil
+			},
+			check: func(before, after models.GroupDetails) string {
+				if where, _ := place(after, before.Vehicles[0].Crew[0].ID); where != "group" || len(after.Vehicles[0].Crew) != 0 {
+					return fmt.Sprintf("expected the driver to leave the crew for the group, found %q", where)
+				}
+				return ""
+			},
+		},
+		{
+			name: "member moves between teams and is promoted",
+			edit: func(g *models.GroupDetails) {
+				medic := g.Teams[1].Members[0]
+				medic.Rank = "SGT"
+				g.Teams[0].Members = append(g.Teams[0].Members, medic)
+				g.Teams[1].Members = nil
+			},
+			check: func(before, after models.GroupDetails) string {
+				where, m := place(after, before.Teams[1].Members[0].ID)
+				if where != "team Alpha" || m.Rank != "SGT" {
+					return fmt.Sprintf("expected the promoted medic in Alpha, found %q %+v", where, m)
+				}
+				return ""
+			},
+		},
+		{
+			name: "team is inserted",
+			edit: func(g *models.GroupDetails) {
+				g.Teams = append(g.Teams, models.Team{Name: "Charlie", Members: []models.Member{{Role: "Rifleman"}}})
+			},
+			check: func(before, after models.GroupDetails) string {
+				if len(after.Teams) != 3 || after.Teams[0].ID != before.Teams[0].ID || after.Teams[1].ID != before.Teams[1].ID || after.Teams[2].Size != 1 {
+					return fmt.Sprintf("expected Charlie to be added beside the existing teams, got %s", teamNames(after))
+				}
+				return ""
+			},
+		},
+		{
+			name: "team is deleted with its members",
+			edit: func(g *models.GroupDetails) {
+				g.Teams = g.Teams[:1]
+			},
+			check: func(before, after models.GroupDetails) string {
+				if len(after.Teams) != 1 || after.Teams[0].ID != before.Teams[0].ID {
+					return fmt.Sprintf("expected only Alpha to remain, got %s", teamNames(after))
+				}
+				return ""
+			},
+		},
+		{
+			name: "team is deleted but its member is kept",
+			edit: func(g *models.GroupDetails) {
+				g.DirectMembers = append(g.DirectMembers, g.Teams[1].Members[0])
+				g.Teams = g.Teams[:1]
+			},
+			check: func(before, after models.GroupDetails) string {
+				if where, _ := place(after, before.Teams[1].Members[0].ID); where != "group" || len(after.Teams) != 1 {
+					return fmt.Sprintf("expected the medic to outlive Bravo, found %q and teams %s", where, teamNames(after))
+				}
+				return ""
+			},
+		},
+		{
+			name: "team is renamed in place",
+			edit: func(g *models.GroupDetails) {
+				g.Teams[0].Name = "Assault"
+			},
+			check: func(before, after models.GroupDetails) string {
+				if after.Teams[0].ID != before.Teams[0].ID || after.Teams[0].Name != "Assault" {
+					return fmt.Sprintf("expected Alpha to be renamed, got %s", teamNames(after))
+				}
+				return ""
+			},
+		},
+		{
+			name: "vehicle instance is inserted",
+			edit: func(g *models.GroupDetails) {
+				g.Vehicles = append(g.Vehicles, models.Vehicle{ID: fmt.Sprint(strykerID), Crew: []models.Member{{Role: "Gunner"}}})
+			},
+			check: func(before, after models.GroupDetails) string {
+				if len(after.Vehicles) != 2 || after.Vehicles[0].InstanceID != before.Vehicles[0].InstanceID ||
+					after.Vehicles[1].Name != "M1126" || len(after.Vehicles[1].Crew) != 1 {
+					return fmt.Sprintf("expected a crewed M1126 beside the M1151, got %+v", after.Vehicles)
+				}
+				return ""
+			},
+		},
+		{
+			name: "vehicle instance is deleted with its crew",
+			edit: func(g *models.GroupDetails) {
+				g.Vehicles = nil
+			},
+			check: func(before, after models.GroupDetails) string {
+				if len(after.Vehicles) != 0 {
+					return fmt.Sprintf("expected no vehicles, got %+v", after.Vehicles)
+				}
+				return ""
+			},
+		},
+		{
+			name: "vehicle instance changes vehicle and keeps its crew",
+			edit: func(g *models.GroupDetails) {
+				g.Vehicles[0].ID = fmt.Sprint(strykerID)
+			},
+			check: func(before, after models.GroupDetails) string {
+				v := after.Vehicles[0]
+				if v.InstanceID != before.Vehicles[0].InstanceID || v.Name != "M1126" || len(v.Crew) != 1 || v.Crew[0].ID != before.Vehicles[0].Crew[0].ID {
+					return fmt.Sprintf("expected the instance to become an M1126 with the same driver, got %+v", v)
+				}
+				return ""
+			},
+		},
+		{
+			name: "weapons are resynced",
+			edit: func(g *models.GroupDetails) {
+				g.DirectMembers[0].Weapons = []models.Weapon{pistol}
+				g.Teams[0].Members[0].Weapons = append(g.Teams[0].Members[0].Weapons, pistol)
+				g.Teams[0].Members[1].Weapons = nil
+				g.Vehicles[0].Crew[0].Weapons = []models.Weapon{rifle}
+			},
+			check: func(before, after models.GroupDetails) string {
+				want := map[int]string{
+					before.DirectMembers[0].ID:    "M17",
+					before.Teams[0].Members[0].ID: "M17,M4",
+					before.Teams[0].Members[1].ID: "",
+					before.Vehicles[0].Crew[0].ID: "M4",
+					before.Teams[1].Members[0].ID: "",
+				}
+				for memberID, names := range want {
+					if _, m := place(after, memberID); m.ID != memberID || weaponNames(m) != names {
+						return fmt.Sprintf("expected member %d to carry %q, got %+v", memberID, names, m)
+					}
+				}
+				return ""
+			},
+		},
+		{
+			name: "unknown and repeated member IDs are inserted",
+			edit: func(g *models.GroupDetails) {
+				g.DirectMembers = append(g.DirectMembers,
+					models.Member{ID: 99999, Role: "Interpreter"},
+					models.Member{ID: g.DirectMembers[0].ID, Role: "Leader Copy"})
+			},
+			check: func(before, after models.GroupDetails) string {
+				if len(after.DirectMembers) != 3 || after.DirectMembers[0].ID != before.DirectMembers[0].ID {
+					return fmt.Sprintf("expected the leader and two new members, got %+v", after.DirectMembers)
+				}
+				for _, m := range after.DirectMembers[1:] {
+					if m.ID == 99999 || m.ID == before.DirectMembers[0].ID {
+						return fmt.Sprintf("expected %s to be inserted with a new ID, got %d", m.Role, m.ID)
+					}
+				}
+				return ""
+			},
+		},
+	}
+
+	countRows := func(query string, args ...interface{}) int {
+		var n int
+		if err := app.db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("Failed to count rows: %v", err)
+		}
+		return n
+	}
+
+	for _, tt := range tests {
+		before := newGroup()
+		// Load a second copy to edit so before keeps the stored structure
+		edited, err := app.Groups.GetGroupDetails(before.ID)
+		if err != nil {
+			t.Fatalf("%s: failed to load group: %v", tt.name, err)
+		}
+		tt.edit(&edited)
+
+		if err := app.Groups.UpdateGroup(before.ID, edited, "tester"); err != nil {
+			t.Errorf("%s: failed to update group: %v", tt.name, err)
+			continue
+		}
+		after, err := app.Groups.GetGroupDetails(before.ID)
+		if err != nil {
+			t.Fatalf("%s: failed to reload group: %v", tt.name, err)
+		}
+		if problem := tt.check(before, after); problem != "" {
+			t.Errorf("%s: %s", tt.name, problem)
+		}
+
+		// The stored size counts every member, and members that left the
+		// group are deleted rather than orphaned
+		members := len(after.DirectMembers)
+		for _, team := range after.Teams {
+			members += len(team.Members)
+			if team.Size != len(team.Members) {
+				t.Errorf("%s: expected team %s to have size %d, got %d", tt.name, team.Name, len(team.Members), team.Size)
+			}
+		}
+		for _, v := range after.Vehicles {
+			members += len(v.Crew)
+		}
+		if after.Size != members {
+			t.Errorf("%s: expected group size %d, got %d", tt.name, members, after.Size)
+		}
+		if n := countRows(`SELECT COUNT(*) FROM members m WHERE NOT EXISTS (SELECT 1 FROM group_members gm WHERE gm.member_id = m.member_id)
+			AND NOT EXISTS (SELECT 1 FROM team_members tm WHERE tm.member_id = m.member_id)
+			AND NOT EXISTS (SELECT 1 FROM vehicle_members vm WHERE vm.member_id = m.member_id)`); n != 0 {
+			t.Errorf("%s: expected no orphaned members, got %d", tt.name, n)
+		}
+		if n := countRows("SELECT COUNT(*) FROM teams t WHERE NOT EXISTS (SELECT 1 FROM group_members gm WHERE gm.team_id = t.team_id)"); n != 0 {
+			t.Errorf("%s: expected no orphaned teams, got %d", tt.name, n)
+		}
+		if n := countRows("SELECT COUNT(*) FROM group_vehicles WHERE group_id = ?", before.ID); n != len(after.Vehicles) {
+			t.Errorf("%s: expected %d vehicle instances, got %d", tt.name, len(after.Vehicles), n)
+		}
+	}
+}
+
+func TestGroupHierarchy(t *testing.T) {
+	app := newTestApp(t)
+
+	create := func(name, nationality string, parentID int64) int64 {
+		id, err := app.Groups.CreateGroup(models.GroupDetails{Name: name, Nationality: nationality, ParentID: int(parentID)}, "tester")
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		return id
+	}
+	brigade := create("1st Brigade", "US", 0)
+	battalion := create("2nd Battalion", "US", brigade)
+	company := create("Alpha Company", "US", battalion)
+	attached := create("C Squadron", "GB", brigade)
+	create("Recon Troop", "GB", attached)
+	create("3rd Brigade", "US", 0)
+
+	// A group cannot be placed under itself or any of its subordinates
+	for _, parentID := range []int64{brigade, battalion, company} {
+		group, err := app.Groups.GetGroupDetails(fmt.Sprint(brigade))
+		if err != nil {
+			t.Fatalf("Failed to load group: %v", err)
+		}
+		group.Nationality = "US"
+		group.ParentID = int(parentID)
+		if err := app.Groups.UpdateGroup(fmt.Sprint(brigade), group, "tester"); !errors.Is(err, database.ErrGroupCycle) {
+			t.Errorf("Expected ErrGroupCycle placing the brigade under group %d, got %v", parentID, err)
+		}
+		if rec := doJSON(t, app, "PUT", fmt.Sprintf("/api/v1/groups/%d", brigade), group); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 placing the brigade under group %d, got %d", parentID, rec.Code)
+		}
+	}
+	if ancestors, err := app.Groups.GetGroupAncestors(fmt.Sprint(company)); err != nil || len(ancestors) != 2 || ancestors[0].ID != int(brigade) {
+		t.Errorf("Expected the company to stay under the brigade, got %+v (%v)", ancestors, err)
+	}
+
+	// Moving a group under an unrelated one is allowed
+	group, _ := app.Groups.GetGroupDetails(fmt.Sprint(company))
+	group.Nationality = "US"
+	group.ParentID = int(attached)
+	if err := app.Groups.UpdateGroup(fmt.Sprint(company), group, "tester"); err != nil {
+		t.Fatalf("Failed to move the company: %v", err)
+	}
+
+	// outline writes a forest of groups as names with their subgroups
+	var outline func(nodes []models.GroupNode) string
+	outline = func(nodes []models.GroupNode) string {
+		var parts []string
+		for _, node := range nodes {
+			part := node.Group.Name
+			if len(node.Subgroups) > 0 {
+				part += " (" + outline(node.Subgroups) + ")"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	tests := []struct {
+		country string
+		want    string
+	}{
+		{"United States", "1st Brigade (2nd Battalion, C Squadron (Alpha Company, Recon Troop)), 3rd Brigade, Alpha Company"},
+		{"United Kingdom", "C Squadron (Alpha Company, Recon Troop)"},
+	}
+	for _, tt := range tests {
+		details, err := app.Countries.GetCountryDetails(tt.country)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", tt.country, err)
+		}
+		if got := outline(details.Formations); got != tt.want {
+			t.Errorf("%s: expected formations %q, got %q", tt.country, tt.want, got)
+		}
+	}
+}
+
+func TestExportImportHierarchy(t *testing.T) {
+	app := newTestApp(t)
+
+	create := func(name, nationality string, parentID int64) int64 {
+		id, err := app.Groups.CreateGroup(models.GroupDetails{Name: name, Nationality: nationality, ParentID: int(parentID)}, "tester")
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		return id
+	}
+	brigade := create("1st Brigade", "US", 0)
+	battalion := create("2nd Battalion", "US", brigade)
+	company := create("Alpha Company", "US", battalion)
+	create("C Squadron", "GB", battalion)
+
+	// parents maps the name of each of the groups to the name of its parent,
+	// which must be one of the groups too
+	parents := func(ids []int64) map[string]string {
+		groups := make(map[int]models.GroupDetails)
+		for _, id := range ids {
+			group, err := app.Groups.GetGroupDetails(fmt.Sprint(id))
+			if err != nil {
+				t.Fatalf("Failed to load group %d: %v", id, err)
+			}
+			groups[int(id)] = group
+		}
+		result := make(map[string]string)
+		for _, group := range groups {
+			parent, ok := groups[group.ParentID]
+			if group.ParentID != 0 && !ok {
+				t.Errorf("Expected %s to be under one of the imported groups, got group %d", group.Name, group.ParentID)
+			}
+			result[group.Name] = parent.Name
+		}
+		return result
+	}
+
+	// A country's groups are imported with their parents replaced by the copies
+	rec := do(app, "GET", "/api/v1/export?country=United+States", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"parent_group_id"`) {
+		t.Fatalf("Expected the export to hold the parents, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(app, "POST", "/api/v1/import", "application/json", rec.Body.Bytes())
+	var imported struct {
+		GroupIDs []int64 `json:"group_ids"`
+	}
+	json.NewDecoder(rec.Body).Decode(&imported)
+	if rec.Code != http.StatusCreated || len(imported.GroupIDs) != 3 {
+		t.Fatalf("Expected the three groups to be imported, got %d: %s", rec.Code, rec.Body)
+	}
+	want := map[string]string{"1st Brigade": "", "2nd Battalion": "1st Brigade", "Alpha Company": "2nd Battalion"}
+	if got := parents(imported.GroupIDs); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the hierarchy %v, got %v", want, got)
+	}
+
+	// A group imported without its parent stays under the existing parent
+	rec = do(app, "GET", fmt.Sprintf("/api/v1/export?group=%d&format=text", company), "", nil)
+	form := url.Values{"outline": {rec.Body.String()}}
+	rec = do(app, "POST", "/add_group/import", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected the outline to import, got %d: %s", rec.Code, rec.Body)
+	}
+	copied, _ := app.Groups.GetGroupDetails(strings.TrimPrefix(rec.Header().Get("Location"), "/group/"))
+	if copied.ParentID != int(battalion) {
+		t.Errorf("Expected the copy to be under the battalion %d, got %d", battalion, copied.ParentID)
+	}
+
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"cycle", `[{"group_id": 1, "group_name": "A", "group_nationality": "US", "parent_group_id": 2},
+			{"group_id": 2, "group_name": "B", "group_nationality": "US", "parent_group_id": 1}]`},
+		{"own parent", `{"group_id": 1, "group_name": "A", "group_nationality": "US", "parent_group_id": 1}`},
+		{"unknown parent", `{"group_id": 1, "group_name": "A", "group_nationality": "US", "parent_group_id": 999}`},
+	}
+	for _, tt := range tests {
+		if rec := do(app, "POST", "/api/v1/import", "application/json", []byte(tt.document)); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+}
+func TestDuplicateGroup(t *testing.T) {
+	app := newTestApp(t)
+
+	weaponID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M4A1", Type: "Rifle"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	groupID, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:          "Ranger Rifle Squad",
+		Nationality:   "US",
+		DirectMembers: []models.Member{{Role: "Squad Leader", Rank: "SSG", Weapons: []models.Weapon{{ID: int(weaponID)}}}},
+		Teams:         []models.Team{{Name: "Alpha", Members: []models.Member{{Role: "Rifleman", Rank: "PFC"}}}},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	form := url.Values{"name": {"Para Rifle Section"}, "nationality": {"United Kingdom"}}
+	rec := do(app, "POST", fmt.Sprintf("/group/%d/duplicate", groupID), "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after duplicating, got %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/group/") || !strings.HasSuffix(location, "/edit") {
+		t.Fatalf("Expected the copy to open in the editor, got %s", location)
+	}
+	copyID := strings.TrimSuffix(strings.TrimPrefix(location, "/group/"), "/edit")
+
+	original, _ := app.Groups.GetGroupDetails(fmt.Sprint(groupID))
+	copied, err := app.Groups.GetGroupDetails(copyID)
+	if err != nil {
+		t.Fatalf("Failed to get the copy: %v", err)
+	}
+	if copied.Name != "Para Rifle Section" || copied.Nationality != "United Kingdom" || copied.Size != 2 {
+		t.Errorf("Expected a British copy with 2 members, got %+v", copied)
+	}
+	if len(copied.DirectMembers) != 1 || len(copied.DirectMembers[0].Weapons) != 1 || len(copied.Teams) != 1 {
+		t.Fatalf("Expected the members, weapons and teams to be copied, got %+v", copied)
+	}
+	if copied.DirectMembers[0].ID == original.DirectMembers[0].ID || copied.Teams[0].ID == original.Teams[0].ID {
+		t.Errorf("Expected the copy to have its own members and teams")
+	}
+
+	form = url.Values{"name": {"Copy"}, "nationality": {"Atlantis"}}
+	if rec := do(app, "POST", fmt.Sprintf("/group/%d/duplicate", groupID), "application/x-www-form-urlencoded", []byte(form.Encode())); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown country, got %d", rec.Code)
+	}
+	form = url.Values{"name": {"Copy"}}
+	if rec := do(app, "POST", "/group/99/duplicate", "application/x-www-form-urlencoded", []byte(form.Encode())); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing group, got %d", rec.Code)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	app := newTestApp(t)
+
+	rifleID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M4", Type: "Rifle", Caliber: "5.56mm"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	pistolID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M17", Type: "Pistol", Caliber: "9mm"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	vehicleID, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "M1151", Type: "Utility", Armament: "M2"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	rifle := models.Weapon{ID: int(rifleID)}
+	pistol := models.Weapon{ID: int(pistolID)}
+	groupID, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:        "Ranger Rifle Squad",
+		Nationality: "US",
+		DirectMembers: []models.Member{
+			{Role: "Squad Leader", Rank: "SSG", Weapons: []models.Weapon{rifle, pistol}},
+		},
+		Teams: []models.Team{
+			{Name: "Alpha", Members: []models.Member{
+				{Role: "Rifleman", Rank: "PFC", Weapons: []models.Weapon{rifle}},
+				{Role: "Rifleman", Rank: "PVT", Weapons: []models.Weapon{rifle}},
+			}},
+			{Name: "Bravo", Members: []models.Member{{Role: "Medic", Rank: "SPC"}}},
+		},
+		Vehicles: []models.Vehicle{
+			{ID: fmt.Sprint(vehicleID), Crew: []models.Member{{Role: "Driver", Rank: "PFC"}, {Role: "Gunner", Rank: "SPC", Weapons: []models.Weapon{pistol}}}},
+			{ID: fmt.Sprint(vehicleID)},
+		},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	original, err := app.Groups.GetGroupDetails(fmt.Sprint(groupID))
+	if err != nil {
+		t.Fatalf("Failed to load group: %v", err)
+	}
+
+	// withoutIDs clears the IDs that are new for each copy of the group
+	withoutIDs := func(group models.GroupDetails) models.GroupDetails {
+		clearMembers := func(members []models.Member) []models.Member {
+			cleared := make([]models.Member, len(members))
+			for i, m := range members {
+				m.ID = 0
+				cleared[i] = m
+			}
+			return cleared
+		}
+		group.ID = ""
+		group.DirectMembers = clearMembers(group.DirectMembers)
+		teams := make([]models.Team, len(group.Teams))
+		for i, team := range group.Teams {
+			team.ID = 0
+			team.Members = clearMembers(team.Members)
+			teams[i] = team
+		}
+		group.Teams = teams
+		vehicles := make([]models.Vehicle, len(group.Vehicles))
+		for i, v := range group.Vehicles {
+			v.InstanceID = 0
+			v.Crew = clearMembers(v.Crew)
+			vehicles[i] = v
+		}
+		group.Vehicles = vehicles
+		return group
+	}
+	checkCopy := func(format string, rec *httptest.ResponseRecorder, copyID string) {
+		t.Helper()
+		if copyID == "" {
+			t.Fatalf("%s: expected the exported group to import, got %d: %s", format, rec.Code, rec.Body)
+		}
+		copied, err := app.Groups.GetGroupDetails(copyID)
+		if err != nil {
+			t.Fatalf("%s: failed to load the imported group: %v", format, err)
+		}
+		if copied.ID == original.ID {
+			t.Fatalf("%s: expected a new group", format)
+		}
+		if !reflect.DeepEqual(withoutIDs(copied), withoutIDs(original)) {
+			t.Errorf("%s: the imported group differs from the export:\n got %+v\nwant %+v", format, copied, original)
+		}
+	}
+
+	rec := do(app, "GET", fmt.Sprintf("/api/v1/export?group=%d", groupID), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the JSON export, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(app, "POST", "/api/v1/import", "application/json", rec.Body.Bytes())
+	var imported struct {
+		GroupIDs []int64 `json:"group_ids"`
+	}
+	json.NewDecoder(rec.Body).Decode(&imported)
+	copyID := ""
+	if rec.Code == http.StatusCreated && len(imported.GroupIDs) == 1 {
+		copyID = fmt.Sprint(imported.GroupIDs[0])
+	}
+	checkCopy("json", rec, copyID)
+
+	rec = do(app, "GET", fmt.Sprintf("/api/v1/export?group=%d&format=text", groupID), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the outline export, got %d: %s", rec.Code, rec.Body)
+	}
+	form := url.Values{"outline": {rec.Body.String()}}
+	rec = do(app, "POST", "/add_group/import", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	copyID = ""
+	if rec.Code == http.StatusSeeOther {
+		copyID = strings.TrimPrefix(rec.Header().Get("Location"), "/group/")
+	}
+	checkCopy("text", rec, copyID)
+
+	// Nothing new was added to the catalog
+	weapons, _ := app.Weapons.GetWeapons()
+	vehicles, _ := app.Vehicles.GetVehicles()
+	if len(weapons) != 2 || len(vehicles) != 1 {
+		t.Errorf("Expected the catalog to be reused, got %d weapons and %d vehicles", len(weapons), len(vehicles))
+	}
+
+	// A country's groups are loaded together, and match the groups loaded
+	// one by one
+	otherID, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:          "Rifle Section",
+		Nationality:   "GB",
+		DirectMembers: []models.Member{{Role: "Section Commander", Weapons: []models.Weapon{rifle}}},
+		Vehicles:      []models.Vehicle{{ID: fmt.Sprint(vehicleID), Crew: []models.Member{{Role: "Driver"}}}},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	var want []models.GroupDetails
+	groups, _, _ := app.Groups.ListGroups(models.GroupFilter{}, models.ListOptions{})
+	for _, g := range groups {
+		if g.ID != int(otherID) {
+			group, _ := app.Groups.GetGroupDetails(fmt.Sprint(g.ID))
+			want = append(want, group)
+		}
+	}
+	got, err := app.Countries.GetCountryGroupDetails("United States")
+	if err != nil || len(got) != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the country's groups to match the groups loaded one by one (%v):\n got %+v\nwant %+v", err, got, want)
+	}
+}
+
+func TestCompareGroups(t *testing.T) {
+	app := newTestApp(t)
+
+	var ids []string
+	for _, g := range []models.GroupDetails{
+		{Name: "Rifle Squad", Nationality: "US", DirectMembers: []models.Member{{Role: "Squad Leader"}, {Role: "Rifleman"}}},
+		{Name: "Rifle Section", Nationality: "GB", DirectMembers: []models.Member{{Role: "Section Commander"}, {Role: "Rifleman"}}},
+	} {
+		id, err := app.Groups.CreateGroup(g, "tester")
+		if err != nil {
+			t.Fatalf("Failed to create group: %v", err)
+		}
+		ids = append(ids, fmt.Sprint(id))
+	}
+
+	rec := do(app, "GET", "/api/v1/compare?groups="+strings.Join(ids, ","), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a comparison, got %d: %s", rec.Code, rec.Body)
+	}
+	var comparison models.GroupComparison
+	json.Unmarshal(rec.Body.Bytes(), &comparison)
+	if len(comparison.Groups) != 2 || comparison.Groups[1].Nationality != "United Kingdom" {
+		t.Fatalf("Expected both groups, got %+v", comparison.Groups)
+	}
+	roles := comparison.Sections[1].Rows
+	if len(roles) != 3 || roles[1].Label != "Rifleman" || roles[1].Differs || !roles[0].Differs {
+		t.Errorf("Expected the riflemen to line up, got %+v", roles)
+	}
+
+	rec = do(app, "GET", "/compare?groups="+ids[0]+"&groups="+ids[1], "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Section Commander") {
+		t.Errorf("Expected the comparison page, got %d", rec.Code)
+	}
+
+	for target, code := range map[string]int{
+		"/api/v1/compare?groups=" + ids[0]:         http.StatusBadRequest,
+		"/api/v1/compare?groups=" + ids[0] + ",x":  http.StatusBadRequest,
+		"/api/v1/compare?groups=" + ids[0] + ",99": http.StatusNotFound,
+		"/compare?groups=" + ids[0]:                http.StatusOK,
+	} {
+		if rec := do(app, "GET", target, "", nil); rec.Code != code {
+			t.Errorf("%s: expected %d, got %d", target, code, rec.Code)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApp(t)
+
+	weaponID, err := app.Weapons.CreateWeapon(models.Weapon{Name: "M110", Type: "Marksman Rifle", Caliber: "7.62mm"}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create weapon: %v", err)
+	}
+	if _, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "Stryker", Type: "ICV", Armament: "30mm cannon"}, "tester"); err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	groupID, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:        "Rifle Squad",
+		Nationality: "US",
+		Teams: []models.Team{{Name: "Alpha", Members: []models.Member{
+			{Role: "Designated Marksman", Rank: "SPC"},
+			{Role: "Designated Marksman", Rank: "SPC"},
+		}}},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	search := func(q string) []models.SearchResult {
+		t.Helper()
+		rec := do(app, "GET", "/api/v1/search?q="+url.QueryEscape(q), "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 searching %q, got %d: %s", q, rec.Code, rec.Body)
+		}
+		var results []models.SearchResult
+		json.Unmarshal(rec.Body.Bytes(), &results)
+		return results
+	}
+
+	results := search("designated marks")
+	if len(results) != 1 || results[0].Kind != "member" || results[0].Count != 2 ||
+		results[0].URL != fmt.Sprintf("/group/%d", groupID) {
+		t.Errorf("Expected both marksmen to link to the squad, got %+v", results)
+	}
+	if results := search("30mm"); len(results) != 1 || results[0].Kind != "vehicle" {
+		t.Errorf("Expected the Stryker to match its armament, got %+v", results)
+	}
+	if results := search(`7.62mm "`); len(results) != 1 || results[0].URL != fmt.Sprintf("/weapon/%d", weaponID) {
+		t.Errorf("Expected the M110 to match its caliber, got %+v", results)
+	}
+
+	// The index follows updates and deletes
+	if err := app.Weapons.UpdateWeapon(models.Weapon{ID: int(weaponID), Name: "M110A1", Type: "Sniper Rifle", Caliber: "7.62mm"}, nil, "tester"); err != nil {
+		t.Fatalf("Failed to update weapon: %v", err)
+	}
+	if results := search("marksman"); len(results) != 1 || results[0].Kind != "member" {
+		t.Errorf("Expected the renamed weapon to no longer match, got %+v", results)
+	}
+	if err := app.Groups.DeleteGroup(fmt.Sprint(groupID), "tester"); err != nil {
+		t.Fatalf("Failed to delete group: %v", err)
+	}
+	if results := search("marksman"); len(results) != 0 {
+		t.Errorf("Expected no results after deleting the group, got %+v", results)
+	}
+
+	rec := do(app, "GET", "/search?q=stryker", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Stryker") {
+		t.Errorf("Expected the search page to list the Stryker, got %d", rec.Code)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	app := newTestApp(t)
+
+	// bm25 ranks depend on the statistics of each table: the only vehicle
+	// matches with a rank near zero, while a weapon among several unrelated
+	// ones ranks far lower
+	for _, name := range []string{"Javelin", "Javelin Command Launch Unit Trainer", "M4", "M249", "M240"} {
+		if _, err := app.Weapons.CreateWeapon(models.Weapon{Name: name, Type: "Launcher", Caliber: "127mm"}, "tester"); err != nil {
+			t.Fatalf("Failed to create weapon: %v", err)
+		}
+	}
+	if _, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "Javelin Carrier", Type: "Utility"}, "tester"); err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	if _, err := app.Groups.CreateGroup(models.GroupDetails{Name: "Javelin Section", Nationality: "US"}, "tester"); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	rec := do(app, "GET", "/api/v1/search?q=javelin&limit=3", "", nil)
+	var results []models.SearchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected search results, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// The best match of each kind comes first
+	want := []string{"group Javelin Section", "weapon Javelin", "vehicle Javelin Carrier"}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %v, got %+v", want, results)
+	}
+	for i, r := range results {
+		if got := r.Kind + " " + r.Name; got != want[i] || r.Score != 1 {
+			t.Errorf("Expected %s to score 1 at %d, got %s scoring %v", want[i], i, got, r.Score)
+		}
+	}
+
+	rec = do(app, "GET", "/api/v1/search?q=javelin", "", nil)
+	results = nil
+	json.Unmarshal(rec.Body.Bytes(), &results)
+	if len(results) != 4 || results[3].Name != "Javelin Command Launch Unit Trainer" ||
+		results[3].Score <= 0 || results[3].Score >= 1 {
+		t.Errorf("Expected the weaker weapon match last, scoring between 0 and 1, got %+v", results)
+	}
+}
+
+// BenchmarkAPIGroupDetails reads a company-sized group with 12 teams of 9
+// members and 14 crewed vehicles, every member carrying two weapons
+func BenchmarkAPIGroupDetails(b *testing.B) {
+	app := newTestApp(b)
+
+	var weaponIDs []int
+	for i := 0; i < 6; i++ {
+		id, err := app.Weapons.CreateWeapon(models.Weapon{Name: fmt.Sprintf("Weapon %d", i), Type: "Rifle", Caliber: "5.56mm"}, "tester")
+		if err != nil {
+			b.Fatalf("Failed to create weapon: %v", err)
+		}
+		weaponIDs = append(weaponIDs, int(id))
+	}
+	vehicleID, err := app.Vehicles.CreateVehicle(models.Vehicle{Name: "Bradley", Type: "IFV", Armament: "25mm"}, "tester")
+	if err != nil {
+		b.Fatalf("Failed to create vehicle: %v", err)
+	}
+
+	member := func(i int) models.Member {
+		return models.Member{
+			Role: fmt.Sprintf("Soldier %d", i),
+			Rank: "PFC",
+			Weapons: []models.Weapon{
+				{ID: weaponIDs[i%len(weaponIDs)]},
+				{ID: weaponIDs[(i+1)%len(weaponIDs)]},
+			},
+		}
+	}
+	group := models.GroupDetails{Name: "Rifle Company", Nationality: "US"}
+	for i := 0; i < 6; i++ {
+		group.DirectMembers = append(group.DirectMembers, member(i))
+	}
+	for t := 0; t < 12; t++ {
+		team := models.Team{Name: fmt.Sprintf("Team %d", t)}
+		for i := 0; i < 9; i++ {
+			team.Members = append(team.Members, member(i))
+		}
+		group.Teams = append(group.Teams, team)
+	}
+	for v := 0; v < 14; v++ {
+		vehicle := models.Vehicle{ID: fmt.Sprint(vehicleID)}
+		for i := 0; i < 3; i++ {
+			vehicle.Crew = append(vehicle.Crew, member(i))
+		}
+		group.Vehicles = append(group.Vehicles, vehicle)
+	}
+
+	groupID, err := app.Groups.CreateGroup(group, "tester")
+	if err != nil {
+		b.Fatalf("Failed to create group: %v", err)
+	}
+	target := fmt.Sprintf("/api/v1/groups/%d", groupID)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rec := do(app, "GET", target, "", nil); rec.Code != http.StatusOK {
+			b.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestCalibers(t *testing.T) {
+	app := newTestApp(t)
+	viewer := logIn(t, app.App, "viewer", auth.RoleViewer)
+
+	var rifle, cannon models.Weapon
+	rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M4", Type: "Rifle", Caliber: "5.56mm"})
+	json.NewDecoder(rec.Body).Decode(&rifle)
+	rec = doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "Mk 44", Type: "Cannon", Caliber: "30x173mm"})
+	json.NewDecoder(rec.Body).Decode(&cannon)
+	if rifle.CaliberID == 0 || cannon.CaliberID != 0 {
+		t.Fatalf("Expected only the rifle to be linked to the catalog, got %+v and %+v", rifle, cannon)
+	}
+	rec = doJSON(t, app, "POST", "/api/v1/vehicles", models.Vehicle{Name: "Bradley", Type: "IFV", Armament: "Mk 44, 2x 30mm"})
+	var vehicle models.Vehicle
+	json.NewDecoder(rec.Body).Decode(&vehicle)
+
+	// Adding a caliber links the weapons written with its aliases
+	form := url.Values{"name": {"30x173mm"}, "aliases": {"30mm, 30 x 173"}}
+	rec = do(app, "POST", "/calibers", "application/x-www-form-urlencoded", []byte(form.Encode()))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after adding a caliber, got %d: %s", rec.Code, rec.Body)
+	}
+	caliberURL := rec.Header().Get("Location")
+	if rec := do(app, "GET", caliberURL, "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Mk 44") {
+		t.Errorf("Expected the caliber page to list its weapons, got %d", rec.Code)
+	}
+	form = url.Values{"name": {"30mm Bushmaster"}, "aliases": {"30MM"}}
+	if rec := do(app, "POST", "/calibers", "application/x-www-form-urlencoded", []byte(form.Encode())); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an alias of another caliber, got %d", rec.Code)
+	}
+	if rec := do(viewer, "POST", caliberURL+"/delete", "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer to be refused deleting a caliber, got %d", rec.Code)
+	}
+
+	id, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:          "Mechanized Squad",
+		Nationality:   "US",
+		DirectMembers: []models.Member{{Role: "Rifleman", Weapons: []models.Weapon{rifle}}, {Role: "Rifleman", Weapons: []models.Weapon{rifle}}},
+		Vehicles:      []models.Vehicle{vehicle},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	rec = do(viewer, "GET", fmt.Sprintf("/api/v1/ammunition?group=%d", id), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the ammunition demand, got %d: %s", rec.Code, rec.Body)
+	}
+	var demand models.AmmunitionDemand
+	json.Unmarshal(rec.Body.Bytes(), &demand)
+	if len(demand.Calibers) != 2 || demand.Calibers[0].Caliber != "30x173mm" || demand.Calibers[0].Mounted != 3 {
+		t.Fatalf("Expected three mounted 30mm weapons first, got %+v", demand.Calibers)
+	}
+	if demand.Calibers[1].Carried != 2 || demand.Calibers[1].Substitutes == nil {
+		t.Errorf("Expected two rifles that can also fire .223, got %+v", demand.Calibers[1])
+	}
+
+	if rec := do(viewer, "GET", fmt.Sprintf("/group/%d", id), "", nil); !strings.Contains(rec.Body.String(), caliberURL) {
+		t.Errorf("Expected the group page to link the caliber, got %d", rec.Code)
+	}
+	if rec := do(viewer, "GET", "/api/v1/ammunition", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a group or country, got %d", rec.Code)
+	}
+}
+
+func TestWeaponCaliberLinks(t *testing.T) {
+	app := newTestApp(t)
+
+	// A caliber ID is kept as given, and the alias lookup is only used without one
+	var rifle, marksman, cannon models.Weapon
+	rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M4", Type: "Rifle", Caliber: "5.56mm"})
+	json.NewDecoder(rec.Body).Decode(&rifle)
+	rec = doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M110", Type: "Marksman Rifle", Caliber: "M118LR", CaliberID: 3})
+	json.NewDecoder(rec.Body).Decode(&marksman)
+	rec = doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "Mk 44", Type: "Cannon", Caliber: "30x173mm"})
+	json.NewDecoder(rec.Body).Decode(&cannon)
+	if rifle.CaliberID != 1 || marksman.CaliberID != 3 || cannon.CaliberID != 0 {
+		t.Fatalf("Expected the rifle linked by alias and the marksman rifle by ID, got %+v, %+v and %+v", rifle, marksman, cannon)
+	}
+	if rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M14", Caliber: "7.62mm", CaliberID: 999}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a caliber that does not exist, got %d: %s", rec.Code, rec.Body)
+	}
+	marksman.CaliberID = 999
+	if rec := doJSON(t, app, "PUT", fmt.Sprintf("/api/v1/weapons/%d", marksman.ID), marksman); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when updating to a caliber that does not exist, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Saving a caliber only changes the weapons written with its old or new
+	// aliases, and records each one it changes
+	caliber, err := app.Calibers.GetCaliber("1")
+	if err != nil {
+		t.Fatalf("Failed to get caliber: %v", err)
+	}
+	caliber.Aliases = []string{"5.56x45mm"}
+	if err := app.Calibers.UpdateCaliber(caliber, "armourer"); err != nil {
+		t.Fatalf("Failed to update caliber: %v", err)
+	}
+	cannonCaliber, err := app.Calibers.CreateCaliber(models.Caliber{Name: "30x173mm"}, "armourer")
+	if err != nil {
+		t.Fatalf("Failed to create caliber: %v", err)
+	}
+	if err := app.Calibers.UpdateCaliber(models.Caliber{ID: 3, Name: "7.62x51mm"}, "armourer"); err != nil {
+		t.Fatalf("Failed to update caliber: %v", err)
+	}
+
+	tests := []struct {
+		weapon    models.Weapon
+		caliberID int
+	}{
+		{rifle, 0},
+		{marksman, 3},
+		{cannon, int(cannonCaliber)},
+	}
+	for _, tt := range tests {
+		got, err := app.Weapons.GetWeapon(fmt.Sprint(tt.weapon.ID))
+		if err != nil || got.CaliberID != tt.caliberID {
+			t.Errorf("%s: expected caliber %d, got %d (%v)", tt.weapon.Name, tt.caliberID, got.CaliberID, err)
+		}
+	}
+	entries, _, err := app.Audit.ListAuditEntries(models.AuditFilter{EntityType: "weapon", Username: "armourer"}, models.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list audit entries: %v", err)
+	}
+	var changed []string
+	for _, e := range entries {
+		changed = append(changed, e.EntityID)
+	}
+	if want := []string{fmt.Sprint(cannon.ID), fmt.Sprint(rifle.ID)}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Expected entries for the cannon and the rifle, got %v", changed)
+	}
+
+	// Deleting a caliber unlinks its weapons, including those linked by ID
+	if err := app.Calibers.DeleteCaliber("3", "armourer"); err != nil {
+		t.Fatalf("Failed to delete caliber: %v", err)
+	}
+	if got, _ := app.Weapons.GetWeapon(fmt.Sprint(marksman.ID)); got.CaliberID != 0 {
+		t.Errorf("Expected the marksman rifle to be unlinked, got caliber %d", got.CaliberID)
+	}
+	entries, _, _ = app.Audit.ListAuditEntries(models.AuditFilter{EntityType: "weapon", EntityID: fmt.Sprint(marksman.ID)}, models.ListOptions{})
+	if len(entries) == 0 || entries[0].Username != "armourer" || !strings.Contains(entries[0].Before, `"CaliberID":3`) {
+		t.Errorf("Expected the unlinking to be recorded, got %+v", entries)
+	}
+}
+
+func TestWeaponLoad(t *testing.T) {
+	app := newTestApp(t)
+
+	if rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M4A1", Specs: models.WeaponSpecs{WeightEmpty: 3, WeightLoaded: 2}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a weapon lighter loaded than empty, got %d", rec.Code)
+	}
+	var rifle, saw models.Weapon
+	rec := doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M4A1", Type: "Rifle", Specs: models.WeaponSpecs{WeightEmpty: 2.9, WeightLoaded: 3.5, EffectiveRange: 500}})
+	json.NewDecoder(rec.Body).Decode(&rifle)
+	if rifle.Specs.EffectiveRange != 500 {
+		t.Fatalf("Expected the specs to be saved, got %+v", rifle)
+	}
+	rec = doJSON(t, app, "POST", "/api/v1/weapons", models.Weapon{Name: "M249", Type: "LMG"})
+	json.NewDecoder(rec.Body).Decode(&saw)
+
+	// Specs are edited on the weapon's edit page; blank fields are unknown
+	edit := func(fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		mw.Close()
+		return do(app, "POST", fmt.Sprintf("/weapon/%d/edit", saw.ID), mw.FormDataContentType(), body.Bytes())
+	}
+	fields := map[string]string{"name": "M249", "type": "LMG", "caliber": "5.56mm", "weight_empty": "7.5", "weight_loaded": "10", "length": ""}
+	if rec := edit(fields); rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect after editing specs, got %d: %s", rec.Code, rec.Body)
+	}
+	fields["rate_of_fire"] = "fast"
+	if rec := edit(fields); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a rate of fire that isn't a number, got %d", rec.Code)
+	}
+	delete(fields, "rate_of_fire")
+	for _, weight := range []string{"NaN", "Inf", "-Inf", "1e400"} {
+		fields["weight_loaded"] = weight
+		if rec := edit(fields); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a loaded weight of %s, got %d", weight, rec.Code)
+		}
+	}
+	fields["weight_loaded"] = "10"
+	if rec := do(app, "GET", fmt.Sprintf("/weapon/%d", saw.ID), "", nil); !strings.Contains(rec.Body.String(), "10.00 kg") {
+		t.Errorf("Expected the weapon page to show the loaded weight, got %d", rec.Code)
+	}
+
+	id, err := app.Groups.CreateGroup(models.GroupDetails{
+		Name:        "Fire Team",
+		Nationality: "US",
+		DirectMembers: []models.Member{
+			{Role: "Team Leader", Weapons: []models.Weapon{rifle}},
+			{Role: "Automatic Rifleman", Weapons: []models.Weapon{saw}},
+			{Role: "Rifleman", Weapons: []models.Weapon{rifle}},
+			{Role: "Rifleman", Weapons: []models.Weapon{rifle}},
+		},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	body := do(app, "GET", fmt.Sprintf("/group/%d", id), "", nil).Body.String()
+	if !strings.Contains(body, "20.5 kg in all") {
+		t.Errorf("Expected the group's total weapon load on its page")
+	}
+	if !strings.Contains(body, `<td>Automatic Rifleman</td>`) {
+		t.Errorf("Expected the automatic rifleman to be listed as overloaded")
+	}
+
+	// The group payload carries each weapon's full specs
+	var group models.GroupDetails
+	json.NewDecoder(do(app, "GET", fmt.Sprintf("/api/v1/groups/%d", id), "", nil).Body).Decode(&group)
+	if specs := group.DirectMembers[0].Weapons[0].Specs; specs != rifle.Specs {
+		t.Errorf("Expected the rifle's specs %+v in the group payload, got %+v", rifle.Specs, specs)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"orbat/internal/imaging"
+	"orbat/internal/storage"
+)
+
+// parseImageForm parses a multipart form that may carry an image, refusing
+// bodies too large to hold an acceptable one
+func parseImageForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, imaging.MaxSize+1<<20)
+	return r.ParseMultipartForm(10 << 20)
+}
+
+// uploadFormImage stores the image posted in the image field, if any, for
+// the weapon or vehicle called name. folder is "weapons" or "vehicles". It
+// returns nil when no image was posted.
+func uploadFormImage(r *http.Request, folder, name string) (*storage.Image, error) {
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	// The random suffix gives every upload its own key, so an image is never
+	// overwritten by the one replacing it
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	// The key ends up in public image URLs, so the name is reduced to
+	// characters that need no escaping
+	key := fmt.Sprintf("%s/%s-%d-%s", folder,
+		slugify(name, strings.TrimSuffix(folder, "s")),
+		time.Now().Unix(), hex.EncodeToString(suffix))
+	image, err := storage.UploadImage(file, key)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// imageErrorStatus returns the status for an error from parseImageForm or
+// uploadFormImage
+func imageErrorStatus(err error) int {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge), errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, imaging.ErrInvalidImage):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// discardImage deletes an uploaded image, if any, that could not be recorded
+// against its weapon or vehicle
+func discardImage(image *storage.Image) {
+	if image == nil {
+		return
+	}
+	if err := storage.DeleteImage(image.Key); err != nil {
+		log.Printf("Warning: Failed to delete unused image %s: %v", image.Key, err)
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/biter777/countries"
+	"orbat/internal/database"
+	"orbat/internal/models"
+)
+
+const (
+	// defaultPageSize is the number of rows on a list page without ?limit=
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parseListOptions reads ?sort=, ?order=asc|desc, ?limit= and ?offset= from
+// the request. Without ?limit= the list holds defaultLimit rows, or every row
+// when defaultLimit is 0.
+func parseListOptions(r *http.Request, defaultLimit int) (models.ListOptions, error) {
+	query := r.URL.Query()
+	opts := models.ListOptions{Sort: query.Get("sort"), Limit: defaultLimit}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	if opts.Limit, err = intParam(query, "limit", defaultLimit); err != nil {
+		return opts, err
+	}
+	if opts.Limit < 1 && query.Get("limit") != "" || opts.Limit > maxPageSize {
+		return opts, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	if opts.Offset, err = intParam(query, "offset", 0); err != nil {
+		return opts, err
+	}
+	if opts.Offset < 0 {
+		return opts, fmt.Errorf("offset cannot be negative")
+	}
+	return opts, nil
+}
+
+// parseGroupFilter reads ?nationality=, ?min_size= and ?max_size= from the
+// request. The nationality may be a country name or code.
+func parseGroupFilter(r *http.Request) (models.GroupFilter, error) {
+	query := r.URL.Query()
+	var filter models.GroupFilter
+
+	if name := query.Get("nationality"); name != "" {
+		country := countries.ByName(name)
+		if country == countries.Unknown {
+			return filter, fmt.Errorf("unknown nationality %q", name)
+		}
+		filter.Nationality = country.Alpha2()
+	}
+
+	var err error
+	if filter.MinSize, err = intParam(query, "min_size", 0); err != nil {
+		return filter, err
+	}
+	if filter.MaxSize, err = intParam(query, "max_size", 0); err != nil {
+		return filter, err
+	}
+	if filter.MinSize < 0 || filter.MaxSize < 0 {
+		return filter, fmt.Errorf("sizes cannot be negative")
+	}
+	return filter, nil
+}
+
+// parseWeaponFilter reads ?type=, ?caliber= and ?caliber_id= from the request
+func parseWeaponFilter(r *http.Request) (models.WeaponFilter, error) {
+	query := r.URL.Query()
+	filter := models.WeaponFilter{
+		Type:    strings.TrimSpace(query.Get("type")),
+		Caliber: strings.TrimSpace(query.Get("caliber")),
+	}
+	var err error
+	filter.CaliberID, err = intParam(query, "caliber_id", 0)
+	return filter, err
+}
+
+// parseVehicleFilter reads ?type= from the request
+func parseVehicleFilter(r *http.Request) models.VehicleFilter {
+	return models.VehicleFilter{Type: strings.TrimSpace(r.URL.Query().Get("type"))}
+}
+
+// intParam returns the integer query parameter name, or def when it is absent
+func intParam(query url.Values, name string, def int) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	return n, nil
+}
+
+// isSortError reports whether a list failed because of an unsupported sort field
+func isSortError(err error) bool {
+	var sortErr *database.SortError
+	return errors.As(err, &sortErr)
+}
+
+// pager describes the page of a list being shown, and builds the links to
+// other pages and sort orders with the same filters. SortFields are the
+// fields offered for sorting on list pages.
+type pager struct {
+	path       string
+	query      url.Values
+	opts       models.ListOptions
+	Count      int
+	Total      int
+	SortFields []string
+}
+
+func newPager(r *http.Request, opts models.ListOptions, count, total int, sortFields ...string) pager {
+	return pager{path: r.URL.Path, query: r.URL.Query(), opts: opts, Count: count, Total: total, SortFields: sortFields}
+}
+
+// Param returns a query parameter of the current request, for filter forms
+func (p pager) Param(name string) string {
+	return p.query.Get(name)
+}
+
+// First and Last are the 1-based positions of the rows on the page
+func (p pager) First() int {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.opts.Offset + 1
+}
+
+func (p pager) Last() int {
+	return p.opts.Offset + p.Count
+}
+
+// PrevURL links to the previous page, or is empty on the first page
+func (p pager) PrevURL() string {
+	if p.opts.Offset == 0 || p.opts.Limit <= 0 {
+		return ""
+	}
+	offset := p.opts.Offset - p.opts.Limit
+	if offset < 0 {
+		offset = 0
+	}
+	return p.url(map[string]string{"offset": strconv.Itoa(offset)})
+}
+
+// NextURL links to the next page, or is empty on the last page
+func (p pager) NextURL() string {
+	if p.opts.Limit <= 0 || p.opts.Offset+p.Count >= p.Total {
+		return ""
+	}
+	return p.url(map[string]string{"offset": strconv.Itoa(p.opts.Offset + p.opts.Limit)})
+}
+
+// SortURL links to the first page sorted by field, reversing the order when
+// the list is already sorted by it
+func (p pager) SortURL(field string) string {
+	order := "asc"
+	if p.SortedBy(field) && !p.opts.Desc {
+		order = "desc"
+	}
+	return p.url(map[string]string{"sort": field, "order": order, "offset": ""})
+}
+
+// SortedBy reports whether the list is sorted by field, which is "name" by
+// default
+func (p pager) SortedBy(field string) bool {
+	return p.opts.Sort == field || p.opts.Sort == "" && field == "name"
+}
+
+// Desc reports whether the list is in descending order
+func (p pager) Desc() bool {
+	return p.opts.Desc
+}
+
+func (p pager) url(params map[string]string) string {
+	query := url.Values{}
+	for k, v := range p.query {
+		query[k] = v
+	}
+	for k, v := range params {
+		if v == "" {
+			query.Del(k)
+		} else {
+			query.Set(k, v)
+		}
+	}
+	if len(query) == 0 {
+		return p.path
+	}
+	return p.path + "?" + query.Encode()
+}
+
+// writeListHeaders reports the total number of rows and links to the
+// neighbouring pages of an API list
+func writeListHeaders(w http.ResponseWriter, p pager) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Total))
+	var links []string
+	if next := p.NextURL(); next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	if prev := p.PrevURL(); prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, prev))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"orbat/internal/auth"
+)
+
+// requiredPermission returns the permission a request needs, or false for
+// the pages anyone may use. This is the one place deciding who may do what;
+// templates ask the same question through the can function to hide the
+// actions a user cannot perform.
+func requiredPermission(r *http.Request) (auth.Permission, bool) {
+	switch r.URL.Path {
+	case "/login", "/logout", "/health":
+		return "", false
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	read := r.Method == "GET" || r.Method == "HEAD"
+
+	switch {
+	// The forms for adding and editing groups and the catalog are only useful
+	// to editors
+	case parts[0] == "add_group",
+		parts[0] == "group" && len(parts) == 3 && parts[2] == "edit":
+		return auth.EditGroups, true
+	case (parts[0] == "weapon" || parts[0] == "vehicle") && len(parts) == 3 && parts[2] == "edit":
+		return auth.EditCatalog, true
+	case parts[0] == "audit",
+		parts[0] == "group" && len(parts) >= 3 && parts[2] == "revisions" && read:
+		return auth.ViewAudit, true
+	case read:
+		return auth.View, true
+	case parts[0] == "group", parts[0] == "member":
+		return auth.EditGroups, true
+	case parts[0] == "caliber" && len(parts) == 3 && parts[2] == "delete":
+		return auth.DeleteCatalog, true
+	case parts[0] == "weapons", parts[0] == "vehicles",
+		parts[0] == "calibers", parts[0] == "caliber":
+		return auth.EditCatalog, true
+	case parts[0] == "weapon", parts[0] == "vehicle":
+		return auth.DeleteCatalog, true
+	case parts[0] == "country":
+		return auth.ManageCountries, true
+	case parts[0] == "api" && len(parts) >= 3 && parts[1] == "v1":
+		switch parts[2] {
+		case "groups", "import":
+			return auth.EditGroups, true
+		case "weapons", "vehicles", "calibers":
+			if r.Method == "DELETE" {
+				return auth.DeleteCatalog, true
+			}
+			return auth.EditCatalog, true
+		}
+	}
+	return auth.Administer, true
+}
+
+// can reports whether the user of a request has permission. Visitors who
+// are not logged in may only view, and only when AnonymousRead is set.
+func (a *App) can(r *http.Request, permission auth.Permission) bool {
+	user, ok := currentUser(r)
+	if !ok {
+		return a.AnonymousRead && permission == auth.View
+	}
+	return auth.Can(user.Role, permission)
+}
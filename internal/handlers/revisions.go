@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"orbat/internal/diff"
+	"orbat/internal/models"
+)
+
+// GroupRevisionsHandler lists the revisions of a group and compares two of
+// them, given by ?from= and ?to= as revision numbers or "current". POST to
+// /group/{id}/revisions/{n}/restore restores revision n as a new change.
+func (a *App) GroupRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+
+	groupID := pathParts[2]
+	revisions, err := a.Groups.GetGroupRevisions(groupID)
+	if err != nil {
+		log.Printf("Revisions error: %v", err)
+		http.Error(w, "Failed to get revisions", http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(pathParts) == 6 && pathParts[5] == "restore" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		number, err := strconv.Atoi(pathParts[4])
+		if err != nil || number < 1 || number > len(revisions) {
+			http.NotFound(w, r)
+			return
+		}
+		a.restoreRevision(w, r, groupID, revisions[number-1])
+		return
+	}
+	if len(pathParts) != 4 {
+		http.NotFound(w, r)
+		return
+	}
+
+	exists, err := a.Groups.GroupExists(groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var current models.GroupDetails
+	if exists {
+		if current, err = a.Groups.GetGroupDetails(groupID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	from, to := query.Get("from"), query.Get("to")
+	var changes []diff.Change
+	if from != "" && to != "" {
+		fromGroup, err := pickRevision(revisions, from, current, exists)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		toGroup, err := pickRevision(revisions, to, current, exists)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		changes = diff.Groups(fromGroup, toGroup)
+	}
+
+	// Newest first, with the number of the revision each one changed
+	type listedRevision struct {
+		models.GroupRevision
+		Previous int
+	}
+	listed := make([]listedRevision, len(revisions))
+	for i, rev := range revisions {
+		listed[len(revisions)-1-i] = listedRevision{rev, rev.Number - 1}
+	}
+	name := revisions[len(revisions)-1].Group.Name
+	if exists {
+		name = current.Name
+	}
+
+	data := struct {
+		GroupID   string
+		Name      string
+		Exists    bool
+		Revisions []listedRevision
+		From      string
+		To        string
+		Compared  bool
+		Changes   []diff.Change
+	}{groupID, name, exists, listed, from, to, from != "" && to != "", changes}
+	if err := a.render(w, r, "group_revisions.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// pickRevision returns the group as saved by the revision numbered s, or as
+// it is now when s is "current"
+func pickRevision(revisions []models.GroupRevision, s string, current models.GroupDetails, exists bool) (models.GroupDetails, error) {
+	if s == "current" {
+		if !exists {
+			return models.GroupDetails{}, fmt.Errorf("the group has been deleted")
+		}
+		return current, nil
+	}
+	number, err := strconv.Atoi(s)
+	if err != nil || number < 1 || number > len(revisions) {
+		return models.GroupDetails{}, fmt.Errorf("no revision %s", s)
+	}
+	return revisions[number-1].Group, nil
+}
+
+// restoreRevision makes a group match one of its revisions, re-creating it
+// if it was deleted, and records that as a new change
+func (a *App) restoreRevision(w http.ResponseWriter, r *http.Request, groupID string, rev models.GroupRevision) {
+	if err := a.Groups.RestoreGroup(groupID, rev.Group, changedBy(r)); err != nil {
+		if isGroupInputError(err) {
+			http.Error(w, fmt.Sprintf("Cannot restore revision %d: %v", rev.Number, err), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/group/"+groupID, http.StatusSeeOther)
+}
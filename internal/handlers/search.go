@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// SearchHandler shows the groups, member roles, weapons and vehicles matching ?q=
+func (a *App) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var results []models.SearchResult
+	if query != "" {
+		var err error
+		results, err = a.Search.Search(query, defaultSearchLimit)
+		if err != nil {
+			log.Printf("Search error: %v", err)
+			http.Error(w, "Failed to search", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Query   string
+		Results []models.SearchResult
+	}{query, results}
+	if err := a.render(w, r, "search.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
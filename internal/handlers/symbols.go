@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/biter777/countries"
+	"orbat/internal/models"
+	"orbat/internal/symbol"
+)
+
+// GroupSymbolHandler serves the APP-6 unit symbol of a group as SVG. The
+// affiliation comes from the configuration for the group's country unless
+// ?affiliation= overrides it.
+func (a *App) GroupSymbolHandler(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) != 4 || pathParts[3] != "symbol.svg" {
+		http.NotFound(w, r)
+		return
+	}
+
+	group, err := a.Groups.GetGroup(pathParts[2])
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s := groupSymbol(group)
+	if value := r.URL.Query().Get("affiliation"); value != "" {
+		if s.Affiliation, err = symbol.ParseAffiliation(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The symbol changes when the group is renamed or resized, so it is cached
+	// briefly and revalidated by its content
+	svg := s.SVG()
+	sum := sha256.Sum256(svg)
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(svg))
+}
+
+// groupSymbol returns the symbol of a group, with the affiliation configured
+// for its country
+func groupSymbol(group models.Group) symbol.Symbol {
+	countryCode := ""
+	if country := countries.ByName(group.Nationality); country != countries.Unknown {
+		countryCode = country.Info().Alpha2
+	}
+	s := symbol.ForGroup(group, countryAffiliation(countryCode))
+	s.Country = countryCode
+	return s
+}
+
+// countryAffiliation returns the affiliation configured for a country.
+// SYMBOL_FRIENDLY_COUNTRIES and SYMBOL_NEUTRAL_COUNTRIES list country names or
+// codes separated by commas; other countries use SYMBOL_AFFILIATION, which
+// defaults to friend.
+func countryAffiliation(countryCode string) symbol.Affiliation {
+	if countryCode != "" {
+		if countryListed(os.Getenv("SYMBOL_FRIENDLY_COUNTRIES"), countryCode) {
+			return symbol.Friend
+		}
+		if countryListed(os.Getenv("SYMBOL_NEUTRAL_COUNTRIES"), countryCode) {
+			return symbol.Neutral
+		}
+	}
+	if affiliation, err := symbol.ParseAffiliation(os.Getenv("SYMBOL_AFFILIATION")); err == nil {
+		return affiliation
+	}
+	return symbol.Friend
+}
+
+// countryListed reports whether a comma separated list of countries contains
+// the country with the given code
+func countryListed(list, countryCode string) bool {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if countries.ByName(name).Info().Alpha2 == countryCode {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,20 @@
 package handlers
 
 import (
-	"fmt"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
-	"orbat/internal/database"
-	"orbat/internal/storage"
+	"orbat/internal/models"
 )
 
 // VehiclesHandler handles vehicles list and vehicle addition
-func VehiclesHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) VehiclesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := parseImageForm(w, r); err != nil {
+			http.Error(w, err.Error(), imageErrorStatus(err))
 			return
 		}
 
@@ -25,8 +26,7 @@ func VehiclesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Check for duplicate names
-		var exists bool
-		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE vehicle_name = ?)", name).Scan(&exists)
+		exists, _, err := a.Vehicles.VehicleExists(name)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -37,71 +37,16 @@ func VehiclesHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		tx, err := database.DB.Begin()
+		// Handle image upload
+		image, err := uploadFormImage(r, "vehicles", name)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), imageErrorStatus(err))
 			return
 		}
-		defer tx.Rollback()
-
-		var vehicleID int64
-		if exists {
-			// Update existing vehicle
-			_, err = tx.Exec(`
-				UPDATE vehicles 
-				SET vehicle_type = ?, vehicle_armament = ?
-				WHERE vehicle_name = ?`,
-				vehicleType, armament, name)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			err = tx.QueryRow("SELECT vehicle_id FROM vehicles WHERE vehicle_name = ?", name).Scan(&vehicleID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			// Insert new vehicle
-			result, err := tx.Exec(`
-				INSERT INTO vehicles (vehicle_name, vehicle_type, vehicle_armament)
-				VALUES (?, ?, ?)`,
-				name, vehicleType, armament)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			vehicleID, err = result.LastInsertId()
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		// Handle image upload
-		file, header, err := r.FormFile("image")
-		if err == nil {
-			defer file.Close()
-
-			// Upload image to GCS
-			filename := fmt.Sprintf("vehicles/%d_%s", vehicleID, header.Filename)
-			imageURL, err := storage.UploadImage(file, filename)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			// Update vehicle with image URL
-			_, err = tx.Exec("UPDATE vehicles SET image_url = ? WHERE vehicle_id = ?", imageURL, vehicleID)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
 
-		if err := tx.Commit(); err != nil {
+		_, err = a.Vehicles.SaveVehicle(models.Vehicle{Name: name, Type: vehicleType, Armament: armament}, image, changedBy(r))
+		if err != nil {
+			discardImage(image)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -110,19 +55,33 @@ func VehiclesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	vehicles, err := database.GetVehicles()
+	opts, err := parseListOptions(r, defaultPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vehicles, total, err := a.Vehicles.ListVehicles(parseVehicleFilter(r), opts)
+	if isSortError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "vehicles.html", vehicles); err != nil {
+	data := struct {
+		Vehicles []models.Vehicle
+		Pager    pager
+	}{vehicles, newPager(r, opts, len(vehicles), total, "name", "type", "armament")}
+
+	if err := a.render(w, r, "vehicles.html", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 // VehicleDetailsHandler handles vehicle details and deletion
-func VehicleDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) VehicleDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
 		http.NotFound(w, r)
@@ -130,13 +89,22 @@ func VehicleDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := pathParts[2]
+	if len(pathParts) == 4 && pathParts[3] == "edit" {
+		a.editVehicle(w, r, id)
+		return
+	}
 	if len(pathParts) == 4 && pathParts[3] == "delete" {
 		if r.Method != "POST" {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		if err := database.DeleteVehicle(id); err != nil {
+		err := a.Vehicles.DeleteVehicle(id, changedBy(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -145,13 +113,104 @@ func VehicleDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	details, err := database.GetVehicleDetails(id)
+	details, err := a.Vehicles.GetVehicleDetails(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "vehicle_details.html", details); err != nil {
+	if err := a.render(w, r, "vehicle_details.html", details); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// editVehicle shows the form for editing a vehicle and saves the posted name,
+// type, armament and image. A new image replaces the old one, which is deleted
+// from storage.
+func (a *App) editVehicle(w http.ResponseWriter, r *http.Request, id string) {
+	current, err := a.Vehicles.GetVehicle(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-} 
\ No newline at end of file
+
+	switch r.Method {
+	case "GET":
+		a.renderEditVehicle(w, r, http.StatusOK, current, "")
+		return
+	case "POST":
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := parseImageForm(w, r); err != nil {
+		http.Error(w, err.Error(), imageErrorStatus(err))
+		return
+	}
+	vehicle := models.Vehicle{
+		ID:           current.ID,
+		Name:         strings.TrimSpace(r.FormValue("name")),
+		Type:         strings.TrimSpace(r.FormValue("type")),
+		Armament:     strings.TrimSpace(r.FormValue("armament")),
+		ImageURL:     current.ImageURL,
+		MediumURL:    current.MediumURL,
+		ThumbnailURL: current.ThumbnailURL,
+	}
+	if vehicle.Armament == "" {
+		vehicle.Armament = "None"
+	}
+	if vehicle.Name == "" {
+		a.renderEditVehicle(w, r, http.StatusBadRequest, vehicle, "Vehicle name is required")
+		return
+	}
+	exists, existingID, err := a.Vehicles.VehicleExists(vehicle.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists && existingID != current.ID {
+		a.renderEditVehicle(w, r, http.StatusConflict, vehicle, "Vehicle with this name already exists")
+		return
+	}
+
+	image, err := uploadFormImage(r, "vehicles", vehicle.Name)
+	if err != nil {
+		if status := imageErrorStatus(err); status != http.StatusInternalServerError {
+			a.renderEditVehicle(w, r, status, vehicle, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.Vehicles.UpdateVehicle(vehicle, image, changedBy(r)); err != nil {
+		discardImage(image)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/vehicle/"+id, http.StatusSeeOther)
+}
+
+// renderEditVehicle shows the edit vehicle page with the vehicle as entered
+// and the error that stopped it from being saved, if any
+func (a *App) renderEditVehicle(w http.ResponseWriter, r *http.Request, status int, vehicle models.Vehicle, formError string) {
+	data := struct {
+		Vehicle models.Vehicle
+		Error   string
+	}{vehicle, formError}
+
+	w.WriteHeader(status)
+	if err := a.render(w, r, "edit_vehicle.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
@@ -1,23 +1,24 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
 
-	"orbat/internal/database"
-	"orbat/internal/storage"
+	"orbat/internal/models"
 )
 
 // WeaponsHandler handles weapons list and weapon addition
-func WeaponsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) WeaponsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "POST" {
-		// Parse multipart form with 10MB max memory
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := parseImageForm(w, r); err != nil {
+			http.Error(w, err.Error(), imageErrorStatus(err))
 			return
 		}
 
@@ -25,9 +26,14 @@ func WeaponsHandler(w http.ResponseWriter, r *http.Request) {
 		weaponType := r.FormValue("type")
 		caliber := r.FormValue("caliber")
 		replace := r.FormValue("replace") == "true"
-		
+		specs, err := parseWeaponSpecs(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Check if weapon with this name exists
-		exists, existingID, err := database.WeaponExists(name)
+		exists, _, err := a.Weapons.WeaponExists(name)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -39,86 +45,60 @@ func WeaponsHandler(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte("Weapon with this name already exists"))
 			return
 		}
-		
-		var imageURL string
-		// Handle image upload if present
-		file, header, err := r.FormFile("image")
-		if err == nil {
-			defer file.Close()
-			
-			filename := fmt.Sprintf("weapons/%s-%d%s", 
-				strings.ToLower(strings.ReplaceAll(name, " ", "-")),
-				time.Now().Unix(),
-				filepath.Ext(header.Filename))
-			
-			uploadedURL, err := storage.UploadImage(file, filename)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			imageURL = uploadedURL
-		}
 
-		tx, err := database.DB.Begin()
+		// Handle image upload if present
+		image, err := uploadFormImage(r, "weapons", name)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), imageErrorStatus(err))
 			return
 		}
-		defer tx.Rollback()
-
-		if exists && replace {
-			if imageURL != "" {
-				_, err = tx.Exec(`
-					UPDATE weapons 
-					SET weapon_type = ?,
-						weapon_caliber = ?,
-						image_url = ?
-					WHERE weapon_id = ?`, 
-					weaponType, caliber, imageURL, existingID)
-			} else {
-				_, err = tx.Exec(`
-					UPDATE weapons 
-					SET weapon_type = ?,
-						weapon_caliber = ?
-					WHERE weapon_id = ?`, 
-					weaponType, caliber, existingID)
-			}
-		} else {
-			_, err = tx.Exec(`
-				INSERT INTO weapons (weapon_name, weapon_type, weapon_caliber, image_url)
-				VALUES (?, ?, ?, ?)`, 
-				name, weaponType, caliber, imageURL)
-		}
 
+		_, err = a.Weapons.SaveWeapon(models.Weapon{Name: name, Type: weaponType, Caliber: caliber, Specs: specs}, image, changedBy(r))
 		if err != nil {
+			discardImage(image)
 			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		if err := tx.Commit(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
-			return
-		}
-
 		http.Redirect(w, r, "/weapons", http.StatusSeeOther)
 		return
 	}
 
 	// GET request handling
-	weapons, err := database.GetWeapons()
+	filter, err := parseWeaponFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(r, defaultPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weapons, total, err := a.Weapons.ListWeapons(filter, opts)
+	if isSortError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to fetch weapons: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "weapons.html", weapons); err != nil {
+	data := struct {
+		Weapons []models.Weapon
+		Form    models.Weapon
+		Pager   pager
+	}{weapons, models.Weapon{}, newPager(r, opts, len(weapons), total, "name", "type", "caliber")}
+
+	if err := a.render(w, r, "weapons.html", data); err != nil {
 		http.Error(w, fmt.Sprintf("Template error: %v", err), http.StatusInternalServerError)
 		return
 	}
 }
 
 // WeaponDetailsHandler handles weapon details and deletion
-func WeaponDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) WeaponDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
 		http.NotFound(w, r)
@@ -126,13 +106,22 @@ func WeaponDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := pathParts[2]
+	if len(pathParts) == 4 && pathParts[3] == "edit" {
+		a.editWeapon(w, r, id)
+		return
+	}
 	if len(pathParts) == 4 && pathParts[3] == "delete" {
 		if r.Method != "POST" {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		if err := database.DeleteWeapon(id); err != nil {
+		err := a.Weapons.DeleteWeapon(id, changedBy(r))
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -141,19 +130,163 @@ func WeaponDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	details, err := database.GetWeaponDetails(id)
+	details, err := a.Weapons.GetWeaponDetails(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := templates.ExecuteTemplate(w, "weapon_details.html", details); err != nil {
+	if err := a.render(w, r, "weapon_details.html", details); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// editWeapon shows the form for editing a weapon and saves the posted name,
+// type, caliber, specs and image. A new image replaces the old one, which is deleted
+// from storage.
+func (a *App) editWeapon(w http.ResponseWriter, r *http.Request, id string) {
+	current, err := a.Weapons.GetWeapon(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		a.renderEditWeapon(w, r, http.StatusOK, current, "")
+		return
+	case "POST":
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := parseImageForm(w, r); err != nil {
+		http.Error(w, err.Error(), imageErrorStatus(err))
+		return
+	}
+	weapon := models.Weapon{
+		ID:           current.ID,
+		Name:         strings.TrimSpace(r.FormValue("name")),
+		Type:         strings.TrimSpace(r.FormValue("type")),
+		Caliber:      strings.TrimSpace(r.FormValue("caliber")),
+		ImageURL:     current.ImageURL,
+		MediumURL:    current.MediumURL,
+		ThumbnailURL: current.ThumbnailURL,
+	}
+	specs, specsErr := parseWeaponSpecs(r)
+	weapon.Specs = specs
+	if weapon.Name == "" {
+		a.renderEditWeapon(w, r, http.StatusBadRequest, weapon, "Weapon name is required")
+		return
+	}
+	if specsErr != nil {
+		a.renderEditWeapon(w, r, http.StatusBadRequest, weapon, specsErr.Error())
+		return
+	}
+	exists, existingID, err := a.Weapons.WeaponExists(weapon.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists && existingID != current.ID {
+		a.renderEditWeapon(w, r, http.StatusConflict, weapon, "Weapon with this name already exists")
+		return
+	}
+
+	image, err := uploadFormImage(r, "weapons", weapon.Name)
+	if err != nil {
+		if status := imageErrorStatus(err); status != http.StatusInternalServerError {
+			a.renderEditWeapon(w, r, status, weapon, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.Weapons.UpdateWeapon(weapon, image, changedBy(r)); err != nil {
+		discardImage(image)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/weapon/"+id, http.StatusSeeOther)
+}
+
+// parseWeaponSpecs reads the specs of a weapon from a posted form. Blank
+// fields are unknown specs.
+func parseWeaponSpecs(r *http.Request) (models.WeaponSpecs, error) {
+	var specs models.WeaponSpecs
+	for _, field := range []struct {
+		name  string
+		label string
+		value interface{}
+	}{
+		{"effective_range", "Effective range", &specs.EffectiveRange},
+		{"rate_of_fire", "Rate of fire", &specs.RateOfFire},
+		{"weight_empty", "Empty weight", &specs.WeightEmpty},
+		{"weight_loaded", "Loaded weight", &specs.WeightLoaded},
+		{"length", "Length", &specs.Length},
+		{"magazine_capacity", "Magazine capacity", &specs.MagazineCapacity},
+	} {
+		value := strings.TrimSpace(r.FormValue(field.name))
+		if value == "" {
+			continue
+		}
+		var err error
+		switch v := field.value.(type) {
+		case *int:
+			*v, err = strconv.Atoi(value)
+		case *float64:
+			*v, err = strconv.ParseFloat(value, 64)
+			if err == nil && (math.IsNaN(*v) || math.IsInf(*v, 0)) {
+				err = fmt.Errorf("%s is not finite", value)
+			}
+		}
+		if err != nil {
+			return specs, fmt.Errorf("%s must be a number", field.label)
+		}
+	}
+	return specs, validateWeaponSpecs(specs)
+}
+
+// validateWeaponSpecs checks that no spec of a weapon is negative and that it
+// is no lighter loaded than empty
+func validateWeaponSpecs(s models.WeaponSpecs) error {
+	if s.EffectiveRange < 0 || s.RateOfFire < 0 || s.WeightEmpty < 0 || s.WeightLoaded < 0 ||
+		s.Length < 0 || s.MagazineCapacity < 0 {
+		return fmt.Errorf("Weapon specs cannot be negative")
+	}
+	if s.WeightEmpty > 0 && s.WeightLoaded > 0 && s.WeightLoaded < s.WeightEmpty {
+		return fmt.Errorf("Loaded weight cannot be less than empty weight")
+	}
+	return nil
+}
+
+// renderEditWeapon shows the edit weapon page with the weapon as entered and
+// the error that stopped it from being saved, if any
+func (a *App) renderEditWeapon(w http.ResponseWriter, r *http.Request, status int, weapon models.Weapon, formError string) {
+	data := struct {
+		Weapon models.Weapon
+		Error  string
+	}{weapon, formError}
+
+	w.WriteHeader(status)
+	if err := a.render(w, r, "edit_weapon.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
 // MemberWeaponsHandler handles managing member weapons
-func MemberWeaponsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *App) MemberWeaponsHandler(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) != 4 || pathParts[3] != "weapons" {
 		http.NotFound(w, r)
@@ -168,7 +301,7 @@ func MemberWeaponsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := database.UpdateMemberWeapons(memberID, r.Form["weapons[]"]); err != nil {
+		if err := a.Weapons.UpdateMemberWeapons(memberID, r.Form["weapons[]"], changedBy(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -177,7 +310,7 @@ func MemberWeaponsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	weapons, err := database.GetMemberWeaponsData(memberID)
+	weapons, err := a.Weapons.GetMemberWeaponsData(memberID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -187,4 +320,4 @@ func MemberWeaponsHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(weapons); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-} 
\ No newline at end of file
+}
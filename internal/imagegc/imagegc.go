@@ -0,0 +1,190 @@
+// Package imagegc reconciles the image store with the images that weapons and
+// vehicles refer to. Stored objects nothing refers to are orphans, left behind
+// when an upload could not be saved or a replaced image could not be deleted.
+// References to objects that no longer exist are broken and show as missing
+// images.
+package imagegc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"orbat/internal/database"
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// Folders are the key prefixes weapon and vehicle images are stored under.
+// Objects outside them are never touched.
+var Folders = []string{"weapons/", "vehicles/"}
+
+// DefaultMinAge is how old an unreferenced object must be to count as an
+// orphan, which leaves alone uploads whose weapon or vehicle is still being
+// saved
+const DefaultMinAge = time.Hour
+
+// Options control a reconciliation
+type Options struct {
+	// DryRun reports orphans and broken references without fixing them
+	DryRun bool
+	// MinAge is how old an unreferenced object must be to count as an orphan
+	MinAge time.Duration
+}
+
+// Report is what a reconciliation found
+type Report struct {
+	// Objects is the number of stored objects checked
+	Objects int
+	// Orphans are stored objects that no weapon or vehicle refers to
+	Orphans []storage.Object
+	// Broken are references to an image or rendition that is not stored.
+	// Images recorded by a URL outside the store are not checked.
+	Broken []models.ImageReference
+}
+
+// Run compares the stored objects with the images recorded in the database.
+// Unless opts.DryRun is set, it then deletes the orphans and clears the
+// broken references, so that their weapons and vehicles show no image until
+// a new one is uploaded. A reference is only cleared while it still records
+// the missing image.
+func Run(ctx context.Context, images database.ImageRepository, store storage.Store, opts Options) (Report, error) {
+	var report Report
+
+	// The references are read before the objects are listed. An image saved
+	// in between is then stored but not referenced, and too new to be an
+	// orphan, rather than referenced but apparently missing.
+	refs, err := images.GetImageReferences()
+	if err != nil {
+		return report, err
+	}
+
+	stored := make(map[string]storage.Object)
+	for _, folder := range Folders {
+		objects, err := store.List(ctx, folder)
+		if err != nil {
+			return report, err
+		}
+		for _, obj := range objects {
+			stored[obj.Key] = obj
+		}
+		report.Objects += len(objects)
+	}
+
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		keys := referencedKeys(store, ref)
+		broken := false
+		for _, key := range keys {
+			referenced[key] = true
+			if _, ok := stored[key]; !ok {
+				broken = true
+			}
+		}
+		if broken {
+			report.Broken = append(report.Broken, ref)
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.MinAge)
+	for key, obj := range stored {
+		if !referenced[key] && obj.Modified.Before(cutoff) {
+			report.Orphans = append(report.Orphans, obj)
+		}
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool { return report.Orphans[i].Key < report.Orphans[j].Key })
+
+	if opts.DryRun {
+		return report, nil
+	}
+	for _, obj := range report.Orphans {
+		if err := store.Delete(ctx, obj.Key); err != nil {
+			return report, fmt.Errorf("failed to delete %s: %v", obj.Key, err)
+		}
+	}
+	// An image replaced since the references were read has had its old
+	// objects deleted; its new image is left alone and not reported
+	broken := report.Broken[:0]
+	for _, ref := range report.Broken {
+		cleared, err := images.ClearImage(ref)
+		if err != nil {
+			return report, fmt.Errorf("failed to clear the image of %s %s: %v", ref.EntityType, ref.Name, err)
+		}
+		if cleared {
+			broken = append(broken, ref)
+		}
+	}
+	report.Broken = broken
+	return report, nil
+}
+
+// referencedKeys returns the keys of the stored objects a reference needs:
+// the image under its key and that image's renditions for images uploaded
+// with them, and whatever its URLs point to inside the store
+func referencedKeys(store storage.Store, ref models.ImageReference) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	add(ref.Key)
+	if ref.Key != "" && ref.MediumURL != "" {
+		for _, key := range storage.RenditionKeys(ref.Key) {
+			add(key)
+		}
+	}
+	prefix := store.URL("")
+	for _, url := range []string{ref.URL, ref.MediumURL, ref.ThumbnailURL} {
+		if key, ok := strings.CutPrefix(url, prefix); ok {
+			add(key)
+		}
+	}
+	return keys
+}
+
+// Write lists what the report found. fixed tells whether the orphans were
+// deleted and the broken references cleared.
+func (r Report) Write(w io.Writer, fixed bool) {
+	orphanAction, brokenAction := "Orphaned", "Broken"
+	if fixed {
+		orphanAction, brokenAction = "Deleted orphaned", "Cleared broken"
+	}
+	for _, obj := range r.Orphans {
+		fmt.Fprintf(w, "%s object %s (modified %s)\n", orphanAction, obj.Key, obj.Modified.Format("2006-01-02 15:04"))
+	}
+	for _, ref := range r.Broken {
+		fmt.Fprintf(w, "%s image of %s %s (%s)\n", brokenAction, ref.EntityType, ref.Name, ref.URL)
+	}
+	fmt.Fprintf(w, "Checked %d objects: %d orphaned, %d broken references\n", r.Objects, len(r.Orphans), len(r.Broken))
+}
+
+// Schedule runs a reconciliation every interval until ctx is done, logging
+// what each one finds
+func Schedule(ctx context.Context, interval time.Duration, images database.ImageRepository, store storage.Store, opts Options) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := Run(ctx, images, store, opts)
+		if err != nil {
+			log.Printf("Warning: Image reconciliation failed: %v", err)
+			continue
+		}
+		if len(report.Orphans) > 0 || len(report.Broken) > 0 {
+			report.Write(log.Writer(), !opts.DryRun)
+		}
+	}
+}
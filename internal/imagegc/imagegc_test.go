@@ -0,0 +1,138 @@
+package imagegc
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"orbat/internal/models"
+	"orbat/internal/storage"
+)
+
+// fakeImages is an image repository held in memory. afterRead, if set, runs
+// once the references have been read, standing in for a concurrent save.
+type fakeImages struct {
+	refs      []models.ImageReference
+	cleared   []string
+	afterRead func()
+}
+
+func (f *fakeImages) GetImageReferences() ([]models.ImageReference, error) {
+	refs := append([]models.ImageReference(nil), f.refs...)
+	if f.afterRead != nil {
+		f.afterRead()
+		f.afterRead = nil
+	}
+	return refs, nil
+}
+
+func (f *fakeImages) ClearImage(ref models.ImageReference) (bool, error) {
+	for i, current := range f.refs {
+		if current == ref {
+			f.refs = append(f.refs[:i], f.refs[i+1:]...)
+			f.cleared = append(f.cleared, ref.EntityType+" "+ref.EntityID)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore(storage.ImagePath)
+	old := time.Now().Add(-2 * DefaultMinAge)
+	for _, key := range []string{
+		"weapons/m4-1.jpg", "weapons/m4-1-medium.jpg", "weapons/m4-1-thumb.jpg",
+		"weapons/m4-0.jpg", "weapons/m4-0-medium.jpg", "weapons/m4-0-thumb.jpg",
+		"vehicles/1_hmmwv.png",
+		"other/readme.txt",
+	} {
+		store.Put(ctx, key, strings.NewReader(key))
+		store.SetModified(key, old)
+	}
+	// A fresh upload whose weapon has not been saved yet
+	store.Put(ctx, "weapons/m240-2.jpg", strings.NewReader("new"))
+
+	images := &fakeImages{refs: []models.ImageReference{
+		{EntityType: "weapon", EntityID: "1", Name: "M4", Key: "weapons/m4-1.jpg",
+			URL: "/images/weapons/m4-1.jpg", MediumURL: "/images/weapons/m4-1-medium.jpg", ThumbnailURL: "/images/weapons/m4-1-thumb.jpg"},
+		{EntityType: "vehicle", EntityID: "1", Name: "HMMWV", URL: "/images/vehicles/1_hmmwv.png"},
+		{EntityType: "vehicle", EntityID: "2", Name: "LAV-25", Key: "vehicles/lav-25-3.jpg",
+			URL: "/images/vehicles/lav-25-3.jpg", MediumURL: "/images/vehicles/lav-25-3-medium.jpg", ThumbnailURL: "/images/vehicles/lav-25-3-thumb.jpg"},
+		{EntityType: "weapon", EntityID: "3", Name: "M2", URL: "https://example.com/m2.jpg"},
+	}}
+
+	report, err := Run(ctx, images, store, Options{DryRun: true, MinAge: DefaultMinAge})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	var orphans []string
+	for _, obj := range report.Orphans {
+		orphans = append(orphans, obj.Key)
+	}
+	wantOrphans := []string{"weapons/m4-0-medium.jpg", "weapons/m4-0-thumb.jpg", "weapons/m4-0.jpg"}
+	if !reflect.DeepEqual(orphans, wantOrphans) {
+		t.Errorf("Expected orphans %v, got %v", wantOrphans, orphans)
+	}
+	if len(report.Broken) != 1 || report.Broken[0].Name != "LAV-25" {
+		t.Errorf("Expected the LAV-25 image to be broken, got %+v", report.Broken)
+	}
+	if report.Objects != 8 {
+		t.Errorf("Expected 8 objects to be checked, got %d", report.Objects)
+	}
+	if len(store.Keys()) != 9 || len(images.cleared) != 0 {
+		t.Fatalf("Expected a dry run to change nothing, got %v and %v", store.Keys(), images.cleared)
+	}
+
+	if _, err := Run(ctx, images, store, Options{MinAge: DefaultMinAge}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if objects, _ := store.List(ctx, "weapons/m4-0"); len(objects) != 0 {
+		t.Errorf("Expected the orphans to be deleted, got %v", objects)
+	}
+	if len(store.Keys()) != 6 {
+		t.Errorf("Expected the other objects to be kept, got %v", store.Keys())
+	}
+	if !reflect.DeepEqual(images.cleared, []string{"vehicle 2"}) {
+		t.Errorf("Expected the broken reference to be cleared, got %v", images.cleared)
+	}
+}
+
+func TestRunDuringSave(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore(storage.ImagePath)
+	old := time.Now().Add(-2 * DefaultMinAge)
+	store.Put(ctx, "weapons/m4-1.jpg", strings.NewReader("old"))
+	store.SetModified("weapons/m4-1.jpg", old)
+
+	m4 := models.ImageReference{EntityType: "weapon", EntityID: "1", Name: "M4", Key: "weapons/m4-1.jpg", URL: "/images/weapons/m4-1.jpg"}
+	images := &fakeImages{refs: []models.ImageReference{m4}}
+
+	// While the run is under way, a new M240 image is saved and the M4
+	// image is replaced, deleting the old one
+	images.afterRead = func() {
+		store.Put(ctx, "weapons/m240-2.jpg", strings.NewReader("new"))
+		store.Put(ctx, "weapons/m4-3.jpg", strings.NewReader("new"))
+		store.Delete(ctx, "weapons/m4-1.jpg")
+		images.refs = []models.ImageReference{
+			{EntityType: "weapon", EntityID: "1", Name: "M4", Key: "weapons/m4-3.jpg", URL: "/images/weapons/m4-3.jpg"},
+			{EntityType: "weapon", EntityID: "2", Name: "M240", Key: "weapons/m240-2.jpg", URL: "/images/weapons/m240-2.jpg"},
+		}
+	}
+
+	report, err := Run(ctx, images, store, Options{MinAge: DefaultMinAge})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(report.Orphans) != 0 || len(report.Broken) != 0 {
+		t.Errorf("Expected nothing to be fixed, got %+v", report)
+	}
+	if len(images.cleared) != 0 || len(images.refs) != 2 {
+		t.Errorf("Expected the new images to be kept, got %v cleared and %+v", images.cleared, images.refs)
+	}
+	if len(store.Keys()) != 2 {
+		t.Errorf("Expected the new objects to be kept, got %v", store.Keys())
+	}
+}
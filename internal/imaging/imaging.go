@@ -0,0 +1,186 @@
+// Package imaging checks uploaded equipment photos and turns them into
+// renditions fit for the web. Every rendition is re-encoded as JPEG from the
+// decoded pixels, so EXIF and other metadata in the upload are never stored;
+// the EXIF orientation of JPEG photos is applied to the pixels first.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Decoders for the accepted formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize = 5 << 20
+	// MaxPixels is the largest image accepted, in pixels, which bounds the
+	// memory used to decode an upload to 64 MB for 8-bit images
+	MaxPixels = 16_000_000
+
+	// The longest side of each rendition, in pixels. Smaller images are not
+	// enlarged.
+	FullSize      = 1600
+	MediumSize    = 800
+	ThumbnailSize = 320
+
+	jpegQuality = 85
+)
+
+var (
+	// ErrTooLarge is returned for uploads over MaxSize bytes or MaxPixels pixels
+	ErrTooLarge = errors.New("image is too large")
+	// ErrInvalidImage is returned for uploads that are not a JPEG, PNG or GIF
+	// image, whatever their file name says
+	ErrInvalidImage = errors.New("not a JPEG, PNG or GIF image")
+)
+
+// formats maps the sniffed content types that are accepted to the names the
+// image package decodes them as
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Renditions holds an uploaded image encoded as JPEG at each size
+type Renditions struct {
+	Full      []byte
+	Medium    []byte
+	Thumbnail []byte
+}
+
+// Process reads an uploaded image, checks its size and real content type,
+// and returns its renditions
+func Process(r io.Reader) (Renditions, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return Renditions{}, err
+	}
+	if len(data) > MaxSize {
+		return Renditions{}, fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, MaxSize>>20)
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return Renditions{}, fmt.Errorf("%w: got %s", ErrInvalidImage, contentType)
+	}
+
+	config, configFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || configFormat != format {
+		return Renditions{}, fmt.Errorf("%w: the %s data is damaged", ErrInvalidImage, format)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Renditions{}, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Renditions{}, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	// Scale down to the full size before anything else so that only the
+	// decoded upload is held at its original size
+	img := shrink(decoded, FullSize)
+	if format == "jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	var renditions Renditions
+	for _, rendition := range []struct {
+		size int
+		out  *[]byte
+	}{
+		{FullSize, &renditions.Full},
+		{MediumSize, &renditions.Medium},
+		{ThumbnailSize, &renditions.Thumbnail},
+	} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fit(img, rendition.size), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Renditions{}, fmt.Errorf("failed to encode image: %v", err)
+		}
+		*rendition.out = buf.Bytes()
+	}
+	return renditions, nil
+}
+
+// flatten draws an image onto a white background, as JPEG has no transparency
+func flatten(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
+
+// fit scales a flattened image down so that its longest side is at most size
+// pixels, returning it unchanged if it already fits
+func fit(src *image.RGBA, size int) *image.RGBA {
+	if w, h := src.Bounds().Dx(), src.Bounds().Dy(); w <= size && h <= size {
+		return src
+	}
+	return shrink(src, size)
+}
+
+// shrink flattens an image onto white and scales it down so that its longest
+// side is at most size pixels, averaging the source pixels that each output
+// pixel covers. The source is flattened a strip of rows at a time, so no
+// full-size copy of it is made.
+func shrink(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return flatten(src)
+	}
+
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	strip := image.NewRGBA(image.Rect(0, 0, w, h/dh+1))
+	white := image.NewUniform(color.White)
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*h/dh, (dy+1)*h/dh
+		rows := image.Rect(0, 0, w, y1-y0)
+		draw.Draw(strip, rows, white, image.Point{}, draw.Src)
+		draw.Draw(strip, rows, src, image.Pt(bounds.Min.X, bounds.Min.Y+y0), draw.Over)
+
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*w/dw, (dx+1)*w/dw
+			var sum [4]int
+			for y := 0; y < y1-y0; y++ {
+				row := strip.Pix[y*strip.Stride+x0*4 : y*strip.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := dst.PixOffset(dx, dy)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,158 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a w x h image with a red top-left corner and the rest blue
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{B: 255, A: 255}
+			if x < w/4 && y < h/4 {
+				c = color.NRGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment recording orientation into a JPEG
+func withOrientation(jpg []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // big-endian header, first IFD at 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, // orientation SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(segment) + 2
+	app1 := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, segment...)
+	return append(append(append([]byte{}, jpg[:2]...), app1...), jpg[2:]...)
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("Expected a JPEG rendition, got %s (%v)", format, err)
+	}
+	return img
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(2000, 1000))
+	renditions, err := Process(&buf)
+	if err != nil {
+		t.Fatalf("Failed to process PNG: %v", err)
+	}
+	for _, r := range []struct {
+		data []byte
+		w, h int
+	}{
+		{renditions.Full, 1600, 800},
+		{renditions.Medium, 800, 400},
+		{renditions.Thumbnail, 320, 160},
+	} {
+		if b := decode(t, r.data).Bounds(); b.Dx() != r.w || b.Dy() != r.h {
+			t.Errorf("Expected %dx%d, got %dx%d", r.w, r.h, b.Dx(), b.Dy())
+		}
+	}
+
+	// Small images are not enlarged
+	buf.Reset()
+	png.Encode(&buf, testImage(100, 50))
+	renditions, err = Process(&buf)
+	if err != nil {
+		t.Fatalf("Failed to process PNG: %v", err)
+	}
+	if b := decode(t, renditions.Thumbnail).Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("Expected a small image to keep its size, got %v", b)
+	}
+}
+
+func TestProcessOrientsJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(400, 200), nil)
+
+	// Orientation 6 means the camera was turned, so the image is rotated right
+	renditions, err := Process(bytes.NewReader(withOrientation(buf.Bytes(), 6)))
+	if err != nil {
+		t.Fatalf("Failed to process JPEG: %v", err)
+	}
+	img := decode(t, renditions.Full)
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 400 {
+		t.Fatalf("Expected the image to be turned upright, got %v", b)
+	}
+	if r, _, b, _ := img.At(190, 10).RGBA(); r < b {
+		t.Errorf("Expected the red corner at the top right")
+	}
+	if bytes.Contains(renditions.Full, []byte("Exif")) {
+		t.Errorf("Expected the EXIF data to be stripped")
+	}
+}
+
+// withSize rewrites the dimensions in the header of a PNG
+func withSize(data []byte, w, h uint32) []byte {
+	data = append([]byte{}, data...)
+	binary.BigEndian.PutUint32(data[16:], w)
+	binary.BigEndian.PutUint32(data[20:], h)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessFlattensWhenScaling(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2000, 1000))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 1000; y++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	renditions, err := Process(&buf)
+	if err != nil {
+		t.Fatalf("Failed to process PNG: %v", err)
+	}
+
+	full := decode(t, renditions.Full)
+	if r, g, b, _ := full.At(400, 400).RGBA(); r < 0xf000 || g > 0x1000 || b > 0x1000 {
+		t.Errorf("Expected the left half to stay red, got %x %x %x", r, g, b)
+	}
+	if r, g, b, _ := full.At(1200, 400).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("Expected the transparent half to be white, got %x %x %x", r, g, b)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(1, 1))
+	huge := withSize(buf.Bytes(), 5000, 4000)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"text", []byte("not an image at all"), ErrInvalidImage},
+		{"truncated", []byte("\x89PNG\r\n\x1a\n\x00\x00"), ErrInvalidImage},
+		{"too large", make([]byte, MaxSize+1), ErrTooLarge},
+		{"too many pixels", huge, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := Process(bytes.NewReader(tt.data)); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Package load works out the weight of the weapons each member of a group
+// carries, with team and group totals, to show which roles are overloaded.
+package load
+
+import (
+	"sort"
+
+	"orbat/internal/models"
+)
+
+// OverloadFactor is how many times the average load of a group a member has
+// to carry to count as overloaded
+const OverloadFactor = 1.5
+
+// Group works out the weapon load of the direct members, team members and
+// vehicle crews of g. Weapons of unknown weight count as weighing nothing and
+// are listed in Unweighed.
+func Group(g models.GroupDetails) models.GroupLoad {
+	l := models.GroupLoad{
+		Members: make(map[int]models.MemberLoad),
+		Teams:   make(map[int]float64),
+	}
+	unweighed := make(map[string]bool)
+	var loads []models.MemberLoad
+	add := func(m models.Member, team string) float64 {
+		ml := models.MemberLoad{MemberID: m.ID, Role: m.Role, Rank: m.Rank, Team: team}
+		for _, w := range m.Weapons {
+			if weight := w.Specs.Weight(); weight > 0 {
+				ml.Weight += weight
+			} else {
+				unweighed[w.Name] = true
+			}
+		}
+		l.Members[m.ID] = ml
+		loads = append(loads, ml)
+		l.Total += ml.Weight
+		return ml.Weight
+	}
+
+	for _, m := range g.DirectMembers {
+		add(m, "")
+	}
+	for _, t := range g.Teams {
+		for _, m := range t.Members {
+			l.Teams[t.ID] += add(m, t.Name)
+		}
+	}
+	for _, v := range g.Vehicles {
+		for _, m := range v.Crew {
+			add(m, v.Name+" crew")
+		}
+	}
+
+	// Only members carrying something of known weight count towards the
+	// average, so unarmed members do not make everyone else look overloaded
+	var weighed int
+	for _, ml := range loads {
+		if ml.Weight > 0 {
+			weighed++
+		}
+	}
+	if weighed > 0 {
+		l.Average = l.Total / float64(weighed)
+		for _, ml := range loads {
+			if ml.Weight > OverloadFactor*l.Average {
+				ml.Overloaded = true
+				l.Members[ml.MemberID] = ml
+				l.Overloaded = append(l.Overloaded, ml)
+			}
+		}
+	}
+	sort.SliceStable(l.Overloaded, func(i, j int) bool {
+		return l.Overloaded[i].Weight > l.Overloaded[j].Weight
+	})
+
+	for name := range unweighed {
+		l.Unweighed = append(l.Unweighed, name)
+	}
+	sort.Strings(l.Unweighed)
+	return l
+}
@@ -0,0 +1,46 @@
+package load
+
+import (
+	"testing"
+
+	"orbat/internal/models"
+)
+
+func TestGroup(t *testing.T) {
+	rifle := models.Weapon{Name: "M4A1", Specs: models.WeaponSpecs{WeightEmpty: 2.9, WeightLoaded: 3.5}}
+	saw := models.Weapon{Name: "M249", Specs: models.WeaponSpecs{WeightEmpty: 10}}
+	pistol := models.Weapon{Name: "M17"}
+
+	l := Group(models.GroupDetails{
+		DirectMembers: []models.Member{{ID: 1, Role: "Squad Leader", Weapons: []models.Weapon{rifle, pistol}}},
+		Teams: []models.Team{{ID: 7, Name: "Alpha", Members: []models.Member{
+			{ID: 2, Role: "Automatic Rifleman", Weapons: []models.Weapon{saw}},
+			{ID: 3, Role: "Rifleman", Weapons: []models.Weapon{rifle}},
+			{ID: 4, Role: "Rifleman", Weapons: []models.Weapon{rifle}},
+			{ID: 5, Role: "Radio Operator"},
+		}}},
+	})
+
+	if l.Total != 20.5 || l.Teams[7] != 17 {
+		t.Errorf("Expected 20.5 kg in all and 17 kg in the team, got %v and %v", l.Total, l.Teams[7])
+	}
+	if l.Average != 20.5/4 {
+		t.Errorf("Expected the unarmed member to be left out of the average, got %v", l.Average)
+	}
+	if len(l.Overloaded) != 1 || l.Overloaded[0].Role != "Automatic Rifleman" || l.Overloaded[0].Team != "Alpha" {
+		t.Fatalf("Expected the automatic rifleman to be overloaded, got %+v", l.Overloaded)
+	}
+	if !l.Members[2].Overloaded || l.Members[3].Overloaded {
+		t.Errorf("Expected only member 2 to be marked overloaded, got %+v", l.Members)
+	}
+	if len(l.Unweighed) != 1 || l.Unweighed[0] != "M17" {
+		t.Errorf("Expected the pistol to be unweighed, got %v", l.Unweighed)
+	}
+}
+
+func TestGroupWithoutWeights(t *testing.T) {
+	l := Group(models.GroupDetails{DirectMembers: []models.Member{{ID: 1, Weapons: []models.Weapon{{Name: "M4A1"}}}}})
+	if l.Total != 0 || l.Average != 0 || l.Overloaded != nil {
+		t.Errorf("Expected no load without weights, got %+v", l)
+	}
+}
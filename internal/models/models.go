@@ -1,24 +1,113 @@
 package models
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
-// Group represents a military group
+// Group represents a military group. ParentID is the ID of the group it is
+// subordinate to, or 0 for a top-level group.
 type Group struct {
 	ID          int
 	Name        string
 	Size        int
 	Nationality string
+	ParentID    int
 }
 
-// Weapon represents a weapon type
+// GroupNode is a group together with its subordinate groups
+type GroupNode struct {
+	Group
+	Subgroups []GroupNode
+}
+
+// GroupRollup totals the strength, weapons and vehicles of a group and all of
+// its subordinate groups
+type GroupRollup struct {
+	Strength   int
+	GroupCount int
+	Weapons    []WeaponUsage
+	Vehicles   []VehicleUsage
+}
+
+// NullString is a string that may be NULL in the database. It is written to
+// JSON as the string, or null when it is not valid.
+type NullString struct {
+	sql.NullString
+}
+
+// NewNullString returns a valid NullString holding s
+func NewNullString(s string) NullString {
+	return NullString{sql.NullString{String: s, Valid: true}}
+}
+
+// MarshalJSON writes the string or null
+func (s NullString) MarshalJSON() ([]byte, error) {
+	if !s.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(s.String)
+}
+
+// UnmarshalJSON reads a string or null. It also accepts the
+// {"String": ..., "Valid": ...} objects found in audit entries written
+// before NullString had its own encoding.
+func (s *NullString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = NullString{}
+		return nil
+	case len(data) > 0 && data[0] == '{':
+		return json.Unmarshal(data, &s.NullString)
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*s = NewNullString(str)
+	return nil
+}
+
+// Weapon represents a weapon type. Caliber is as written, and CaliberID is
+// the catalog caliber it is linked to, or 0 if none. A weapon saved with
+// CaliberID 0 is linked to the caliber its caliber is an alias of.
+// MediumURL and ThumbnailURL are smaller renditions of the image at ImageURL;
+// they are null for images uploaded before renditions were made.
 type Weapon struct {
-	ID       int
-	Name     string
-	Type     string
-	Caliber  string
-	ImageURL sql.NullString
+	ID           int
+	Name         string
+	Type         string
+	Caliber      string
+	CaliberID    int
+	Specs        WeaponSpecs
+	ImageURL     NullString
+	MediumURL    NullString
+	ThumbnailURL NullString
+}
+
+// WeaponSpecs are the performance and weight attributes of a weapon, each 0
+// when unknown. EffectiveRange is in metres, RateOfFire in rounds per minute,
+// the weights in kilograms and Length in millimetres.
+type WeaponSpecs struct {
+	EffectiveRange   int
+	RateOfFire       int
+	WeightEmpty      float64
+	WeightLoaded     float64
+	Length           int
+	MagazineCapacity int
+}
+
+// Weight is the weight of the weapon as carried: loaded if known, otherwise
+// empty, or 0 if neither is known
+func (s WeaponSpecs) Weight() float64 {
+	if s.WeightLoaded > 0 {
+		return s.WeightLoaded
+	}
+	return s.WeightEmpty
 }
 
 // Member represents a member of a group or team
@@ -46,10 +135,10 @@ type WeaponUser struct {
 
 // WeaponGroupUsers represents groups using a specific weapon
 type WeaponGroupUsers struct {
-	GroupName    string
-	GroupID      int
-	Nationality  string
-	Users        []WeaponUser
+	GroupName   string
+	GroupID     int
+	Nationality string
+	Users       []WeaponUser
 }
 
 // WeaponDetails represents detailed information about a weapon
@@ -61,14 +150,19 @@ type WeaponDetails struct {
 	Countries    []string
 }
 
-// Vehicle represents a military vehicle
+// Vehicle represents a military vehicle. Within a group, InstanceID identifies
+// the group's copy of the vehicle and Crew holds its crew. The image URLs are
+// as for Weapon.
 type Vehicle struct {
-	ID        string
-	Name      string
-	Type      string
-	Armament  string
-	ImageURL  sql.NullString
-	Crew      []Member
+	ID           string
+	InstanceID   int
+	Name         string
+	Type         string
+	Armament     string
+	ImageURL     NullString
+	MediumURL    NullString
+	ThumbnailURL NullString
+	Crew         []Member
 }
 
 // GroupDetails represents detailed information about a group
@@ -77,6 +171,7 @@ type GroupDetails struct {
 	Name          string
 	Size          int
 	Nationality   string
+	ParentID      int
 	DirectMembers []Member
 	Teams         []Team
 	Vehicles      []Vehicle
@@ -107,10 +202,11 @@ type VehicleMember struct {
 
 // CountryDetails represents detailed information about a country
 type CountryDetails struct {
-	Name     string
-	Groups   []Group
-	Weapons  []WeaponUsage
-	Vehicles []VehicleUsage
+	Name       string
+	Groups     []Group
+	Formations []GroupNode
+	Weapons    []WeaponUsage
+	Vehicles   []VehicleUsage
 }
 
 // WeaponUsage represents usage statistics for a weapon
@@ -123,4 +219,185 @@ type WeaponUsage struct {
 type VehicleUsage struct {
 	Vehicle
 	InstanceCount int
-} 
\ No newline at end of file
+}
+
+// SearchResult is a group, member role, weapon or vehicle matching a search.
+// Kind is "group", "member", "weapon" or "vehicle". A member result covers
+// every member of one group with the same role and rank, and links to the group.
+// Score is relative to the best match of the same kind, which scores 1.
+type SearchResult struct {
+	Kind    string
+	ID      int
+	Name    string
+	Details string
+	Count   int
+	URL     string
+	Score   float64
+}
+
+// ListOptions selects a page of a list. Sort names the field to sort by, with
+// the list's default order when empty. A Limit of 0 returns every row.
+type ListOptions struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// GroupFilter narrows a group list. Nationality is a country code, and a
+// MinSize or MaxSize of 0 leaves that end of the size range open.
+type GroupFilter struct {
+	Nationality string
+	MinSize     int
+	MaxSize     int
+}
+
+// WeaponFilter narrows a weapon list to a type and caliber. Caliber matches
+// the caliber as written and CaliberID the catalog caliber, when not 0.
+type WeaponFilter struct {
+	Type      string
+	Caliber   string
+	CaliberID int
+}
+
+// VehicleFilter narrows a vehicle list to a type
+type VehicleFilter struct {
+	Type string
+}
+
+// User is an account that can log in. Role is viewer, editor or admin.
+// PasswordHash is never sent to clients.
+type User struct {
+	ID           int
+	Username     string
+	Role         string
+	PasswordHash string `json:"-"`
+}
+
+// AuditEntry records one change to a group, member, weapon, vehicle or
+// country. Before and After hold the entity as JSON, and are empty when it
+// did not exist.
+type AuditEntry struct {
+	ID         int
+	Time       time.Time
+	Username   string
+	EntityType string
+	EntityID   string
+	Action     string
+	Before     string
+	After      string
+}
+
+// AuditFilter selects audit entries. Empty fields match every entry.
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	Username   string
+}
+
+// GroupRevision is a group as saved by one change, numbered from 1 in the
+// order the changes were made. A deleted revision holds the group as it was
+// when deleted.
+type GroupRevision struct {
+	Number   int
+	Time     time.Time
+	Username string
+	Action   string
+	Group    GroupDetails
+}
+
+// GroupComparison sets groups side by side. Each row of a section holds one
+// count per group, in the order of Groups.
+type GroupComparison struct {
+	Groups   []Group
+	Sections []ComparisonSection
+}
+
+// ComparisonSection is a titled part of a comparison, such as the roles
+type ComparisonSection struct {
+	Title string
+	Rows  []ComparisonRow
+}
+
+// ComparisonRow counts one thing, such as a role or caliber, in every compared
+// group. Differs is set when the counts are not all the same.
+type ComparisonRow struct {
+	Label   string
+	Counts  []int
+	Differs bool
+}
+
+// ImageReference is the image recorded for a weapon or vehicle. EntityType is
+// "weapon" or "vehicle", and Key is empty for images recorded only by URL.
+type ImageReference struct {
+	EntityType   string
+	EntityID     string
+	Name         string
+	Key          string
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
+}
+
+// Caliber is a kind of ammunition. Aliases are the ways weapon calibers are
+// written that mean it, in lower case, and Substitutes the calibers that
+// weapons chambered for it can also fire. WeaponCount is the number of
+// catalog weapons firing it.
+type Caliber struct {
+	ID          int
+	Name        string
+	Aliases     []string
+	Substitutes []Caliber
+	WeaponCount int
+}
+
+// AmmunitionDemand counts the weapons of a group or country by the caliber
+// they fire. UnknownArmament lists vehicle armament that matches no weapon or
+// caliber.
+type AmmunitionDemand struct {
+	Calibers        []CaliberDemand
+	UnknownArmament []string
+}
+
+// CaliberDemand counts the weapons firing one caliber: Carried by members and
+// Mounted on vehicles. CaliberID is 0 for calibers missing from the catalog,
+// which are named as written on their weapons.
+type CaliberDemand struct {
+	CaliberID   int
+	Caliber     string
+	Carried     int
+	Mounted     int
+	Weapons     []string
+	Substitutes []string
+}
+
+// Total is the number of weapons firing the caliber
+func (d CaliberDemand) Total() int {
+	return d.Carried + d.Mounted
+}
+
+// GroupLoad is the weight of the weapons carried by the members of a group,
+// in kilograms. Members holds the load of each member by member ID and Teams
+// the total of each team by team ID. Average is the mean load of the members
+// carrying weapons of known weight; members carrying more than
+// load.OverloadFactor times the average are listed in Overloaded, heaviest
+// first.
+// Unweighed names the weapons carried whose weight is unknown.
+type GroupLoad struct {
+	Members    map[int]MemberLoad
+	Teams      map[int]float64
+	Total      float64
+	Average    float64
+	Overloaded []MemberLoad
+	Unweighed  []string
+}
+
+// MemberLoad is the weight of the weapons one member carries
+type MemberLoad struct {
+	MemberID   int
+	Role       string
+	Rank       string
+	Team       string
+	Weight     float64
+	Overloaded bool
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore stores images as public objects in a Google Cloud Storage bucket
+type GCSStore struct {
+	client *storage.Client
+	bucket string
+	// skipDeletes leaves objects in place in the test environment, which
+	// shares its bucket with development
+	skipDeletes bool
+}
+
+// NewGCSStore connects to the bucket using the default credentials
+func NewGCSStore(ctx context.Context, bucket string) (*GCSStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %v", err)
+	}
+	return &GCSStore{
+		client:      client,
+		bucket:      bucket,
+		skipDeletes: os.Getenv("ENV") == "test",
+	}, nil
+}
+
+// Put uploads the object and makes it publicly readable
+func (s *GCSStore) Put(ctx context.Context, key string, r io.Reader) error {
+	obj := s.client.Bucket(s.bucket).Object(key)
+
+	writer := obj.NewWriter(ctx)
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader)
+}
+
+// Delete removes the object. Deleting a missing object is not an error.
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	if s.skipDeletes {
+		fmt.Printf("Test environment: Skipping deletion of image %s\n", key)
+		return nil
+	}
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the objects whose keys start with prefix, sorted by key
+func (s *GCSStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	it := s.client.Bucket(s.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket: %v", err)
+		}
+		objects = append(objects, Object{Key: attrs.Name, Modified: attrs.Updated})
+	}
+}
+
+// URL returns the public URL of the object
+func (s *GCSStore) URL(key string) string {
+	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", s.bucket, key)
+}
+
+// Close closes the client
+func (s *GCSStore) Close() error {
+	return s.client.Close()
+}
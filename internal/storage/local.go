@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore stores images as files in a directory and serves them itself
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStore stores images below dir, creating it if needed. baseURL is
+// the path the store's handler is mounted at.
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &LocalStore{dir: dir, baseURL: baseURL}, nil
+}
+
+// path returns the file for key, which always lies inside the directory
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes the file, replacing any existing one
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	filename := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(filename)
+		return err
+	}
+	return file.Close()
+}
+
+// Delete removes the file. Deleting a missing file is not an error.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the files whose keys start with prefix, sorted by key
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(s.dir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, filename)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage directory: %v", err)
+	}
+	// The walk is in path order, which puts "a/b" before "a-b"
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// URL returns the path the file is served from
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + path.Clean("/" + key)[1:]
+}
+
+// Close does nothing
+func (s *LocalStore) Close() error {
+	return nil
+}
+
+// ServeHTTP serves the file named by the request path
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filename := s.path(r.URL.Path)
+	info, err := os.Stat(filename)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filename)
+}
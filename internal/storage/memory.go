@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps images in memory and serves them itself. It is meant for
+// tests and for trying the app out without any storage set up.
+type MemoryStore struct {
+	baseURL string
+
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data     []byte
+	modified time.Time
+}
+
+// NewMemoryStore creates an empty store. baseURL is the path the store's
+// handler is mounted at.
+func NewMemoryStore(baseURL string) *MemoryStore {
+	return &MemoryStore{baseURL: baseURL, objects: make(map[string]memoryObject)}
+}
+
+// Put stores a copy of the data
+func (s *MemoryStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{data: data, modified: time.Now()}
+	return nil
+}
+
+// Delete removes the object. Deleting a missing object is not an error.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// List returns the objects whose keys start with prefix, sorted by key
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []Object
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, Object{Key: key, Modified: obj.modified})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// SetModified changes when the object was last modified. It lets tests age
+// objects.
+func (s *MemoryStore) SetModified(key string, modified time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if obj, ok := s.objects[key]; ok {
+		obj.modified = modified
+		s.objects[key] = obj
+	}
+}
+
+// URL returns the path the object is served from
+func (s *MemoryStore) URL(key string) string {
+	return s.baseURL + key
+}
+
+// Close does nothing
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Keys returns the keys of all stored objects
+func (s *MemoryStore) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ServeHTTP serves the object named by the request path
+func (s *MemoryStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	obj, ok := s.objects[r.URL.Path]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, path.Base(r.URL.Path), obj.modified, bytes.NewReader(obj.data))
+}
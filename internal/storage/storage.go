@@ -1,102 +1,189 @@
+// Package storage stores weapon and vehicle images. Images are saved under
+// object keys such as "weapons/m4a1-1700000000.jpg", with smaller renditions
+// beside them under "weapons/m4a1-1700000000-medium.jpg" and
+// "weapons/m4a1-1700000000-thumb.jpg". The key is kept in the database so the
+// image can be deleted later, together with the URLs the renditions are
+// shown from.
 package storage
 
 import (
-	"cloud.google.com/go/storage"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path"
 	"strings"
 	"time"
+
+	"orbat/internal/imaging"
 )
 
-// Client is the global storage client
-var Client *storage.Client
-var BucketName string
-var environment string
+// Store saves images under object keys
+type Store interface {
+	// Put stores the contents of r under key
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// URL returns the address the object stored under key is served from
+	URL(key string) string
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Object is a stored object
+type Object struct {
+	Key      string
+	Modified time.Time
+}
+
+// ImagePath is the path the app serves images from for stores that do not
+// serve them themselves
+const ImagePath = "/images/"
 
-// Initialize sets up the storage client
+var current Store
+
+// Initialize sets up the store selected by STORAGE_BACKEND: "gcs" uses the
+// bucket in GCS_BUCKET_NAME, "local" the directory in STORAGE_DIR (uploads by
+// default) and "memory" keeps images in memory until the app exits. Without
+// STORAGE_BACKEND, GCS is used when GCS_BUCKET_NAME is set and a local
+// directory otherwise.
 func Initialize() error {
-	var err error
-	ctx := context.Background()
-	
-	Client, err = storage.NewClient(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create storage client: %v", err)
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("GCS_BUCKET_NAME") != "" {
+			backend = "gcs"
+		}
 	}
 
-	BucketName = os.Getenv("GCS_BUCKET_NAME")
-	if BucketName == "" {
-		return fmt.Errorf("GCS_BUCKET_NAME environment variable not set")
+	var err error
+	switch backend {
+	case "gcs":
+		bucket := os.Getenv("GCS_BUCKET_NAME")
+		if bucket == "" {
+			return fmt.Errorf("GCS_BUCKET_NAME environment variable not set")
+		}
+		current, err = NewGCSStore(context.Background(), bucket)
+	case "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		current, err = NewLocalStore(dir, ImagePath)
+	case "memory":
+		current = NewMemoryStore(ImagePath)
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND: %s", backend)
 	}
-
-	// Store the environment setting
-	environment = os.Getenv("ENV")
-	if environment == "" {
-		environment = "development"
+	if err != nil {
+		return err
 	}
-	
+
+	fmt.Printf("Info: Storing images in %s storage\n", backend)
 	return nil
 }
 
-// Close closes the storage client
-func Close() {
-	if Client != nil {
-		Client.Close()
-	}
+// SetStore replaces the store used by the package functions
+func SetStore(s Store) {
+	current = s
 }
 
-// UploadImage uploads an image to Google Cloud Storage
-func UploadImage(file io.Reader, filename string) (string, error) {
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Minute*10)
-	defer cancel()
-
-	bucket := Client.Bucket(BucketName)
-	obj := bucket.Object(filename)
+// Current returns the store used by the package functions
+func Current() Store {
+	return current
+}
 
-	writer := obj.NewWriter(ctx)
-	if _, err := io.Copy(writer, file); err != nil {
-		return "", err
-	}
-	if err := writer.Close(); err != nil {
-		return "", err
+// Close closes the store
+func Close() {
+	if current != nil {
+		current.Close()
 	}
+}
 
-	// Make the object public
-	if err := obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		return "", err
+// Handler returns the handler serving images from the store, or nil if the
+// store's images are served from elsewhere
+func Handler() http.Handler {
+	if h, ok := current.(http.Handler); ok {
+		return http.StripPrefix(ImagePath, h)
 	}
+	return nil
+}
 
-	return fmt.Sprintf("https://storage.googleapis.com/%s/%s", BucketName, filename), nil
+// Image is an uploaded image: the key it is stored under and the URLs of its
+// renditions
+type Image struct {
+	Key          string
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
 }
 
-// DeleteImage deletes an image from Google Cloud Storage
-func DeleteImage(imageURL string) error {
-	// Don't actually delete files when in test environment
-	if environment == "test" {
-		fmt.Printf("Test environment: Skipping deletion of image %s\n", imageURL)
-		return nil
+// UploadImage checks an uploaded image, makes its renditions and stores them
+// under keys starting with base, which should not have an extension. Uploads
+// that are not images, or are too large, fail with the errors of the imaging
+// package.
+func UploadImage(file io.Reader, base string) (Image, error) {
+	renditions, err := imaging.Process(file)
+	if err != nil {
+		return Image{}, err
 	}
 
-	// Extract bucket name and object path from the URL
-	// URL format: https://storage.googleapis.com/BUCKET_NAME/PATH/TO/OBJECT
-	urlParts := strings.Split(imageURL, "/")
-	if len(urlParts) < 4 {
-		return fmt.Errorf("invalid GCS URL format")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	key := base + ".jpg"
+	uploads := []struct {
+		key  string
+		data []byte
+	}{
+		{key, renditions.Full},
+		{renditionKey(key, "medium"), renditions.Medium},
+		{renditionKey(key, "thumb"), renditions.Thumbnail},
+	}
+	for i, upload := range uploads {
+		if err := current.Put(ctx, upload.key, bytes.NewReader(upload.data)); err != nil {
+			// Remove the renditions already stored
+			for _, stored := range uploads[:i] {
+				current.Delete(ctx, stored.key)
+			}
+			return Image{}, fmt.Errorf("failed to upload image: %v", err)
+		}
 	}
-	
-	objectPath := strings.Join(urlParts[4:], "/")
 
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	return Image{
+		Key:          key,
+		URL:          current.URL(key),
+		MediumURL:    current.URL(uploads[1].key),
+		ThumbnailURL: current.URL(uploads[2].key),
+	}, nil
+}
+
+// DeleteImage deletes the image stored under key and its renditions. Images
+// uploaded before renditions were made have none, which is not an error.
+func DeleteImage(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
 
-	// Delete the object from GCS
-	err := Client.Bucket(BucketName).Object(objectPath).Delete(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to delete image from storage: %v", err)
+	for _, k := range append([]string{key}, RenditionKeys(key)...) {
+		if err := current.Delete(ctx, k); err != nil {
+			return fmt.Errorf("failed to delete image from storage: %v", err)
+		}
 	}
-	
 	return nil
-} 
\ No newline at end of file
+}
+
+// RenditionKeys returns the keys of the renditions of the image stored under
+// key
+func RenditionKeys(key string) []string {
+	return []string{renditionKey(key, "medium"), renditionKey(key, "thumb")}
+}
+
+// renditionKey returns the key of a rendition of the image stored under key
+func renditionKey(key, rendition string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "-" + rendition + ".jpg"
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore checks the behaviour every Store must share. The keys it writes
+// start with prefix, so it can run against a bucket that holds other objects.
+func testStore(t *testing.T, store Store, prefix string) {
+	t.Helper()
+	ctx := context.Background()
+
+	keys := []string{
+		prefix + "weapons/m4a1-2.jpg",
+		prefix + "weapons/m4a1-1.jpg",
+		prefix + "weapons-old.jpg",
+		prefix + "vehicles/m1151-1.jpg",
+		prefix + "weapons/m249-1.jpg",
+	}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("image "+key)); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, key := range keys {
+			store.Delete(ctx, key)
+		}
+	})
+
+	// Keys are listed by prefix, sorted by key
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix + "weapons/", []string{prefix + "weapons/m249-1.jpg", prefix + "weapons/m4a1-1.jpg", prefix + "weapons/m4a1-2.jpg"}},
+		{prefix + "weapons", []string{prefix + "weapons-old.jpg", prefix + "weapons/m249-1.jpg", prefix + "weapons/m4a1-1.jpg", prefix + "weapons/m4a1-2.jpg"}},
+		{prefix + "weapons/m4a1-", []string{prefix + "weapons/m4a1-1.jpg", prefix + "weapons/m4a1-2.jpg"}},
+		{prefix + "aircraft/", nil},
+	}
+	for _, tt := range tests {
+		objects, err := store.List(ctx, tt.prefix)
+		if err != nil {
+			t.Fatalf("Failed to list %q: %v", tt.prefix, err)
+		}
+		var got []string
+		for _, obj := range objects {
+			got = append(got, obj.Key)
+			if obj.Modified.IsZero() || time.Since(obj.Modified) > time.Hour {
+				t.Errorf("Expected %s to have been modified just now, got %v", obj.Key, obj.Modified)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("List(%q): expected %v, got %v", tt.prefix, tt.want, got)
+		}
+	}
+
+	// Putting an existing key replaces it
+	key := prefix + "weapons/m4a1-1.jpg"
+	if err := store.Put(ctx, key, strings.NewReader("replaced")); err != nil {
+		t.Fatalf("Failed to replace %s: %v", key, err)
+	}
+	if objects, _ := store.List(ctx, key); len(objects) != 1 {
+		t.Errorf("Expected one object under %s after replacing it, got %v", key, objects)
+	}
+
+	// Deleting removes the object, and deleting it again is not an error
+	for i := 0; i < 2; i++ {
+		if err := store.Delete(ctx, key); err != nil {
+			t.Errorf("Delete %d of %s: %v", i+1, key, err)
+		}
+	}
+	if err := store.Delete(ctx, prefix+"never/stored.jpg"); err != nil {
+		t.Errorf("Expected no error deleting a key that was never stored, got %v", err)
+	}
+	if objects, _ := store.List(ctx, key); len(objects) != 0 {
+		t.Errorf("Expected %s to be deleted, got %v", key, objects)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(ImagePath)
+	testStore(t, store, "")
+
+	store.Put(context.Background(), "weapons/m4a1.jpg", strings.NewReader("rifle"))
+	if url := store.URL("weapons/m4a1.jpg"); url != "/images/weapons/m4a1.jpg" {
+		t.Errorf("Expected the image under /images/, got %s", url)
+	}
+	// The handler is mounted with the base URL stripped from the path
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path = "weapons/m4a1.jpg"
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, req)
+	if rec.Code != 200 || rec.Body.String() != "rifle" {
+		t.Errorf("Expected the image to be served, got %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "uploads"), ImagePath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	testStore(t, store, "")
+}
+
+func TestLocalStorePaths(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "uploads")
+	store, err := NewLocalStore(root, ImagePath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// Keys are cleaned so that every file lies inside the directory
+	tests := []struct {
+		key  string
+		file string
+		url  string
+	}{
+		{"weapons/m4a1.jpg", "weapons/m4a1.jpg", "/images/weapons/m4a1.jpg"},
+		{"/weapons/m4a1.jpg", "weapons/m4a1.jpg", "/images/weapons/m4a1.jpg"},
+		{"weapons/../vehicles/m1151.jpg", "vehicles/m1151.jpg", "/images/vehicles/m1151.jpg"},
+		{"../outside.jpg", "outside.jpg", "/images/outside.jpg"},
+		{"../../etc/passwd", "etc/passwd", "/images/etc/passwd"},
+		{"/../../etc/passwd", "etc/passwd", "/images/etc/passwd"},
+		{"weapons//./m4a1.jpg", "weapons/m4a1.jpg", "/images/weapons/m4a1.jpg"},
+	}
+	for _, tt := range tests {
+		want := filepath.Join(root, filepath.FromSlash(tt.file))
+		if got := store.path(tt.key); got != want {
+			t.Errorf("path(%q): expected %s, got %s", tt.key, want, got)
+		}
+		if got := store.URL(tt.key); got != tt.url {
+			t.Errorf("URL(%q): expected %s, got %s", tt.key, tt.url, got)
+		}
+	}
+
+	// Nothing is written or served outside the directory
+	ctx := context.Background()
+	if err := store.Put(ctx, "../outside.jpg", strings.NewReader("image")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written outside the store, got %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+	for _, target := range []string{"../secret.txt", "outside.jpg"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = target
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, req)
+		served, _ := io.ReadAll(rec.Body)
+		if strings.Contains(string(served), "secret") {
+			t.Errorf("%s: served a file outside the store", target)
+		}
+		if target == "outside.jpg" && string(served) != "image" {
+			t.Errorf("%s: expected the cleaned key to be served, got %d %q", target, rec.Code, served)
+		}
+	}
+}
+
+// TestGCSStore runs against the bucket in GCS_TEST_BUCKET with the default
+// credentials, and is skipped when it is not set
+func TestGCSStore(t *testing.T) {
+	bucket := os.Getenv("GCS_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("GCS_TEST_BUCKET is not set")
+	}
+	store, err := NewGCSStore(context.Background(), bucket)
+	if err != nil {
+		t.Fatalf("Failed to connect to the bucket: %v", err)
+	}
+	defer store.Close()
+	store.skipDeletes = false
+
+	testStore(t, store, "storage-test-"+time.Now().Format("20060102150405.000000000")+"/")
+	if url := store.URL("weapons/m4a1.jpg"); url != "https://storage.googleapis.com/"+bucket+"/weapons/m4a1.jpg" {
+		t.Errorf("Expected the public object URL, got %s", url)
+	}
+}
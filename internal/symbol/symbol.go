@@ -0,0 +1,320 @@
+// Package symbol draws APP-6 / MIL-STD-2525 land unit symbols as SVG: an
+// affiliation frame, a branch icon inside it and an echelon marker above it.
+package symbol
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"orbat/internal/models"
+)
+
+// Affiliation selects the frame shape and fill colour
+type Affiliation string
+
+const (
+	Friend  Affiliation = "friend"
+	Neutral Affiliation = "neutral"
+	Hostile Affiliation = "hostile"
+	Unknown Affiliation = "unknown"
+)
+
+// ParseAffiliation reads an affiliation name
+func ParseAffiliation(name string) (Affiliation, error) {
+	switch a := Affiliation(strings.ToLower(strings.TrimSpace(name))); a {
+	case Friend, Neutral, Hostile, Unknown:
+		return a, nil
+	}
+	return "", fmt.Errorf("invalid affiliation: %s", name)
+}
+
+// Echelon is the size of a unit, shown above the frame
+type Echelon int
+
+const (
+	Team Echelon = iota
+	Squad
+	Section
+	Platoon
+	Company
+	Battalion
+	Regiment
+	Brigade
+	Division
+)
+
+var echelonNames = []string{"Team", "Squad", "Section", "Platoon", "Company", "Battalion", "Regiment", "Brigade", "Division"}
+
+func (e Echelon) String() string {
+	return echelonNames[e]
+}
+
+// Branch is the unit's arm of service, shown as the icon inside the frame
+type Branch string
+
+const (
+	Infantry           Branch = "Infantry"
+	MechanizedInfantry Branch = "Mechanized Infantry"
+	Armour             Branch = "Armour"
+	Reconnaissance     Branch = "Reconnaissance"
+	Artillery          Branch = "Artillery"
+	Aviation           Branch = "Aviation"
+)
+
+// Symbol describes a unit symbol
+type Symbol struct {
+	Affiliation Affiliation
+	Echelon     Echelon
+	Branch      Branch
+	// Country is the two-letter country code written beside the frame and
+	// included in the SIDC, if set
+	Country string
+}
+
+// echelonKeywords map words in group names to echelons. The group size is
+// used when the name does not contain any of them.
+var echelonKeywords = []struct {
+	word    string
+	echelon Echelon
+}{
+	{"squadron", Company}, {"fire team", Team}, {"team", Team}, {"crew", Team}, {"detachment", Team},
+	{"squad", Squad}, {"section", Section}, {"platoon", Platoon}, {"troop", Platoon},
+	{"company", Company}, {"battery", Company},
+	{"battalion", Battalion}, {"regiment", Regiment}, {"brigade", Brigade}, {"division", Division},
+}
+
+// ForGroup derives the symbol of a group from its name and size, so that it
+// can be drawn for groups listed without their members and vehicles
+func ForGroup(group models.Group, affiliation Affiliation) Symbol {
+	return Symbol{
+		Affiliation: affiliation,
+		Echelon:     groupEchelon(group),
+		Branch:      groupBranch(group),
+	}
+}
+
+func groupEchelon(group models.Group) Echelon {
+	name := strings.ToLower(group.Name)
+	for _, k := range echelonKeywords {
+		if strings.Contains(name, k.word) {
+			return k.echelon
+		}
+	}
+
+	switch size := group.Size; {
+	case size <= 4:
+		return Team
+	case size <= 13:
+		return Squad
+	case size <= 20:
+		return Section
+	case size <= 60:
+		return Platoon
+	case size <= 250:
+		return Company
+	case size <= 1000:
+		return Battalion
+	case size <= 3000:
+		return Regiment
+	case size <= 8000:
+		return Brigade
+	}
+	return Division
+}
+
+// groupBranch picks the branch from the group name, falling back to infantry
+func groupBranch(group models.Group) Branch {
+	name := strings.ToLower(group.Name)
+	switch {
+	case containsAny(name, "helicopter", "aviation", "air assault"):
+		return Aviation
+	case containsAny(name, "mechanized", "mechanised", "panzergrenadier", "motorized", "motorised"):
+		return MechanizedInfantry
+	case containsAny(name, "recon", "scout", "cavalry"):
+		return Reconnaissance
+	case containsAny(name, "armour", "armor", "tank", "panzer"):
+		return Armour
+	case containsAny(name, "artillery", "battery", "howitzer", "mortar"):
+		return Artillery
+	}
+	return Infantry
+}
+
+func containsAny(s string, words ...string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// SIDC returns the 15 character MIL-STD-2525C symbol identification code
+func (s Symbol) SIDC() string {
+	affiliation, ok := map[Affiliation]byte{Friend: 'F', Neutral: 'N', Hostile: 'H', Unknown: 'U'}[s.Affiliation]
+	if !ok {
+		affiliation = 'U'
+	}
+	function, ok := map[Branch]string{
+		Infantry:           "UCI---",
+		MechanizedInfantry: "UCIZ--",
+		Armour:             "UCA---",
+		Reconnaissance:     "UCR---",
+		Artillery:          "UCF---",
+		Aviation:           "UCVR--",
+	}[s.Branch]
+	if !ok {
+		function = "U-----"
+	}
+	country := "--"
+	if len(s.Country) == 2 {
+		country = strings.ToUpper(s.Country)
+	}
+	return fmt.Sprintf("S%cGP%s-%c%s-", affiliation, function, 'A'+byte(s.Echelon), country)
+}
+
+// box is a rectangle in the symbol's coordinates
+type box struct {
+	x0, y0, x1, y1 float64
+}
+
+func (b box) width() float64  { return b.x1 - b.x0 }
+func (b box) height() float64 { return b.y1 - b.y0 }
+func (b box) cx() float64     { return (b.x0 + b.x1) / 2 }
+func (b box) cy() float64     { return (b.y0 + b.y1) / 2 }
+
+// frame is the outline of an affiliation together with the area its branch
+// icon is drawn in
+type frame struct {
+	fill    string
+	outline string
+	top     float64
+	icon    box
+}
+
+var frames = map[Affiliation]frame{
+	Friend: {
+		fill:    "#80E0FF",
+		outline: `<rect x="25" y="60" width="150" height="100"/>`,
+		top:     60,
+		icon:    box{25, 60, 175, 160},
+	},
+	Neutral: {
+		fill:    "#AAFFAA",
+		outline: `<rect x="45" y="55" width="110" height="110"/>`,
+		top:     55,
+		icon:    box{45, 55, 155, 165},
+	},
+	Hostile: {
+		fill:    "#FF8080",
+		outline: `<polygon points="100,40 170,110 100,180 30,110"/>`,
+		top:     40,
+		icon:    box{65, 75, 135, 145},
+	},
+	Unknown: {
+		fill:    "#FFFF80",
+		outline: `<path d="M 65,75 A 40,40 0 0 1 135,75 A 40,40 0 0 1 135,145 A 40,40 0 0 1 65,145 A 40,40 0 0 1 65,75 Z"/>`,
+		top:     48,
+		icon:    box{65, 75, 135, 145},
+	},
+}
+
+// SVG renders the symbol as a standalone SVG document
+func (s Symbol) SVG() []byte {
+	return s.SizedSVG(95)
+}
+
+// SizedSVG renders the symbol as SVG drawn height pixels high, for embedding
+// in a page
+func (s Symbol) SizedSVG(height int) []byte {
+	f, ok := frames[s.Affiliation]
+	if !ok {
+		f = frames[Unknown]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 240 190" width="%d" height="%d">`,
+		(height*240+95)/190, height)
+	fmt.Fprintf(&buf, `<title>%s %s %s (%s)</title>`, s.Affiliation, s.Branch, s.Echelon, s.SIDC())
+	fmt.Fprintf(&buf, `<g fill="%s" stroke="#000" stroke-width="4">%s</g>`, f.fill, f.outline)
+	buf.WriteString(`<g fill="none" stroke="#000" stroke-width="4">`)
+	writeBranch(&buf, s.Branch, f.icon)
+	buf.WriteString(`</g>`)
+	writeEchelon(&buf, s.Echelon, f.top-10)
+	if s.Country != "" {
+		fmt.Fprintf(&buf, `<text x="182" y="175" font-family="sans-serif" font-size="22">%s</text>`, html.EscapeString(s.Country))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+func writeBranch(buf *bytes.Buffer, branch Branch, b box) {
+	cross := fmt.Sprintf(`<path d="M %g,%g L %g,%g M %g,%g L %g,%g"/>`,
+		b.x0, b.y0, b.x1, b.y1, b.x0, b.y1, b.x1, b.y0)
+	track := fmt.Sprintf(`<rect x="%g" y="%g" width="%g" height="%g" rx="%g"/>`,
+		b.cx()-b.width()*0.3, b.cy()-b.height()*0.18, b.width()*0.6, b.height()*0.36, b.height()*0.18)
+
+	switch branch {
+	case MechanizedInfantry:
+		buf.WriteString(cross)
+		buf.WriteString(track)
+	case Armour:
+		buf.WriteString(track)
+	case Reconnaissance:
+		fmt.Fprintf(buf, `<path d="M %g,%g L %g,%g"/>`, b.x0, b.y1, b.x1, b.y0)
+	case Artillery:
+		fmt.Fprintf(buf, `<circle cx="%g" cy="%g" r="%g" fill="#000"/>`, b.cx(), b.cy(), b.height()*0.12)
+	case Aviation:
+		w, h := b.width()*0.3, b.height()*0.2
+		fmt.Fprintf(buf, `<polygon points="%g,%g %g,%g %g,%g %g,%g"/>`,
+			b.cx()-w, b.cy()-h, b.cx()+w, b.cy()+h, b.cx()+w, b.cy()-h, b.cx()-w, b.cy()+h)
+	default:
+		buf.WriteString(cross)
+	}
+}
+
+// writeEchelon draws the echelon marker centred above the frame, with its
+// bottom at y
+func writeEchelon(buf *bytes.Buffer, echelon Echelon, y float64) {
+	// repeat draws count copies of a marker spaced evenly around the centre
+	repeat := func(count int, spacing float64, draw func(x float64)) {
+		start := 100 - spacing*float64(count-1)/2
+		for i := 0; i < count; i++ {
+			draw(start + spacing*float64(i))
+		}
+	}
+	dot := func(x float64) {
+		fmt.Fprintf(buf, `<circle cx="%g" cy="%g" r="6"/>`, x, y-6)
+	}
+	bar := func(x float64) {
+		fmt.Fprintf(buf, `<path d="M %g,%g L %g,%g" stroke="#000" stroke-width="4"/>`, x, y, x, y-22)
+	}
+	cross := func(x float64) {
+		fmt.Fprintf(buf, `<path d="M %g,%g L %g,%g M %g,%g L %g,%g" stroke="#000" stroke-width="4"/>`,
+			x-9, y, x+9, y-22, x-9, y-22, x+9, y)
+	}
+
+	switch echelon {
+	case Team:
+		fmt.Fprintf(buf, `<circle cx="100" cy="%g" r="10" fill="none" stroke="#000" stroke-width="4"/>`, y-11)
+		fmt.Fprintf(buf, `<path d="M 88,%g L 112,%g" stroke="#000" stroke-width="4"/>`, y+1, y-23)
+	case Squad:
+		repeat(1, 18, dot)
+	case Section:
+		repeat(2, 18, dot)
+	case Platoon:
+		repeat(3, 18, dot)
+	case Company:
+		repeat(1, 14, bar)
+	case Battalion:
+		repeat(2, 14, bar)
+	case Regiment:
+		repeat(3, 14, bar)
+	case Brigade:
+		repeat(1, 24, cross)
+	case Division:
+		repeat(2, 24, cross)
+	}
+}
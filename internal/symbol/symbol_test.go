@@ -0,0 +1,51 @@
+package symbol
+
+import (
+	"strings"
+	"testing"
+
+	"orbat/internal/models"
+)
+
+func TestForGroup(t *testing.T) {
+	tests := []struct {
+		group   models.Group
+		echelon Echelon
+		branch  Branch
+	}{
+		{models.Group{Name: "Ranger Rifle Squad", Size: 9}, Squad, Infantry},
+		{models.Group{Name: "Royal Marines Section", Size: 8}, Section, Infantry},
+		{models.Group{Name: "Scout Squadron", Size: 90}, Company, Reconnaissance},
+		{models.Group{Name: "Alpha", Size: 40}, Platoon, Infantry},
+		{models.Group{Name: "Panzergrenadiers", Size: 9}, Squad, MechanizedInfantry},
+		{models.Group{Name: "1st Tank Platoon", Size: 16}, Platoon, Armour},
+		{models.Group{Name: "Charlie Battery", Size: 120}, Company, Artillery},
+	}
+
+	for _, tt := range tests {
+		s := ForGroup(tt.group, Friend)
+		if s.Echelon != tt.echelon || s.Branch != tt.branch {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.group.Name, tt.branch, tt.echelon, s.Branch, s.Echelon)
+		}
+	}
+}
+
+func TestSizedSVG(t *testing.T) {
+	s := Symbol{Affiliation: Friend, Echelon: Squad, Branch: Infantry}
+	if svg := string(s.SVG()); !strings.Contains(svg, `width="120" height="95"`) {
+		t.Errorf("Expected a 120 by 95 document, got %s", svg)
+	}
+	if svg := string(s.SizedSVG(32)); !strings.Contains(svg, `width="40" height="32"`) {
+		t.Errorf("Expected a 40 by 32 symbol, got %s", svg)
+	}
+}
+
+func TestSIDC(t *testing.T) {
+	s := Symbol{Affiliation: Neutral, Echelon: Platoon, Branch: Armour, Country: "gb"}
+	if got, want := s.SIDC(), "SNGPUCA----DGB-"; got != want {
+		t.Errorf("Expected SIDC %s, got %s", want, got)
+	}
+	if len(Symbol{}.SIDC()) != 15 {
+		t.Errorf("Expected a 15 character SIDC for an empty symbol, got %q", Symbol{}.SIDC())
+	}
+}
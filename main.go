@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	migrations "orbat/SQL/Migrations"
+	"orbat/internal/commands"
 	"orbat/internal/database"
 	"orbat/internal/handlers"
+	"orbat/internal/imagegc"
 	"orbat/internal/storage"
 	"github.com/joho/godotenv"
 )
@@ -34,15 +38,34 @@ func main() {
 	}
 
 	// Initialize database
-	if err := database.Initialize(); err != nil {
+	store, err := database.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
 		fmt.Printf("Fatal: %v\n", err)
 		os.Exit(1)
 	}
-	defer database.Close()
+	defer store.Close()
+
+	// Check the schema, except for the migrate command which fixes it
+	if len(os.Args) < 2 || os.Args[1] != "migrate" {
+		if err := checkSchema(store); err != nil {
+			fmt.Printf("Fatal: %v\n", err)
+			os.Exit(1)
+		}
 
-	// After database connection is established
-	if err := database.StandardizeCountryCodes(); err != nil {
-		log.Printf("Warning: Failed to standardize country codes: %v", err)
+		if err := store.StandardizeCountryCodes(); err != nil {
+			log.Printf("Warning: Failed to standardize country codes: %v", err)
+		}
+	}
+
+	// Run a command-line subcommand instead of the server if one is given
+	if len(os.Args) > 1 {
+		err := commands.Run(store, os.Args[1:])
+		store.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	// Initialize storage
@@ -52,32 +75,25 @@ func main() {
 	}
 	defer storage.Close()
 
-	// Initialize templates
-	if err := handlers.Initialize("templates"); err != nil {
+	// Reconcile stored images with the database periodically if configured
+	if interval := os.Getenv("IMAGE_GC_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			fmt.Printf("Fatal: Invalid IMAGE_GC_INTERVAL %q\n", interval)
+			os.Exit(1)
+		}
+		opts := imagegc.Options{DryRun: os.Getenv("IMAGE_GC_DRY_RUN") == "true", MinAge: imagegc.DefaultMinAge}
+		go imagegc.Schedule(context.Background(), d, store, storage.Current(), opts)
+	}
+
+	// Initialize templates and routes
+	app, err := handlers.NewApp(store, "templates")
+	if err != nil {
 		fmt.Printf("Fatal: Failed to parse templates: %v\n", err)
 		os.Exit(1)
 	}
-
-	// Set up routes
-	http.HandleFunc("/", handlers.GroupsHandler)
-	http.HandleFunc("/group/", func(w http.ResponseWriter, r *http.Request) {
-		// Check if this is an edit request
-		if len(r.URL.Path) > 7 && r.URL.Path[len(r.URL.Path)-5:] == "/edit" {
-			handlers.EditGroupHandler(w, r)
-		} else {
-			handlers.GroupDetailsHandler(w, r)
-		}
-	})
-	http.HandleFunc("/add_group", handlers.AddGroupHandler)
-	http.HandleFunc("/weapons", handlers.WeaponsHandler)
-	http.HandleFunc("/weapon/", handlers.WeaponDetailsHandler)
-	http.HandleFunc("/member/", handlers.MemberWeaponsHandler)
-	http.HandleFunc("/vehicles", handlers.VehiclesHandler)
-	http.HandleFunc("/vehicle/", handlers.VehicleDetailsHandler)
-	http.HandleFunc("/countries", handlers.CountriesHandler)
-	http.HandleFunc("/country/", handlers.CountryDetailsHandler)
-	http.HandleFunc("/health", handlers.HealthCheckHandler)
-	http.HandleFunc("/api/validate-country", handlers.ValidateCountryHandler)
+	app.AnonymousRead = os.Getenv("ANONYMOUS_READ") == "true"
+	app.SecureCookies = os.Getenv("COOKIE_SECURE") != "false"
 
 	// Get port from environment variable
 	port := os.Getenv("PORT")
@@ -88,6 +104,7 @@ func main() {
 	// Create a server with timeouts
 	srv := &http.Server{
 		Addr:         ":" + port,
+		Handler:      app.Routes(),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -100,3 +117,25 @@ func main() {
 		os.Exit(1)
 	}
 } 
+
+// checkSchema makes sure all embedded migrations have been applied. Pending
+// migrations are applied when AUTO_MIGRATE is true and are an error otherwise.
+func checkSchema(store *database.Store) error {
+	migrator, err := store.Migrator(migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("AUTO_MIGRATE") != "true" {
+		if err := migrator.CheckSchema(); err != nil {
+			return fmt.Errorf("%v; run \"orbat migrate up\" or set AUTO_MIGRATE=true", err)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up()
+	for _, m := range applied {
+		fmt.Printf("Info: Applied migration %s\n", m.Name)
+	}
+	return err
+}
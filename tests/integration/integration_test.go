@@ -58,7 +58,8 @@ func TestMain(m *testing.M) {
 	}
 
 	// Initialize database connection
-	if err := database.Initialize(); err != nil {
+	store, err := database.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize database: %v", err))
 	}
 
@@ -94,18 +95,23 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create page: %v", err))
 	}
-	defer page.Close()
 
 	// Run tests
 	code := m.Run()
 
-	// Cleanup
+	// Cleanup. Deferred calls would not run, as os.Exit skips them.
+	if err := page.Close(); err != nil {
+		fmt.Printf("Failed to close page: %v\n", err)
+	}
 	if err := browser.Close(); err != nil {
 		fmt.Printf("Failed to close browser: %v\n", err)
 	}
 	if err := pw.Stop(); err != nil {
 		fmt.Printf("Failed to stop Playwright: %v\n", err)
 	}
+	if err := store.Close(); err != nil {
+		fmt.Printf("Failed to close database: %v\n", err)
+	}
 
 	os.Exit(code)
 }